@@ -0,0 +1,190 @@
+// Update Checker
+// Copyright (C) 2020-22  Florian Probst
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// strategyAcrobat selects the catalog entry of the Acrobat track (continuous
+// or classic with its year) from the DisplayName and the "YY.XXX.XXXXX"
+// version. The catalog of the rule is the Reader product ("Adobe Acrobat
+// Reader"), Acrobat is checked against "Adobe Acrobat" first.
+const strategyAcrobat = "acrobat"
+
+// Acrobat tracks
+const (
+	acrobatContinuous = "Continuous" // "Adobe Acrobat Reader DC", builds 2xxxx
+	acrobatClassic    = "Classic"    // "Adobe Acrobat Reader 2020", builds 3xxxx
+)
+
+// first build numbers of the tracks in "YY.XXX.XXXXX"
+const (
+	acrobatContinuousBuild = 20000
+	acrobatClassicBuild    = 30000
+)
+
+var (
+	// year of a classic track in the DisplayName, e.g. "Adobe Acrobat 2020"
+	acrobatClassicYear = regexp.MustCompile(`\b(20\d\d)\b`)
+	// "Adobe Acrobat Reader DC", "Adobe Reader XI"
+	acrobatReaderName = regexp.MustCompile(`(?i)^adobe (acrobat )?reader\b`)
+	acrobatDCName     = regexp.MustCompile(`(?i)\bDC\b`)
+)
+
+// acrobatInstallation is an installed Acrobat or Acrobat Reader
+type acrobatInstallation struct {
+	Reader       bool
+	Track        string // acrobatContinuous, acrobatClassic or empty for releases before DC
+	Year         string // year of the classic track, e.g. "2020"
+	Architecture string
+}
+
+// parseAcrobatInstallation identifies product, track and architecture of an
+// installed Acrobat. The track is taken from the build number of the version
+// (the classic track of 2015 was also called "DC"), else from the
+// DisplayName.
+func parseAcrobatInstallation(installedComponent installedSoftwareComponent) (acrobatInstallation, error) {
+	acrobat := acrobatInstallation{
+		Reader:       acrobatReaderName.MatchString(installedComponent.DisplayName),
+		Architecture: installedComponent.Architecture,
+	}
+	if strings.Contains(installedComponent.DisplayName, "64-bit") {
+		acrobat.Architecture = ArchitectureX64
+	}
+
+	version, err := parseVersion(installedComponent.DisplayVersion)
+	if err != nil {
+		return acrobat, err
+	}
+
+	year := acrobatClassicYear.FindStringSubmatch(installedComponent.DisplayName)
+	switch {
+	case len(version.Parts) >= 3 && version.Parts[2] >= acrobatClassicBuild:
+		acrobat.Track = acrobatClassic
+		acrobat.Year = strconv.FormatUint(2000+version.Parts[0], 10)
+	case len(version.Parts) >= 3 && version.Parts[2] >= acrobatContinuousBuild:
+		acrobat.Track = acrobatContinuous
+	case year != nil:
+		acrobat.Track = acrobatClassic
+		acrobat.Year = year[1]
+	case acrobatDCName.MatchString(installedComponent.DisplayName):
+		acrobat.Track = acrobatContinuous
+	}
+	return acrobat, nil
+}
+
+// catalogNames returns the catalog names of the track, Acrobat before
+// Reader (both are released with the same versions)
+func (acrobat acrobatInstallation) catalogNames(readerCatalog string, track string, year string) []string {
+	products := []string{readerCatalog}
+	if !acrobat.Reader {
+		products = []string{strings.TrimSuffix(readerCatalog, " Reader"), readerCatalog}
+	}
+
+	var names []string
+	for _, product := range products {
+		if track == acrobatClassic {
+			names = append(names, product+" "+year)
+		} else {
+			names = append(names, product+" DC", product)
+		}
+	}
+	return names
+}
+
+// String describes product, track and architecture, e.g. "Acrobat Reader,
+// classic track 2020, x64"
+func (acrobat acrobatInstallation) String() string {
+	description := "Acrobat"
+	if acrobat.Reader {
+		description = "Acrobat Reader"
+	}
+	switch acrobat.Track {
+	case acrobatContinuous:
+		description += ", continuous track"
+	case acrobatClassic:
+		description += ", classic track " + acrobat.Year
+	default:
+		description += ", release before DC"
+	}
+	if acrobat.Architecture != "" {
+		description += ", " + acrobat.Architecture
+	}
+	return description
+}
+
+// evaluateAcrobat maps an installed Acrobat to the catalog entry of its
+// track. Tracks that are not in the catalog (anymore) are end of life, the
+// continuous track is the mapped entry then.
+func (rule productRule) evaluateAcrobat(installedComponent installedSoftwareComponent, softwareReleaseStatii map[string]softwareReleaseStatus, catalog string) (softwareReleaseStatus, softwareStatus, statusReason) {
+	acrobat, err := parseAcrobatInstallation(installedComponent)
+	if err != nil {
+		Trace.Printf("%s: %s", rule.Name, err)
+		return softwareReleaseStatus{}, StatusUnknown, ReasonVersionUnparseable
+	}
+
+	if acrobat.Track != "" {
+		if currentRelease, found := acrobatCatalogEntry(softwareReleaseStatii, acrobat.catalogNames(catalog, acrobat.Track, acrobat.Year)); found {
+			status, reason := rule.compareWithCatalog(installedComponent.DisplayVersion, currentRelease)
+			return currentRelease, status, reason
+		}
+	}
+
+	continuous, found := acrobatCatalogEntry(softwareReleaseStatii, acrobat.catalogNames(catalog, acrobatContinuous, ""))
+	if !found {
+		return continuous, StatusUnknown, ReasonNoCatalogEntry
+	}
+	if acrobat.Track == acrobatContinuous {
+		// the continuous track is in the catalog under an unknown name
+		status, reason := rule.compareWithCatalog(installedComponent.DisplayVersion, continuous)
+		return continuous, status, reason
+	}
+	// the end of the installed track is not in the catalog
+	Trace.Printf("%s: no catalog entry for %s", rule.Name, acrobat)
+	continuous.Ends = ""
+	return continuous, StatusOutdated, ReasonEndOfLife
+}
+
+// acrobatCatalogEntry returns the newest catalog entry of the first catalog
+// name that is in the catalog
+func acrobatCatalogEntry(softwareReleaseStatii map[string]softwareReleaseStatus, names []string) (softwareReleaseStatus, bool) {
+	for _, name := range names {
+		entry, found := newestCatalogEntry(softwareReleaseStatii, func(statName string, statValue softwareReleaseStatus) bool {
+			return statValue.Name == name
+		})
+		if found {
+			return entry, true
+		}
+	}
+	return softwareReleaseStatus{}, false
+}
+
+// acrobatDetail describes the installed Acrobat for the detail of the mapping
+func acrobatDetail(installedComponent installedSoftwareComponent, mapping installedSoftwareMapping) string {
+	acrobat, err := parseAcrobatInstallation(installedComponent)
+	if err != nil {
+		return ""
+	}
+	detail := acrobat.String()
+	if mapping.Reason == ReasonEndOfLife && mapping.MappedStatus.Ends == "" {
+		detail += "; track not supported anymore, update to the continuous track"
+	}
+	return detail
+}
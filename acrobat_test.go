@@ -0,0 +1,101 @@
+// Update Checker
+// Copyright (C) 2020-22  Florian Probst
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import "testing"
+
+func TestEvaluateAcrobat(t *testing.T) {
+	installedSoftware := map[string]installedSoftwareComponent{
+		// 32-bit and 64-bit Reader of the continuous track
+		"reader-x86":    {DisplayName: "Adobe Acrobat Reader DC", DisplayVersion: "21.011.20039", Publisher: "Adobe Systems Incorporated", Architecture: ArchitectureX86},
+		"reader-x64":    {DisplayName: "Adobe Acrobat Reader DC", DisplayVersion: "21.011.20039", Publisher: "Adobe Systems Incorporated", Architecture: ArchitectureX64},
+		"reader-64bit":  {DisplayName: "Adobe Acrobat Reader DC (64-bit)", DisplayVersion: "21.007.20099", Publisher: "Adobe Systems Incorporated"},
+		"acrobat-dc":    {DisplayName: "Adobe Acrobat DC", DisplayVersion: "21.011.20039", Publisher: "Adobe Systems Incorporated"},
+		"reader-2020":   {DisplayName: "Adobe Acrobat Reader 2020 MUI", DisplayVersion: "20.004.30020", Publisher: "Adobe Systems Incorporated"},
+		"acrobat-2020":  {DisplayName: "Adobe Acrobat 2020", DisplayVersion: "20.004.30017", Publisher: "Adobe Systems Incorporated"},
+		"acrobat-2017":  {DisplayName: "Adobe Acrobat 2017", DisplayVersion: "17.011.30207", Publisher: "Adobe Systems Incorporated"},
+		"acrobat-2015":  {DisplayName: "Adobe Acrobat DC - Deutsch", DisplayVersion: "15.006.30625", Publisher: "Adobe Systems Incorporated"},
+		"reader-xi":     {DisplayName: "Adobe Reader XI (11.0.23)", DisplayVersion: "11.0.23", Publisher: "Adobe Systems Incorporated"},
+		"reader-broken": {DisplayName: "Adobe Reader", DisplayVersion: "unknown", Publisher: "Adobe Systems Incorporated"},
+	}
+	checkVerifiedSoftware(t, installedSoftware, nil, map[string]verifyTest{
+		"Adobe Acrobat Reader DC (x86)":    {StatusUpToDate, ReasonCurrent, "21.011.20039", "Acrobat Reader, continuous track, x86"},
+		"Adobe Acrobat Reader DC (x64)":    {StatusUpToDate, ReasonCurrent, "21.011.20039", "Acrobat Reader, continuous track, x64"},
+		"Adobe Acrobat Reader DC (64-bit)": {StatusOutdated, ReasonUpdateAvailable, "21.011.20039", "Acrobat Reader, continuous track, x64"},
+		// Acrobat is checked against Reader if it is not in the catalog
+		"Adobe Acrobat DC":              {StatusUpToDate, ReasonCurrent, "21.011.20039", "Acrobat, continuous track"},
+		"Adobe Acrobat Reader 2020 MUI": {StatusUpToDate, ReasonCurrent, "20.004.30020", "Acrobat Reader, classic track 2020"},
+		"Adobe Acrobat 2020":            {StatusOutdated, ReasonUpdateAvailable, "20.004.30020", "Acrobat, classic track 2020"},
+		// tracks missing from the catalog are end of life
+		"Adobe Acrobat 2017":         {StatusOutdated, ReasonEndOfLife, "21.011.20039", "Acrobat, classic track 2017; track not supported anymore, update to the continuous track"},
+		"Adobe Acrobat DC - Deutsch": {StatusOutdated, ReasonEndOfLife, "21.011.20039", "Acrobat, classic track 2015; track not supported anymore, update to the continuous track"},
+		"Adobe Reader XI (11.0.23)":  {StatusOutdated, ReasonEndOfLife, "21.011.20039", "Acrobat Reader, release before DC; track not supported anymore, update to the continuous track"},
+		"Adobe Reader":               {StatusUnknown, ReasonVersionUnparseable, "", ""},
+	})
+}
+
+func TestParseAcrobatInstallationTrack(t *testing.T) {
+	tests := []struct {
+		displayName, displayVersion string
+		track, year                 string
+	}{
+		{"Adobe Acrobat Reader DC", "21.011.20039", acrobatContinuous, ""},
+		{"Adobe Acrobat Reader 2020", "20.004.30020", acrobatClassic, "2020"},
+		{"Adobe Acrobat 2017", "17.011.30207", acrobatClassic, "2017"},
+		// the classic track of 2015 was called "DC", the build number decides
+		{"Adobe Acrobat DC", "15.006.30625", acrobatClassic, "2015"},
+		// short versions are identified by the DisplayName
+		{"Adobe Acrobat 2017", "17.0", acrobatClassic, "2017"},
+		{"Adobe Acrobat Reader DC", "21.0", acrobatContinuous, ""},
+		{"Adobe Reader XI", "11.0.23", "", ""},
+	}
+	for _, test := range tests {
+		acrobat, err := parseAcrobatInstallation(installedSoftwareComponent{DisplayName: test.displayName, DisplayVersion: test.displayVersion})
+		if err != nil {
+			t.Errorf("%s %s: %s", test.displayName, test.displayVersion, err)
+			continue
+		}
+		if acrobat.Track != test.track || acrobat.Year != test.year {
+			t.Errorf("%s %s: track %q %q, want %q %q", test.displayName, test.displayVersion, acrobat.Track, acrobat.Year, test.track, test.year)
+		}
+	}
+}
+
+func TestEvaluateAcrobatEndOfLife(t *testing.T) {
+	rule := embeddedRule(t, "Adobe Acrobat")
+	softwareReleaseStatii := map[string]softwareReleaseStatus{
+		"Adobe Acrobat Reader DC Continuous": {Name: "Adobe Acrobat Reader DC", MajorRelease: "Continuous", Version: "21.011.20039", Ends: "2099-12-31"},
+		"Adobe Acrobat Reader 2020 Classic":  {Name: "Adobe Acrobat Reader 2020", MajorRelease: "Classic", Version: "20.004.30020", Ends: "2025-11-30"},
+	}
+
+	// the end of the continuous track must not be shown as the end of the
+	// installed classic track
+	entry, status, reason := rule.evaluateAcrobat(installedSoftwareComponent{DisplayName: "Adobe Acrobat Reader 2017", DisplayVersion: "17.011.30207"}, softwareReleaseStatii, rule.Catalog)
+	if status != StatusOutdated || reason != ReasonEndOfLife || entry.Version != "21.011.20039" || entry.Ends != "" {
+		t.Errorf("classic 2017: %s (%s) %s ends %q", statusString(status), reason, entry.Version, entry.Ends)
+	}
+
+	entry, status, reason = rule.evaluateAcrobat(installedSoftwareComponent{DisplayName: "Adobe Acrobat Reader 2020", DisplayVersion: "20.004.30020"}, softwareReleaseStatii, rule.Catalog)
+	if status != StatusUpToDate || reason != ReasonCurrent || entry.Ends != "2025-11-30" {
+		t.Errorf("classic 2020: %s (%s) ends %q", statusString(status), reason, entry.Ends)
+	}
+
+	delete(softwareReleaseStatii, "Adobe Acrobat Reader DC Continuous")
+	if _, status, reason := rule.evaluateAcrobat(installedSoftwareComponent{DisplayName: "Adobe Acrobat Reader 2017", DisplayVersion: "17.011.30207"}, softwareReleaseStatii, rule.Catalog); status != StatusUnknown || reason != ReasonNoCatalogEntry {
+		t.Errorf("no continuous track: %s (%s)", statusString(status), reason)
+	}
+}
@@ -0,0 +1,113 @@
+// Update Checker
+// Copyright (C) 2020-21  Florian Probst
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+)
+
+// buildHistoryFile holds the Windows builds seen in downloaded vergrabber.json
+// files. Vergrabber only lists the latest cumulative update, the history is
+// used to count how many cumulative updates a machine is behind.
+const buildHistoryFile = vergrabberFile + ".history"
+
+// buildHistory maps Vergrabber keys (e.g. "Microsoft Windows 10 21H2") to
+// the versions ("<build>.<UBR>") seen for them
+type buildHistory map[string][]string
+
+// readBuildHistory reads the build history, a missing or invalid file
+// results in an empty history
+func readBuildHistory() buildHistory {
+	history := buildHistory{}
+	content, err := ioutil.ReadFile(buildHistoryFile)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			Info.Println("Could not read " + buildHistoryFile + ": " + err.Error())
+		}
+		return history
+	}
+	if err := json.Unmarshal(content, &history); err != nil {
+		Info.Println("Ignoring invalid " + buildHistoryFile + ": " + err.Error())
+		return buildHistory{}
+	}
+	return history
+}
+
+// writeBuildHistory stores the build history
+func writeBuildHistory(history buildHistory) error {
+	content, err := json.MarshalIndent(history, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(buildHistoryFile, content, 0644)
+}
+
+// record adds the Windows versions of the catalog to the history and
+// returns true if the history has changed
+func (h buildHistory) record(softwareReleaseStatii map[string]softwareReleaseStatus) bool {
+	changed := false
+	for key, status := range softwareReleaseStatii {
+		if !strings.HasPrefix(status.Name, "Microsoft Windows") || status.Version == "" {
+			continue
+		}
+		if containsString(h[key], status.Version) {
+			continue
+		}
+		h[key] = append(h[key], status.Version)
+		sort.Slice(h[key], func(i, j int) bool {
+			c, _ := compareVersionStrings(h[key][i], h[key][j])
+			return c < 0
+		})
+		changed = true
+	}
+	return changed
+}
+
+// updatesBehind returns the number of cumulative updates of the same build
+// seen after the installed version. If the installed version is older than
+// all versions in the history, the real number may be higher (atLeast).
+func (h buildHistory) updatesBehind(key string, installed softwareVersion) (updates int, atLeast bool) {
+	atLeast = true
+	for _, seen := range h[key] {
+		seenVersion, err := parseVersion(seen)
+		if err != nil || len(seenVersion.Parts) == 0 || len(installed.Parts) == 0 ||
+			seenVersion.Parts[0] != installed.Parts[0] {
+			// other build (feature update)
+			continue
+		}
+		if c := seenVersion.compare(installed); c > 0 {
+			updates++
+		} else {
+			atLeast = false
+		}
+	}
+	return updates, atLeast
+}
+
+// containsString checks if the slice contains the string
+func containsString(slice []string, s string) bool {
+	for _, item := range slice {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
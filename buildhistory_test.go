@@ -0,0 +1,136 @@
+// Update Checker
+// Copyright (C) 2020-22  Florian Probst
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"io/ioutil"
+	"reflect"
+	"testing"
+)
+
+func TestBuildHistoryRecord(t *testing.T) {
+	history := buildHistory{
+		"Microsoft Windows 10 21H2": {"19044.999", "19044.1466"},
+	}
+	catalog := map[string]softwareReleaseStatus{
+		"Microsoft Windows 10 21H2": {Name: "Microsoft Windows 10", MajorRelease: "21H2", Category: "client", Version: "19044.1526"},
+		"Microsoft Windows 11 21H2": {Name: "Microsoft Windows 11", MajorRelease: "21H2", Category: "client", Version: "22000.493"},
+	}
+	catalog["Mozilla Firefox 96"] = softwareReleaseStatus{Name: "Mozilla Firefox", MajorRelease: "96", Version: "96.0.3"}
+
+	if !history.record(catalog) {
+		t.Error("history not changed by new builds")
+	}
+	want := buildHistory{
+		"Microsoft Windows 10 21H2": {"19044.999", "19044.1466", "19044.1526"},
+		"Microsoft Windows 11 21H2": {"22000.493"},
+	}
+	if !reflect.DeepEqual(history, want) {
+		t.Errorf("history %v, want %v", history, want)
+	}
+	if history.record(catalog) {
+		t.Error("history changed by known builds")
+	}
+
+	// sorted numerically, not as strings
+	catalog["Microsoft Windows 10 21H2"] = softwareReleaseStatus{Name: "Microsoft Windows 10", MajorRelease: "21H2", Version: "19044.1000"}
+	history.record(catalog)
+	if got := history["Microsoft Windows 10 21H2"]; !reflect.DeepEqual(got, []string{"19044.999", "19044.1000", "19044.1466", "19044.1526"}) {
+		t.Errorf("history %v not sorted", got)
+	}
+}
+
+func TestBuildHistoryUpdatesBehind(t *testing.T) {
+	history := buildHistory{
+		// the feature update 19045 shares the key in this synthetic history,
+		// an unparseable build is skipped
+		"Microsoft Windows 10 21H2": {"19044.1415", "19044.1466", "19044.1503", "19045.1526", "unknown"},
+		"Microsoft Windows 11 21H2": {},
+	}
+	tests := []struct {
+		key       string
+		installed string
+		updates   int
+		atLeast   bool
+	}{
+		// exact counts: the installed build is in the history
+		{"Microsoft Windows 10 21H2", "19044.1503", 0, false},
+		{"Microsoft Windows 10 21H2", "19044.1466", 1, false},
+		{"Microsoft Windows 10 21H2", "19044.1415", 2, false},
+		// out-of-band updates between the cumulative updates
+		{"Microsoft Windows 10 21H2", "19044.1469", 1, false},
+		{"Microsoft Windows 10 21H2", "19044.1600", 0, false},
+		// older than the history: there may be more updates before it
+		{"Microsoft Windows 10 21H2", "19044.1300", 3, true},
+		{"Microsoft Windows 10 21H2", "19043.1466", 0, true},
+		// unknown releases
+		{"Microsoft Windows 11 21H2", "22000.1", 0, true},
+		{"Microsoft Windows Server 2022", "20348.473", 0, true},
+	}
+	for _, test := range tests {
+		installed, err := parseVersion(test.installed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		updates, atLeast := history.updatesBehind(test.key, installed)
+		if updates != test.updates || atLeast != test.atLeast {
+			t.Errorf("%s %s: %d updates (at least %t), want %d (%t)", test.key, test.installed, updates, atLeast, test.updates, test.atLeast)
+		}
+	}
+}
+
+func TestCumulativeUpdatesBehind(t *testing.T) {
+	tests := []struct {
+		updates int
+		atLeast bool
+		want    string
+	}{
+		{1, false, "1 cumulative update behind"},
+		{3, false, "3 cumulative updates behind"},
+		{3, true, "at least 3 cumulative updates behind"},
+		// the catalog version is always missing
+		{0, false, "at least 1 cumulative update behind"},
+		{0, true, "at least 1 cumulative update behind"},
+	}
+	for _, test := range tests {
+		if text := cumulativeUpdatesBehind(test.updates, test.atLeast); text != test.want {
+			t.Errorf("%d (at least %t): %q, want %q", test.updates, test.atLeast, text, test.want)
+		}
+	}
+}
+
+func TestBuildHistoryFile(t *testing.T) {
+	chdirTemp(t)
+	if history := readBuildHistory(); len(history) != 0 {
+		t.Errorf("history %v without file", history)
+	}
+
+	history := buildHistory{"Microsoft Windows 10 21H2": {"19044.1466", "19044.1503"}}
+	if err := writeBuildHistory(history); err != nil {
+		t.Fatal(err)
+	}
+	if read := readBuildHistory(); !reflect.DeepEqual(read, history) {
+		t.Errorf("read %v, want %v", read, history)
+	}
+
+	if err := ioutil.WriteFile(buildHistoryFile, []byte("{"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if history := readBuildHistory(); len(history) != 0 {
+		t.Errorf("history %v from invalid file", history)
+	}
+}
@@ -0,0 +1,361 @@
+// Update Checker
+// Copyright (C) 2020-22  Florian Probst
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// confidence of automatic catalog matches (in percent)
+const (
+	confidenceExact           = 100 // DisplayName is the catalog name
+	confidencePrefix          = 90  // DisplayName starts with the catalog name
+	confidenceContained       = 70  // DisplayName contains the catalog name
+	confidenceExtraWord       = 5   // subtracted per further word of the DisplayName
+	confidenceVendorAlias     = 70  // catalog name without vendor ("Firefox"), instead of confidenceExact
+	confidencePublisher       = 20  // added if the publisher is the vendor of the catalog name
+	confidenceVersionMismatch = 30  // subtracted if the major version is far from all catalog versions
+	confidenceNoVersion       = 10  // subtracted if there is no comparable version
+)
+
+// minVendorAliasLength is the minimum length of a catalog name without its
+// vendor to be used as alias (no "Edge" for "Microsoft Edge")
+const minVendorAliasLength = 5
+
+// architectureWords are removed from DisplayNames before matching
+var architectureWords = []string{"x64", "x86", "64-bit", "32-bit", "amd64", "win64", "win32", "64bit", "32bit"}
+
+// nameTokenSeparators are replaced by spaces before splitting names into words
+var nameTokenSeparators = strings.NewReplacer("(", " ", ")", " ", "[", " ", "]", " ", ",", " ", ":", " ", "/", " ", "®", " ", "™", " ")
+
+// parenthesizedText matches "(x64 en-US)" and similar additions
+var parenthesizedText = regexp.MustCompile(`\([^)]*\)|\[[^\]]*\]`)
+
+// catalogOverride adjusts the automatic matching of installed software to
+// one catalog product
+type catalogOverride struct {
+	Catalog       string   `json:"catalog"`                 // catalog software name
+	Aliases       []string `json:"aliases,omitempty"`       // further names of the installed software, matched like the catalog name
+	Exclude       []string `json:"exclude,omitempty"`       // regexps of DisplayNames that are never matched to the product
+	Publisher     string   `json:"publisher,omitempty"`     // regexp the Publisher has to match (optional)
+	Disabled      bool     `json:"disabled,omitempty"`      // no automatic matching to the product
+	MinConfidence int      `json:"minConfidence,omitempty"` // replaces catalogMatching.minConfidence of the configuration
+	Strategy      string   `json:"strategy,omitempty"`      // branch selection strategy, default catalog-branch
+	VersionParts  int      `json:"versionParts,omitempty"`  // only compare the first n parts of the installed version (0 = all)
+	Compare       string   `json:"compare,omitempty"`       // comparison mode, default equal
+
+	excludeRegexps  []*regexp.Regexp
+	publisherRegexp *regexp.Regexp
+}
+
+// catalogMatcher maps installed software without product rule to the
+// catalog products by name
+type catalogMatcher struct {
+	products      []catalogProduct
+	minConfidence int
+}
+
+// catalogProduct is a product of the catalog with the names it is expected
+// to be installed as
+type catalogProduct struct {
+	Name     string
+	aliases  []catalogAlias
+	majors   map[uint64]bool // major versions of all catalog entries
+	override catalogOverride
+}
+
+// catalogAlias is a name of a catalog product split into words
+type catalogAlias struct {
+	words      []string
+	confidence int    // confidence of an exact match
+	vendor     string // vendor removed from the catalog name, empty if not removed
+}
+
+// catalogMatch is the result of an automatic match
+type catalogMatch struct {
+	Product    *catalogProduct
+	Confidence int
+}
+
+// compile checks the override and compiles its regular expressions
+func (override *catalogOverride) compile() error {
+	if override.Catalog == "" {
+		return fmt.Errorf("catalog is mandatory")
+	}
+	for _, exclude := range override.Exclude {
+		excludeRegexp, err := regexp.Compile(exclude)
+		if err != nil {
+			return fmt.Errorf("%s: %w", override.Catalog, err)
+		}
+		override.excludeRegexps = append(override.excludeRegexps, excludeRegexp)
+	}
+	if override.Publisher != "" {
+		var err error
+		override.publisherRegexp, err = regexp.Compile(override.Publisher)
+		if err != nil {
+			return fmt.Errorf("%s: %w", override.Catalog, err)
+		}
+	}
+	if err := checkStrategy(override.strategy(), override.compare()); err != nil {
+		return fmt.Errorf("%s: %w", override.Catalog, err)
+	}
+	return nil
+}
+
+// strategy returns the branch selection strategy (default catalog-branch)
+func (override catalogOverride) strategy() string {
+	if override.Strategy == "" {
+		return strategyCatalogBranch
+	}
+	return override.Strategy
+}
+
+// compare returns the comparison mode (default equal)
+func (override catalogOverride) compare() string {
+	if override.Compare == "" {
+		return compareEqual
+	}
+	return override.Compare
+}
+
+// mergeCatalogOverrides puts the local overrides in front of the embedded
+// ones. Embedded overrides of the same catalog product are dropped.
+func mergeCatalogOverrides(localOverrides, embedded []catalogOverride) []catalogOverride {
+	localCatalogs := make(map[string]bool)
+	for _, override := range localOverrides {
+		localCatalogs[override.Catalog] = true
+	}
+
+	merged := append([]catalogOverride{}, localOverrides...)
+	for _, override := range embedded {
+		if !localCatalogs[override.Catalog] {
+			merged = append(merged, override)
+		}
+	}
+	return merged
+}
+
+// newCatalogMatcher derives the products and their aliases from the catalog.
+// Windows releases are left out, they are verified separately.
+func newCatalogMatcher(softwareReleaseStatii map[string]softwareReleaseStatus, overrides []catalogOverride, minConfidence int) *catalogMatcher {
+	overridesByCatalog := make(map[string]catalogOverride)
+	for _, override := range overrides {
+		if _, exists := overridesByCatalog[override.Catalog]; !exists {
+			overridesByCatalog[override.Catalog] = override
+		}
+	}
+
+	productsByName := make(map[string]*catalogProduct)
+	for _, statValue := range softwareReleaseStatii {
+		if strings.HasPrefix(statValue.Name, "Microsoft Windows") {
+			continue
+		}
+		product, exists := productsByName[statValue.Name]
+		if !exists {
+			product = &catalogProduct{Name: statValue.Name, majors: make(map[uint64]bool)}
+			product.override = overridesByCatalog[statValue.Name]
+			productsByName[statValue.Name] = product
+		}
+		for _, version := range []string{statValue.Version, statValue.MajorRelease} {
+			if parsed, err := parseVersion(version); err == nil {
+				product.majors[parsed.Parts[0]] = true
+			}
+		}
+	}
+
+	matcher := &catalogMatcher{minConfidence: minConfidence}
+	for _, product := range productsByName {
+		if product.override.Disabled {
+			continue
+		}
+		product.aliases = catalogAliases(product.Name, product.override.Aliases)
+		matcher.products = append(matcher.products, *product)
+	}
+	// deterministic results on equal confidence
+	sort.Slice(matcher.products, func(i, j int) bool {
+		return matcher.products[i].Name < matcher.products[j].Name
+	})
+	return matcher
+}
+
+// catalogAliases returns the names a product is matched by: the catalog
+// name, the catalog name without its vendor ("Firefox" for "Mozilla Firefox")
+// and the aliases of the override
+func catalogAliases(name string, overrideAliases []string) []catalogAlias {
+	words := nameWords(name)
+	aliases := []catalogAlias{{words: words, confidence: confidenceExact}}
+	if len(words) > 1 && len(strings.Join(words[1:], " ")) >= minVendorAliasLength {
+		aliases = append(aliases, catalogAlias{words: words[1:], confidence: confidenceVendorAlias, vendor: words[0]})
+	}
+	for _, alias := range overrideAliases {
+		if aliasWords := nameWords(alias); len(aliasWords) > 0 {
+			aliases = append(aliases, catalogAlias{words: aliasWords, confidence: confidenceExact})
+		}
+	}
+	return aliases
+}
+
+// match returns the catalog product with the highest confidence for the
+// installed component (at least the minimum confidence of the product)
+func (matcher *catalogMatcher) match(installedComponent installedSoftwareComponent) (catalogMatch, bool) {
+	// words with and without version numbers (some catalog names contain a
+	// year, e.g. "Adobe Acrobat Reader 2020")
+	displayWords := nameWords(parenthesizedText.ReplaceAllString(installedComponent.DisplayName, " "))
+	candidates := [][]string{displayWords, withoutVersionWords(displayWords)}
+	publisher := strings.ToLower(installedComponent.Publisher)
+
+	var best catalogMatch
+	for i := range matcher.products {
+		product := &matcher.products[i]
+		if !product.accepts(installedComponent) {
+			continue
+		}
+
+		confidence := 0
+		for _, alias := range product.aliases {
+			for _, words := range candidates {
+				aliasConfidence := alias.matchConfidence(words)
+				if aliasConfidence > 0 && alias.vendor != "" && strings.Contains(publisher, alias.vendor) {
+					aliasConfidence += confidencePublisher
+				}
+				if aliasConfidence > confidence {
+					confidence = aliasConfidence
+				}
+			}
+		}
+		if confidence == 0 {
+			continue
+		}
+		confidence -= product.versionPenalty(installedComponent.DisplayVersion)
+
+		minConfidence := matcher.minConfidence
+		if product.override.MinConfidence > 0 {
+			minConfidence = product.override.MinConfidence
+		}
+		if confidence < minConfidence {
+			Trace.Printf("%s: catalog product %s rejected (confidence %d%%)", installedComponent.DisplayName, product.Name, confidence)
+			continue
+		}
+		if best.Product == nil || confidence > best.Confidence || (confidence == best.Confidence && len(product.Name) > len(best.Product.Name)) {
+			best = catalogMatch{Product: product, Confidence: confidence}
+		}
+	}
+	return best, best.Product != nil
+}
+
+// accepts checks the exclusions and the publisher of the override
+func (product *catalogProduct) accepts(installedComponent installedSoftwareComponent) bool {
+	for _, excludeRegexp := range product.override.excludeRegexps {
+		if excludeRegexp.MatchString(installedComponent.DisplayName) {
+			return false
+		}
+	}
+	if product.override.publisherRegexp != nil && !product.override.publisherRegexp.MatchString(installedComponent.Publisher) {
+		return false
+	}
+	return true
+}
+
+// versionPenalty lowers the confidence if the installed version does not fit
+// the catalog: its major version is not within one of the major versions of
+// the catalog entries (e.g. "PHP Manager for IIS 1.5" is no PHP 8.1)
+func (product *catalogProduct) versionPenalty(version string) int {
+	installed, err := parseVersion(version)
+	if err != nil || len(product.majors) == 0 {
+		return confidenceNoVersion
+	}
+	major := installed.Parts[0]
+	for catalogMajor := range product.majors {
+		if major+1 >= catalogMajor && major <= catalogMajor+1 {
+			return 0
+		}
+	}
+	return confidenceVersionMismatch
+}
+
+// rule returns the product rule used to evaluate an automatic match
+func (product *catalogProduct) rule() productRule {
+	return productRule{
+		Name:         product.Name,
+		Catalog:      product.Name,
+		Strategy:     product.override.strategy(),
+		VersionParts: product.override.VersionParts,
+		Compare:      product.override.compare(),
+	}
+}
+
+// matchConfidence returns the confidence of the alias for the words of a
+// DisplayName (0 if it does not match)
+func (alias catalogAlias) matchConfidence(words []string) int {
+	if len(alias.words) == 0 || len(alias.words) > len(words) {
+		return 0
+	}
+	extraWords := len(words) - len(alias.words)
+	for start := 0; start+len(alias.words) <= len(words); start++ {
+		if !equalWords(words[start:start+len(alias.words)], alias.words) {
+			continue
+		}
+		switch {
+		case extraWords == 0:
+			return alias.confidence
+		case start == 0:
+			return alias.confidence - (confidenceExact - confidencePrefix) - confidenceExtraWord*(extraWords-1)
+		default:
+			return alias.confidence - (confidenceExact - confidenceContained) - confidenceExtraWord*(extraWords-1)
+		}
+	}
+	return 0
+}
+
+// equalWords compares two lists of words
+func equalWords(a []string, b []string) bool {
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return len(a) == len(b)
+}
+
+// nameWords splits a name into lower case words without architecture words,
+// separators like " - " and trademark signs
+func nameWords(name string) []string {
+	var words []string
+	for _, word := range strings.Fields(nameTokenSeparators.Replace(strings.ToLower(name))) {
+		if strings.Trim(word, "-–.") == "" || containsString(architectureWords, word) {
+			continue
+		}
+		words = append(words, word)
+	}
+	return words
+}
+
+// withoutVersionWords removes version numbers ("96.0.3", "2.50", "8") from
+// the words of a name
+func withoutVersionWords(words []string) []string {
+	var withoutVersions []string
+	for _, word := range words {
+		if _, err := parseVersion(word); err == nil && strings.Trim(word, "0123456789.-_") == "" {
+			continue
+		}
+		withoutVersions = append(withoutVersions, word)
+	}
+	return withoutVersions
+}
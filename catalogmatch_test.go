@@ -0,0 +1,211 @@
+// Update Checker
+// Copyright (C) 2020-22  Florian Probst
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// matchTest is an installed software and its expected catalog product (empty
+// if it must not be matched)
+type matchTest struct {
+	displayName string
+	version     string
+	publisher   string
+	product     string
+	confidence  int
+}
+
+func checkCatalogMatches(t *testing.T, matcher *catalogMatcher, tests []matchTest) {
+	t.Helper()
+	for _, test := range tests {
+		component := installedSoftwareComponent{DisplayName: test.displayName, DisplayVersion: test.version, Publisher: test.publisher}
+		match, found := matcher.match(component)
+		switch {
+		case test.product == "" && found:
+			t.Errorf("%s %s: matched to %s (%d%%)", test.displayName, test.version, match.Product.Name, match.Confidence)
+		case test.product != "" && !found:
+			t.Errorf("%s %s: no match, want %s", test.displayName, test.version, test.product)
+		case found && (match.Product.Name != test.product || match.Confidence != test.confidence):
+			t.Errorf("%s %s: %s (%d%%), want %s (%d%%)", test.displayName, test.version, match.Product.Name, match.Confidence, test.product, test.confidence)
+		}
+	}
+}
+
+// testCatalogMatcher returns a matcher for the test catalog with the given
+// overrides (compiled like the ones of a rules file)
+func testCatalogMatcher(t *testing.T, overrides []catalogOverride, minConfidence int) *catalogMatcher {
+	t.Helper()
+	for i := range overrides {
+		if err := overrides[i].compile(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return newCatalogMatcher(testCatalogStatii(t), overrides, minConfidence)
+}
+
+func TestCatalogMatcher(t *testing.T) {
+	_, overrides, err := parseProductRules(embeddedRules)
+	if err != nil {
+		t.Fatal(err)
+	}
+	matcher := newCatalogMatcher(testCatalogStatii(t), overrides, 70)
+
+	checkCatalogMatches(t, matcher, []matchTest{
+		// exact names, architecture and parenthesized text are left out
+		{"Google Chrome", "97.0.4692.99", "Google LLC", "Google Chrome", 100},
+		{"Notepad++ (64-bit x64)", "8.2.1", "Notepad++ Team", "Notepad++", 100},
+		{"7-Zip 21.07 (x64)", "21.07", "Igor Pavlov", "7-Zip", 100},
+		{"Adobe Acrobat Reader 2020", "20.004.30020", "Adobe Systems Incorporated", "Adobe Acrobat Reader 2020", 100},
+		// name without vendor, with and without the vendor as publisher
+		{"Firefox", "96.0.3", "Mozilla", "Mozilla Firefox", 90},
+		{"Firefox", "96.0.3", "", "Mozilla Firefox", 70},
+		// further words
+		{"KeePass Password Safe 2.50", "2.50", "Dominik Reichl", "KeePass", 85},
+		{"MySQL Server 8.0", "8.0.28", "Oracle Corporation", "MySQL", 90},
+		{"nginx for Windows", "1.21.6", "", "nginx", 85},
+		{"Java 8 Update 321", "8.0.3210.7", "Oracle Corporation", "Java", 90},
+		{"Portable Notepad++", "8.2.1", "", "Notepad++", 70},
+		// no comparable version
+		{"Notepad++", "", "", "Notepad++", 90},
+
+		// tools of the product are excluded by the embedded override
+		{"MySQL Workbench 8.0 CE", "8.0.28", "Oracle Corporation", "", 0},
+		{"MySQL Connector/ODBC 8.0", "8.0.28", "Oracle Corporation", "", 0},
+		// only the vendor in common
+		{"Mozilla Maintenance Service", "96.0.3", "Mozilla", "", 0},
+		{"Apache Directory Studio", "2.0.0", "Apache Software Foundation", "", 0},
+		{"Adobe Genuine Service", "7.6.0.7", "Adobe Inc.", "", 0},
+		{"Google Update Helper", "1.3.36.112", "Google LLC", "", 0},
+		// too many further words and a version far from the catalog
+		{"PHP Manager for IIS", "1.5.0", "", "", 0},
+		// Windows is verified separately
+		{"Microsoft Windows 10", "10.0.19044", "Microsoft Corporation", "", 0},
+		{"PuTTYgen", "0.76", "Simon Tatham", "", 0},
+		// tools named like the product are excluded by the embedded overrides
+		{"Python 3.10.2 (64-bit)", "3.10.2150.0", "Python Software Foundation", "Python", 100},
+		{"Python Launcher", "3.10.7950.0", "Python Software Foundation", "", 0},
+		{"Python 3.10.2 Core Interpreter (64-bit)", "3.10.2150.0", "Python Software Foundation", "", 0},
+		{"Git", "2.35.1", "The Git Development Community", "Git", 100},
+		{"Git LFS version 3.0.2", "3.0.2", "GitHub, Inc.", "", 0},
+		{"Git LFS", "3.0.2", "", "", 0},
+	})
+}
+
+func TestCatalogMatchingDisabledByDefault(t *testing.T) {
+	windowsVersion := &WindowsVersion{CurrentMajorVersionNumber: 10, UBR: 1466, CurrentBuild: "19044", ReleaseID: "21H2", ProductName: "Windows 10 Pro"}
+	inventory := writeTestInventory(t, windowsVersion, map[string]installedSoftwareComponent{
+		"{Launcher}": {DisplayName: "Python Launcher", DisplayVersion: "3.10.7950.0", Publisher: "Python Software Foundation"},
+		"Git LFS":    {DisplayName: "Git LFS version 3.0.2", DisplayVersion: "3.0.2", Publisher: "GitHub, Inc."},
+		"Git_is1":    {DisplayName: "Git", DisplayVersion: "2.35.1", Publisher: "The Git Development Community"},
+	})
+	result, err := runChecks(scanOptions{
+		Providers:   []inventoryProvider{newFileInventory(inventory)},
+		CatalogFile: "testdata/vergrabber.json",
+		AsOf:        time.Date(2022, 1, 31, 0, 0, 0, 0, time.UTC),
+		Config:      defaultConfig(),
+		Offline:     true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, mapping := range result.Mappings[1:] {
+		if mapping.Status != StatusUnknown || mapping.Reason != ReasonNotTracked || mapping.MatchConfidence != 0 {
+			t.Errorf("%s: status %s (%s), want not tracked", mapping.InstalledSoftware.DisplayName, statusString(mapping.Status), mapping.Reason)
+		}
+	}
+}
+
+func TestCatalogMatcherThreshold(t *testing.T) {
+	matcher := testCatalogMatcher(t, nil, 90)
+	checkCatalogMatches(t, matcher, []matchTest{
+		{"Google Chrome", "97.0.4692.99", "Google LLC", "Google Chrome", 100},
+		{"Firefox", "96.0.3", "Mozilla", "Mozilla Firefox", 90},
+		{"Firefox", "96.0.3", "", "", 0},
+		{"KeePass Password Safe 2.50", "2.50", "Dominik Reichl", "", 0},
+	})
+}
+
+func TestCatalogMatcherOverrides(t *testing.T) {
+	matcher := testCatalogMatcher(t, []catalogOverride{
+		// an alias raises the confidence
+		{Catalog: "KeePass", Aliases: []string{"KeePass Password Safe"}},
+		// exclusions and publisher
+		{Catalog: "PuTTY", Publisher: "^Simon Tatham$", Exclude: []string{"(?i)portable"}},
+		{Catalog: "7-Zip", Disabled: true},
+		{Catalog: "Notepad++", MinConfidence: 95},
+		// the first override of a product counts
+		{Catalog: "Notepad++", MinConfidence: 50},
+	}, 70)
+	checkCatalogMatches(t, matcher, []matchTest{
+		{"KeePass Password Safe 2.50", "2.50", "Dominik Reichl", "KeePass", 100},
+		{"PuTTY release 0.76 (64-bit)", "0.76.0.0", "Simon Tatham", "PuTTY", 90},
+		{"PuTTY release 0.76 (64-bit)", "0.76.0.0", "Someone Else", "", 0},
+		{"PuTTY Portable", "0.76", "Simon Tatham", "", 0},
+		{"7-Zip 21.07 (x64)", "21.07", "Igor Pavlov", "", 0},
+		{"Notepad++ (64-bit x64)", "8.2.1", "Notepad++ Team", "Notepad++", 100},
+		{"Notepad++", "", "", "", 0},
+		{"Portable Notepad++", "8.2.1", "", "", 0},
+	})
+}
+
+func TestCatalogProductRule(t *testing.T) {
+	matcher := testCatalogMatcher(t, []catalogOverride{
+		{Catalog: "PuTTY", Strategy: strategyMinorMajorName, Compare: comparePrefix, VersionParts: 2},
+	}, 70)
+	rules := make(map[string]productRule)
+	for i := range matcher.products {
+		rules[matcher.products[i].Name] = matcher.products[i].rule()
+	}
+	if rule := rules["PuTTY"]; rule.Catalog != "PuTTY" || rule.Strategy != strategyMinorMajorName || rule.Compare != comparePrefix || rule.VersionParts != 2 {
+		t.Errorf("PuTTY: %+v", rule)
+	}
+	if rule := rules["KeePass"]; rule.Catalog != "KeePass" || rule.Strategy != strategyCatalogBranch || rule.Compare != compareEqual {
+		t.Errorf("KeePass: %+v", rule)
+	}
+	if _, found := rules["Microsoft Windows 10"]; found {
+		t.Error("Windows is a catalog product")
+	}
+}
+
+func TestCatalogOverrideInvalid(t *testing.T) {
+	for _, override := range []catalogOverride{
+		{},
+		{Catalog: "PuTTY", Exclude: []string{"("}},
+		{Catalog: "PuTTY", Publisher: "["},
+		{Catalog: "PuTTY", Strategy: "oldest"},
+		{Catalog: "PuTTY", Compare: "greater"},
+	} {
+		if err := override.compile(); err == nil {
+			t.Errorf("%+v: no error", override)
+		}
+	}
+}
+
+func TestMergeCatalogOverrides(t *testing.T) {
+	local := []catalogOverride{{Catalog: "MySQL", Disabled: true}, {Catalog: "KeePass"}}
+	embedded := []catalogOverride{{Catalog: "PHP"}, {Catalog: "MySQL", Exclude: []string{"^MySQL Workbench"}}}
+	merged := mergeCatalogOverrides(local, embedded)
+	var catalogs []string
+	for _, override := range merged {
+		catalogs = append(catalogs, override.Catalog)
+	}
+	if len(merged) != 3 || catalogs[0] != "MySQL" || catalogs[1] != "KeePass" || catalogs[2] != "PHP" || !merged[0].Disabled || merged[0].Exclude != nil {
+		t.Errorf("merged %+v", merged)
+	}
+}
@@ -0,0 +1,212 @@
+// Update Checker
+// Copyright (C) 2020-22  Florian Probst
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// catalog branches of release channels
+const (
+	channelBranchLatest = "latest" // catalog entry flagged as latest (e.g. Firefox release, LibreOffice Fresh)
+	channelBranchOlder  = "older"  // other catalog entries of the major version (e.g. Firefox ESR, LibreOffice Still)
+	// channels without branch (beta, nightly, ...) are not in the catalog
+)
+
+// releaseChannel is a release channel of a product rule (e.g. "esr" for
+// Firefox ESR)
+type releaseChannel struct {
+	Name       string `json:"name"`                 // e.g. "release", "esr" or "beta"
+	Match      string `json:"match,omitempty"`      // regexp matched against DisplayName, Uninstall key, InstallLocation and UninstallString
+	PreRelease bool   `json:"preRelease,omitempty"` // versions with a pre-release suffix (e.g. "97.0b9") belong to this channel
+	Branch     string `json:"branch,omitempty"`     // catalog branch (see channel branch constants), empty if not in the catalog
+
+	matchRegexp *regexp.Regexp
+}
+
+// compile compiles the match regexp and checks the branch of the channel
+func (channel *releaseChannel) compile() error {
+	if channel.Name == "" {
+		return fmt.Errorf("channel name is mandatory")
+	}
+	switch channel.Branch {
+	case "", channelBranchLatest, channelBranchOlder:
+	default:
+		return fmt.Errorf("channel %s: unknown branch %q", channel.Name, channel.Branch)
+	}
+	if channel.Match != "" {
+		var err error
+		channel.matchRegexp, err = regexp.Compile(channel.Match)
+		if err != nil {
+			return fmt.Errorf("channel %s: %w", channel.Name, err)
+		}
+	}
+	return nil
+}
+
+// matches checks the values of the Uninstall key that name the channel (e.g.
+// "Google Chrome Beta", "Chrome SxS" or "--chrome-beta" in the
+// UninstallString)
+func (channel releaseChannel) matches(installedComponent installedSoftwareComponent) bool {
+	if channel.matchRegexp == nil {
+		return false
+	}
+	for _, value := range []string{installedComponent.DisplayName, installedComponent.RegistryKey, installedComponent.InstallLocation, installedComponent.UninstallString} {
+		if value != "" && channel.matchRegexp.MatchString(value) {
+			return true
+		}
+	}
+	return false
+}
+
+// detectChannel returns the release channel of the installed software: the
+// first channel whose match fits the Uninstall key, else the pre-release
+// channel for versions with a pre-release suffix, else the channel of the
+// catalog branch of the installed version (versions newer than the catalog
+// belong to the latest branch)
+func (rule productRule) detectChannel(installedComponent installedSoftwareComponent, softwareReleaseStatii map[string]softwareReleaseStatus) (releaseChannel, bool) {
+	for _, channel := range rule.Channels {
+		if channel.matches(installedComponent) {
+			return channel, true
+		}
+	}
+
+	catalog := rule.catalogName(installedComponent)
+	version := installedComponent.DisplayVersion
+	if rule.VersionParts > 0 {
+		version = versionPrefix(version, rule.VersionParts)
+	}
+	installed, err := parseVersion(version)
+	if err != nil {
+		return releaseChannel{}, false
+	}
+	branch, inCatalog := catalogBranch(softwareReleaseStatii, catalog, versionPrefix(version, 2))
+
+	if installed.isPreRelease() {
+		for _, channel := range rule.Channels {
+			if channel.PreRelease {
+				return channel, true
+			}
+		}
+	}
+
+	wanted := channelBranchLatest
+	if inCatalog && !branch.Latest {
+		wanted = channelBranchOlder
+	}
+	for _, channel := range rule.Channels {
+		if channel.matchRegexp == nil && channel.Branch == wanted {
+			return channel, true
+		}
+	}
+	return releaseChannel{}, false
+}
+
+// channel returns the channel of the rule with the given name
+func (rule productRule) channel(name string) (releaseChannel, bool) {
+	for _, channel := range rule.Channels {
+		if channel.Name == name {
+			return channel, true
+		}
+	}
+	return releaseChannel{}, false
+}
+
+// evaluateChannel compares the installed version with the catalog branch of
+// its release channel. Channels that are not in the catalog are compared with
+// the newest release: a beta is up-to-date as long as it is not behind it.
+func (rule productRule) evaluateChannel(channel releaseChannel, version string, softwareReleaseStatii map[string]softwareReleaseStatus, catalog string) (softwareReleaseStatus, softwareStatus, statusReason) {
+	switch channel.Branch {
+	case channelBranchLatest:
+		latest, found := newestCatalogEntry(softwareReleaseStatii, func(statName string, statValue softwareReleaseStatus) bool {
+			return statValue.Name == catalog && statValue.Latest
+		})
+		if !found {
+			latest, found = newestCatalogEntry(softwareReleaseStatii, func(statName string, statValue softwareReleaseStatus) bool {
+				return statValue.Name == catalog
+			})
+		}
+		if !found {
+			return latest, StatusUnknown, ReasonNoCatalogEntry
+		}
+		status, reason := rule.compareWithCatalog(version, latest)
+		return latest, status, reason
+
+	case channelBranchOlder:
+		installed, err := parseVersion(version)
+		if err != nil {
+			return softwareReleaseStatus{}, StatusUnknown, ReasonVersionUnparseable
+		}
+		older := func(statName string, statValue softwareReleaseStatus) bool {
+			return statValue.Name == catalog && !statValue.Latest
+		}
+		sameMajor := func(statName string, statValue softwareReleaseStatus) bool {
+			branch, err := parseVersion(statValue.MajorRelease)
+			return older(statName, statValue) && err == nil && branch.Parts[0] == installed.Parts[0]
+		}
+		entry, found := catalogBranch(softwareReleaseStatii, catalog, versionPrefix(version, 2))
+		if !found || entry.Latest {
+			entry, found = newestCatalogEntry(softwareReleaseStatii, sameMajor)
+		}
+		if !found {
+			// e.g. an ESR that is not supported anymore
+			entry, found = newestCatalogEntry(softwareReleaseStatii, older)
+		}
+		if !found {
+			return entry, StatusUnknown, ReasonNoCatalogEntry
+		}
+		status, reason := rule.compareWithCatalog(version, entry)
+		return entry, status, reason
+	}
+
+	newest, found := newestCatalogEntry(softwareReleaseStatii, func(statName string, statValue softwareReleaseStatus) bool {
+		return statValue.Name == catalog
+	})
+	if !found {
+		return newest, StatusUnknown, ReasonNoCatalogEntry
+	}
+	installed, current, err := rule.parseVersions(version, newest)
+	if err != nil {
+		return newest, StatusUnknown, ReasonVersionUnparseable
+	}
+	// the pre-release suffix is not compared (97.0b9 is not behind 97.0)
+	switch c := (softwareVersion{Parts: installed.Parts}).compare(current); {
+	case c == 0:
+		return newest, StatusUpToDate, ReasonCurrent
+	case c > 0:
+		return newest, StatusUpToDate, ReasonNewerThanCatalog
+	default:
+		return newest, StatusOutdated, ReasonUpdateAvailable
+	}
+}
+
+// channelAllowed checks the channel against the channel policy of the
+// configuration (products without policy allow all channels)
+func channelAllowed(channelPolicy map[string][]string, product string, channel string) bool {
+	allowed, hasPolicy := channelPolicy[product]
+	if !hasPolicy || channel == "" {
+		return true
+	}
+	for _, name := range allowed {
+		if strings.EqualFold(name, channel) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,145 @@
+// Update Checker
+// Copyright (C) 2020-22  Florian Probst
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import "testing"
+
+// embeddedRule returns the embedded product rule with the given name
+func embeddedRule(t *testing.T, name string) productRule {
+	t.Helper()
+	rules, _, err := parseProductRules(embeddedRules)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, rule := range rules {
+		if rule.Name == name {
+			return rule
+		}
+	}
+	t.Fatalf("no rule %s", name)
+	return productRule{}
+}
+
+func TestDetectChannel(t *testing.T) {
+	softwareReleaseStatii, err := parseVergrabberJSON(readTestCatalog(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		rule        string
+		displayName string
+		version     string
+		uninstall   string
+		channel     string
+	}{
+		{"Mozilla Firefox", "Mozilla Firefox (x64 en-US)", "96.0.3", "", "release"},
+		{"Mozilla Firefox", "Mozilla Firefox 91.5.1 ESR (x64 en-US)", "91.5.1", "", "esr"},
+		{"Mozilla Firefox", "Firefox Developer Edition 97.0 (x64 en-US)", "97.0b9", "", "dev"},
+		{"Mozilla Firefox", "Mozilla Firefox (x64 en-US)", "97.0b9", "", "beta"},
+		// newer than the catalog, but without pre-release suffix
+		{"Mozilla Firefox", "Mozilla Firefox (x64 en-US)", "97.0", "", "release"},
+		{"Google Chrome", "Google Chrome", "97.0.4692.99", "", "release"},
+		{"Google Chrome", "Google Chrome", "98.0.4758.80", "", "release"},
+		{"Google Chrome", "Google Chrome Beta", "98.0.4758.80", "", "beta"},
+		{"Google Chrome", "Google Chrome", "98.0.4758.80", `"C:\Program Files\Google\Chrome Beta\Application\98.0.4758.80\Installer\setup.exe" --uninstall --chrome-beta`, "beta"},
+		{"Google Chrome", "Google Chrome Canary", "100.0.4867.0", "", "canary"},
+		{"LibreOffice", "LibreOffice 7.2.5.2", "7.2.5.2", "", "fresh"},
+		{"LibreOffice", "LibreOffice 7.1.8.1", "7.1.8.1", "", "still"},
+		{"LibreOffice", "LibreOffice 7.3.0.3", "7.3.0.3", "", "fresh"},
+	}
+	for _, test := range tests {
+		component := installedSoftwareComponent{
+			DisplayName:     test.displayName,
+			DisplayVersion:  test.version,
+			UninstallString: test.uninstall,
+		}
+		channel, found := embeddedRule(t, test.rule).detectChannel(component, softwareReleaseStatii)
+		if !found {
+			t.Errorf("%s %s: no channel", test.displayName, test.version)
+			continue
+		}
+		if channel.Name != test.channel {
+			t.Errorf("%s %s: channel %s, want %s", test.displayName, test.version, channel.Name, test.channel)
+		}
+	}
+}
+
+func TestChannelAllowed(t *testing.T) {
+	policy := map[string][]string{"Google Chrome": {"Release"}}
+	tests := []struct {
+		product string
+		channel string
+		allowed bool
+	}{
+		{"Google Chrome", "release", true},
+		{"Google Chrome", "beta", false},
+		{"Google Chrome", "", true},
+		{"Mozilla Firefox", "nightly", true},
+	}
+	for _, test := range tests {
+		if allowed := channelAllowed(policy, test.product, test.channel); allowed != test.allowed {
+			t.Errorf("%s %s: %t, want %t", test.product, test.channel, allowed, test.allowed)
+		}
+	}
+}
+
+func TestEvaluateChannel(t *testing.T) {
+	installedSoftware := map[string]installedSoftwareComponent{
+		"firefox":         {DisplayName: "Mozilla Firefox (x64 en-US)", DisplayVersion: "96.0.3"},
+		"firefox-old":     {DisplayName: "Mozilla Firefox (x86 en-US)", DisplayVersion: "96.0.1"},
+		"firefox-esr":     {DisplayName: "Mozilla Firefox 91.5.1 ESR (x64 en-US)", DisplayVersion: "91.5.1"},
+		"firefox-esr-old": {DisplayName: "Mozilla Firefox 91.4.0 ESR (x86 en-US)", DisplayVersion: "91.4.0"},
+		// no ESR of the major version in the catalog anymore
+		"firefox-esr-78": {DisplayName: "Mozilla Firefox 78.15.0 ESR (x86 de)", DisplayVersion: "78.15.0"},
+		"firefox-beta":   {DisplayName: "Mozilla Firefox (x64 de)", DisplayVersion: "97.0b9"},
+		"firefox-dev":    {DisplayName: "Firefox Developer Edition 95.0 (x64 en-US)", DisplayVersion: "95.0b12"},
+		"libre-fresh":    {DisplayName: "LibreOffice 7.2.5.2", DisplayVersion: "7.2.5.2"},
+		"libre-still":    {DisplayName: "LibreOffice 7.1.8.1", DisplayVersion: "7.1.8.1"},
+		"libre-still-7":  {DisplayName: "LibreOffice 7.1.7.2", DisplayVersion: "7.1.7.2"},
+	}
+	checkVerifiedSoftware(t, installedSoftware, nil, map[string]verifyTest{
+		"Mozilla Firefox (x64 en-US)":            {StatusUpToDate, ReasonCurrent, "96.0.3", ""},
+		"Mozilla Firefox (x86 en-US)":            {StatusOutdated, ReasonUpdateAvailable, "96.0.3", ""},
+		"Mozilla Firefox 91.5.1 ESR (x64 en-US)": {StatusUpToDate, ReasonCurrent, "91.5.1", ""},
+		"Mozilla Firefox 91.4.0 ESR (x86 en-US)": {StatusOutdated, ReasonUpdateAvailable, "91.5.1", ""},
+		"Mozilla Firefox 78.15.0 ESR (x86 de)":   {StatusOutdated, ReasonUpdateAvailable, "91.5.1", ""},
+		// pre-releases are compared without suffix with the newest release
+		"Mozilla Firefox (x64 de)":                   {StatusUpToDate, ReasonNewerThanCatalog, "96.0.3", ""},
+		"Firefox Developer Edition 95.0 (x64 en-US)": {StatusOutdated, ReasonUpdateAvailable, "96.0.3", ""},
+		"LibreOffice 7.2.5.2":                        {StatusUpToDate, ReasonCurrent, "7.2.5", ""},
+		"LibreOffice 7.1.8.1":                        {StatusUpToDate, ReasonCurrent, "7.1.8", ""},
+		"LibreOffice 7.1.7.2":                        {StatusOutdated, ReasonUpdateAvailable, "7.1.8", ""},
+	})
+
+	// channels rejected by the policy are outdated, whatever their version
+	policy := map[string][]string{
+		"Mozilla Firefox": {"release", "esr"},
+		"LibreOffice":     {"still"},
+	}
+	checkVerifiedSoftware(t, installedSoftware, policy, map[string]verifyTest{
+		"Mozilla Firefox (x64 en-US)":                {StatusUpToDate, ReasonCurrent, "96.0.3", ""},
+		"Mozilla Firefox (x86 en-US)":                {StatusOutdated, ReasonUpdateAvailable, "96.0.3", ""},
+		"Mozilla Firefox 91.5.1 ESR (x64 en-US)":     {StatusUpToDate, ReasonCurrent, "91.5.1", ""},
+		"Mozilla Firefox 91.4.0 ESR (x86 en-US)":     {StatusOutdated, ReasonUpdateAvailable, "91.5.1", ""},
+		"Mozilla Firefox 78.15.0 ESR (x86 de)":       {StatusOutdated, ReasonUpdateAvailable, "91.5.1", ""},
+		"Mozilla Firefox (x64 de)":                   {StatusOutdated, ReasonChannelNotAllowed, "96.0.3", "beta channel"},
+		"Firefox Developer Edition 95.0 (x64 en-US)": {StatusOutdated, ReasonChannelNotAllowed, "96.0.3", "dev channel"},
+		"LibreOffice 7.2.5.2":                        {StatusOutdated, ReasonChannelNotAllowed, "7.2.5", "fresh channel"},
+		"LibreOffice 7.1.8.1":                        {StatusUpToDate, ReasonCurrent, "7.1.8", ""},
+		"LibreOffice 7.1.7.2":                        {StatusOutdated, ReasonUpdateAvailable, "7.1.8", ""},
+	})
+}
@@ -0,0 +1,108 @@
+// Update Checker
+// Copyright (C) 2020-22  Florian Probst
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"text/tabwriter"
+)
+
+// runHeadless runs all checks without GUI, prints the results to stdout
+// (errors to stderr) and returns the exit code for the process
+func runHeadless(options scanOptions, stdout io.Writer, stderr io.Writer) int {
+	result, err := runChecks(options)
+	if err != nil {
+		Info.Println("Check failed:", err)
+		fmt.Fprintln(stderr, "Check failed:", err)
+		return ExitCheckFailed
+	}
+
+	if *reportPath != "" {
+		if err := writeJSONReportFile(*reportPath, result); err != nil {
+			Info.Println("Could not write report:", err)
+			fmt.Fprintln(stderr, "Could not write report:", err)
+			return ExitCheckFailed
+		}
+	}
+
+	switch *outputFormat {
+	case "json":
+		if result.CatalogWarning != "" {
+			fmt.Fprintln(stderr, "Warning:", result.CatalogWarning)
+		}
+		if err := writeJSONReport(stdout, result); err != nil {
+			Info.Println("Could not write report:", err)
+			return ExitCheckFailed
+		}
+	case "table":
+		if result.CatalogWarning != "" {
+			fmt.Fprintln(stdout, "Warning:", result.CatalogWarning)
+			fmt.Fprintln(stdout)
+		}
+		printResultTable(stdout, result.Mappings, *showAllRows)
+	default:
+		fmt.Fprintln(stderr, "Unknown output format:", *outputFormat)
+		return ExitCheckFailed
+	}
+
+	return exitCode(result)
+}
+
+// exitCode returns ExitOutdated if at least one software is outdated, else
+// ExitUpToDate
+func exitCode(result scanResult) int {
+	for _, entry := range result.Mappings {
+		if entry.Status == StatusOutdated {
+			return ExitOutdated
+		}
+	}
+	return ExitUpToDate
+}
+
+// printResultTable writes the results as a text table (same columns as the GUI)
+func printResultTable(w io.Writer, installedSoftwareMappings []installedSoftwareMapping, showAll bool) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "Installed Software\tStatus\tInstalled Version\tRecent Version\tRelease Date\tEnd of Life")
+	for _, entry := range installedSoftwareMappings {
+		if !entry.isVerified() && (!showAll || entry.InstalledSoftware.isHidden()) {
+			// system components and updates are not listed
+			continue
+		}
+
+		installedVersion := entry.InstalledSoftware.DisplayVersion
+		if installedVersion == "" {
+			installedVersion = "no version found"
+		}
+		recentVersion := entry.MappedStatus.Version
+		if recentVersion == "" {
+			recentVersion = "not available"
+		}
+		releaseDate := entry.MappedStatus.Released
+		if releaseDate == "" {
+			releaseDate = "not available"
+		}
+		endOfLife := entry.MappedStatus.Ends
+		if entry.EndOfLife == EndOfLifeUnknown {
+			endOfLife = "not available"
+		}
+
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", entry.Name, entry.statusText(),
+			installedVersion, recentVersion, releaseDate, endOfLife)
+	}
+	tw.Flush()
+}
@@ -0,0 +1,167 @@
+// Update Checker
+// Copyright (C) 2020-22  Florian Probst
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeTestInventory writes an inventory file with the given Windows version
+// (nil for none) and software
+func writeTestInventory(t *testing.T, windowsVersion *WindowsVersion, software map[string]installedSoftwareComponent) string {
+	t.Helper()
+	content, err := json.Marshal(inventoryFile{
+		FormatVersion:  inventoryFormatVersion,
+		WindowsVersion: windowsVersion,
+		Software:       software,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "inventory.json")
+	if err := ioutil.WriteFile(path, content, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestRunHeadlessExitCodes(t *testing.T) {
+	currentWindows := &WindowsVersion{CurrentMajorVersionNumber: 10, UBR: 1466, CurrentBuild: "19044", ReleaseID: "21H2", ProductName: "Windows 10 Pro"}
+	currentSoftware := map[string]installedSoftwareComponent{
+		"7-Zip": {DisplayName: "7-Zip 21.07 (x64)", DisplayVersion: "21.07", Publisher: "Igor Pavlov"},
+	}
+	tests := []struct {
+		name      string
+		inventory string
+		catalog   string
+		requireOS bool
+		format    string
+		want      int
+	}{
+		{"outdated", "testdata/inventory.json", "testdata/vergrabber.json", true, "table", ExitOutdated},
+		{"up-to-date", writeTestInventory(t, currentWindows, currentSoftware), "testdata/vergrabber.json", true, "table", ExitUpToDate},
+		{"json", "testdata/inventory.json", "testdata/vergrabber.json", true, "json", ExitOutdated},
+		{"no Windows version", writeTestInventory(t, nil, currentSoftware), "testdata/vergrabber.json", true, "table", ExitCheckFailed},
+		{"Windows version not required", writeTestInventory(t, nil, currentSoftware), "testdata/vergrabber.json", false, "table", ExitUpToDate},
+		{"no catalog", "testdata/inventory.json", "testdata/missing.json", true, "table", ExitCheckFailed},
+		{"unknown format", "testdata/inventory.json", "testdata/vergrabber.json", true, "xml", ExitCheckFailed},
+	}
+	defer func(format string) { *outputFormat = format }(*outputFormat)
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			*outputFormat = test.format
+			options := scanOptions{
+				Providers:   []inventoryProvider{newFileInventory(test.inventory)},
+				CatalogFile: test.catalog,
+				AsOf:        time.Date(2022, 1, 31, 0, 0, 0, 0, time.UTC),
+				Config:      defaultConfig(),
+				Offline:     true,
+				RequireOS:   test.requireOS,
+			}
+			var stdout, stderr bytes.Buffer
+			if code := runHeadless(options, &stdout, &stderr); code != test.want {
+				t.Errorf("exit code %d, want %d (stderr %q)", code, test.want, stderr.String())
+			}
+			if test.want == ExitCheckFailed {
+				if stderr.Len() == 0 {
+					t.Error("no error message on stderr")
+				}
+				return
+			}
+			if test.format == "json" {
+				var report jsonReport
+				if err := json.Unmarshal(stdout.Bytes(), &report); err != nil {
+					t.Errorf("invalid JSON report: %v", err)
+				}
+			} else if !strings.HasPrefix(stdout.String(), "Installed Software  ") {
+				t.Errorf("output %q, want the result table", stdout.String())
+			}
+		})
+	}
+}
+
+func TestPrintResultTable(t *testing.T) {
+	mappings := []installedSoftwareMapping{
+		{
+			Name:              "Google Chrome",
+			Status:            StatusOutdated,
+			Reason:            ReasonUpdateAvailable,
+			InstalledSoftware: installedSoftwareComponent{DisplayName: "Google Chrome", DisplayVersion: "97.0.4692.71"},
+			MappedStatus:      softwareReleaseStatus{Version: "97.0.4692.99", Released: "2022-01-19", Ends: "2022-03-01"},
+			EndOfLife:         EndOfLifeSupported,
+		},
+		{
+			Name:              "Notepad++",
+			Status:            StatusUpToDate,
+			Reason:            ReasonCurrent,
+			InstalledSoftware: installedSoftwareComponent{DisplayName: "Notepad++"},
+		},
+		{
+			Name:              "Some Tool",
+			Status:            StatusUnknown,
+			Reason:            ReasonNotTracked,
+			InstalledSoftware: installedSoftwareComponent{DisplayName: "Some Tool", DisplayVersion: "1.0"},
+		},
+		{
+			Name:              "Update for Some Tool",
+			Status:            StatusUnknown,
+			Reason:            ReasonNotTracked,
+			InstalledSoftware: installedSoftwareComponent{DisplayName: "Update for Some Tool", ParentKeyName: "Some Tool"},
+		},
+	}
+	want := [][]string{
+		{"Installed Software", "Status", "Installed Version", "Recent Version", "Release Date", "End of Life"},
+		{"Google Chrome", mappings[0].statusText(), "97.0.4692.71", "97.0.4692.99", "2022-01-19", "2022-03-01"},
+		{"Notepad++", mappings[1].statusText(), "no version found", "not available", "not available", "not available"},
+		{"Some Tool", mappings[2].statusText(), "1.0", "not available", "not available", "not available"},
+	}
+	for _, showAll := range []bool{false, true} {
+		var sb strings.Builder
+		printResultTable(&sb, mappings, showAll)
+		lines := strings.Split(strings.TrimSuffix(sb.String(), "\n"), "\n")
+		wantRows := want[:3]
+		if showAll {
+			// all rows except hidden components
+			wantRows = want
+		}
+		if len(lines) != len(wantRows) {
+			t.Errorf("show all %t: %d lines, want %d:\n%s", showAll, len(lines), len(wantRows), sb.String())
+			continue
+		}
+		for i, line := range lines {
+			cells := tableCellSeparator.Split(strings.TrimRight(line, " "), -1)
+			if !reflect.DeepEqual(cells, wantRows[i]) {
+				t.Errorf("show all %t, line %d: cells %q, want %q", showAll, i, cells, wantRows[i])
+			}
+			// the columns are aligned
+			if offset := strings.Index(line, wantRows[i][2]); offset != strings.Index(lines[0], "Installed Version") {
+				t.Errorf("show all %t, line %d: installed version at %d, header at %d", showAll, i, offset, strings.Index(lines[0], "Installed Version"))
+			}
+		}
+	}
+}
+
+// tableCellSeparator separates the cells of a line of the result table
+var tableCellSeparator = regexp.MustCompile(` {2,}`)
@@ -0,0 +1,183 @@
+// Update Checker
+// Copyright (C) 2020-22  Florian Probst
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"time"
+)
+
+// defaultConfigFile is read (if it exists) from the working directory
+const defaultConfigFile = "UpdateChecker.config.json"
+
+// config holds the settings from the configuration file
+type config struct {
+	Catalog   catalogConfig   `json:"catalog"`
+	EndOfLife endOfLifeConfig `json:"endOfLife"`
+	Portable  portableConfig  `json:"portable"`
+
+	FileVersions    fileVersionsConfig    `json:"fileVersions"`
+	CatalogMatching catalogMatchingConfig `json:"catalogMatching"`
+	ServerSoftware  serverSoftwareConfig  `json:"serverSoftware"`
+
+	Channels map[string][]string `json:"channels"` // allowed release channels per product rule name
+}
+
+// catalogConfig controls how vergrabber.json is fetched
+type catalogConfig struct {
+	URL        string   `json:"url"`        // vergrabber.json endpoint (e.g. an internal mirror)
+	Proxy      string   `json:"proxy"`      // proxy URL, empty means HTTP_PROXY/HTTPS_PROXY environment variables
+	Timeout    duration `json:"timeout"`    // timeout of one request, e.g. "30s"
+	Retries    int      `json:"retries"`    // additional attempts after a failed request
+	RetryDelay duration `json:"retryDelay"` // delay before the first retry, doubled for every further retry
+	CAFiles    []string `json:"caFiles"`    // PEM files with additionally trusted CA certificates
+
+	PublicKeys   []string `json:"publicKeys"`   // minisign public keys, enables signature verification
+	SignatureURL string   `json:"signatureURL"` // detached signature, default is url + ".minisig"
+	Signature    string   `json:"signature"`    // "require" (default) or "warn"
+}
+
+// endOfLifeConfig controls the end of life warnings
+type endOfLifeConfig struct {
+	WarningDays int `json:"warningDays"` // warn this many days before the end of life
+}
+
+// portableConfig controls the scan for portable software
+type portableConfig struct {
+	Directories []string `json:"directories"` // searched for executables, %VARIABLES% are expanded
+	MaxDepth    int      `json:"maxDepth"`    // levels of subdirectories searched below each directory
+}
+
+// serverSoftwareConfig controls the search for server software installations
+type serverSoftwareConfig struct {
+	Enabled     bool     `json:"enabled"`     // search the directories for server software
+	Directories []string `json:"directories"` // %VARIABLES% are expanded
+	MaxDepth    int      `json:"maxDepth"`    // levels of subdirectories searched below each directory
+}
+
+// fileVersionsConfig controls the cross-check of versions with the executables
+type fileVersionsConfig struct {
+	Enabled bool `json:"enabled"` // use the file version if it is newer than the DisplayVersion
+}
+
+// catalogMatchingConfig controls the automatic matching of installed software
+// without product rule to the catalog
+type catalogMatchingConfig struct {
+	Enabled       bool `json:"enabled"`       // match software without product rule by name
+	MinConfidence int  `json:"minConfidence"` // minimum confidence of a match in percent
+}
+
+// duration is a time.Duration that is read from strings like "30s" in JSON
+type duration time.Duration
+
+// UnmarshalJSON parses durations like "30s" or "1m30s"
+func (d *duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = duration(parsed)
+	return nil
+}
+
+// MarshalJSON writes durations like "30s"
+func (d duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// signatureLocation returns the URL of the detached signature of vergrabber.json
+func (cfg catalogConfig) signatureLocation() string {
+	if cfg.SignatureURL != "" {
+		return cfg.SignatureURL
+	}
+	return cfg.URL + signatureFileExtension
+}
+
+// defaultConfig returns the settings used if there is no configuration file
+func defaultConfig() config {
+	return config{
+		Catalog: catalogConfig{
+			URL:        vergrabberURL,
+			Timeout:    duration(30 * time.Second),
+			Retries:    2,
+			RetryDelay: duration(2 * time.Second),
+		},
+		EndOfLife: endOfLifeConfig{
+			WarningDays: 90,
+		},
+		Portable: portableConfig{
+			MaxDepth: 3,
+		},
+		CatalogMatching: catalogMatchingConfig{
+			Enabled:       false,
+			MinConfidence: 70,
+		},
+		ServerSoftware: serverSoftwareConfig{
+			Enabled:     false,
+			Directories: []string{"%SystemDrive%\\", "%ProgramFiles%", "%ProgramFiles(x86)%"},
+			MaxDepth:    3,
+		},
+	}
+}
+
+// loadConfig reads the configuration file. Settings missing in the file keep
+// their default values. If path is empty, the default configuration file is
+// used if it exists.
+func loadConfig(path string) (config, error) {
+	cfg := defaultConfig()
+
+	explicitPath := path != ""
+	if !explicitPath {
+		path = defaultConfigFile
+	}
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		if !explicitPath && errors.Is(err, os.ErrNotExist) {
+			return cfg, nil
+		}
+		return cfg, err
+	}
+	if err := json.Unmarshal(content, &cfg); err != nil {
+		return cfg, fmt.Errorf("%s: %w", path, err)
+	}
+	if cfg.Catalog.Retries < 0 {
+		return cfg, fmt.Errorf("%s: catalog.retries must not be negative", path)
+	}
+	if cfg.EndOfLife.WarningDays < 0 {
+		return cfg, fmt.Errorf("%s: endOfLife.warningDays must not be negative", path)
+	}
+	if cfg.CatalogMatching.MinConfidence < 1 || cfg.CatalogMatching.MinConfidence > 100 {
+		return cfg, fmt.Errorf("%s: catalogMatching.minConfidence must be between 1 and 100", path)
+	}
+	if cfg.ServerSoftware.MaxDepth < 0 {
+		return cfg, fmt.Errorf("%s: serverSoftware.maxDepth must not be negative", path)
+	}
+	if cfg.Portable.MaxDepth < 0 {
+		return cfg, fmt.Errorf("%s: portable.maxDepth must not be negative", path)
+	}
+	Info.Println("Using configuration file", path)
+
+	return cfg, nil
+}
@@ -0,0 +1,116 @@
+// Update Checker
+// Copyright (C) 2020-21  Florian Probst
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// endOfLifeStatus tells if the installed release is still supported
+type endOfLifeStatus int
+
+// EndOfLifeUnknown means that the catalog has no end of life date for the release
+const EndOfLifeUnknown endOfLifeStatus = 0
+
+// EndOfLifeSupported means that the release is still supported
+const EndOfLifeSupported endOfLifeStatus = 1
+
+// EndOfLifeSoon means that the support of the release ends within the warning window
+const EndOfLifeSoon endOfLifeStatus = 2
+
+// EndOfLifeReached means that the release is not supported anymore
+const EndOfLifeReached endOfLifeStatus = 3
+
+// String returns the end of life status used in the JSON report (empty if
+// the catalog has no end of life date)
+func (status endOfLifeStatus) String() string {
+	switch status {
+	case EndOfLifeSupported:
+		return "supported"
+	case EndOfLifeSoon:
+		return "ends-soon"
+	case EndOfLifeReached:
+		return "reached"
+	default:
+		return ""
+	}
+}
+
+// MarshalJSON writes the end of life status as string
+func (status endOfLifeStatus) MarshalJSON() ([]byte, error) {
+	return json.Marshal(status.String())
+}
+
+// UnmarshalJSON reads the end of life status of a JSON report
+func (status *endOfLifeStatus) UnmarshalJSON(data []byte) error {
+	var name string
+	if err := json.Unmarshal(data, &name); err != nil {
+		return err
+	}
+	for _, known := range []endOfLifeStatus{EndOfLifeUnknown, EndOfLifeSupported, EndOfLifeSoon, EndOfLifeReached} {
+		if known.String() == name {
+			*status = known
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown end of life status %q", name)
+}
+
+// checkEndOfLife returns the end of life status of a release with the given
+// "ends" date (YYYY-MM-DD) as of asOf
+func checkEndOfLife(ends string, asOf time.Time, warningDays int) endOfLifeStatus {
+	endDate, err := time.Parse("2006-01-02", ends)
+	if err != nil {
+		return EndOfLifeUnknown
+	}
+	if !endDate.After(asOf) {
+		return EndOfLifeReached
+	}
+	if !endDate.After(asOf.AddDate(0, 0, warningDays)) {
+		return EndOfLifeSoon
+	}
+	return EndOfLifeSupported
+}
+
+// applyEndOfLife sets the end of life status of the mapping from the "ends"
+// date of the mapped catalog entry. Releases at the end of life are outdated,
+// even on their latest patch.
+func applyEndOfLife(mapping *installedSoftwareMapping, asOf time.Time, warningDays int) {
+	ends := mapping.MappedStatus.Ends
+	mapping.EndOfLife = checkEndOfLife(ends, asOf, warningDays)
+
+	switch mapping.EndOfLife {
+	case EndOfLifeReached:
+		Info.Printf("%s is end of life since %s", mapping.Name, ends)
+		mapping.Status = StatusOutdated
+		mapping.Reason = ReasonEndOfLife
+		mapping.addDetail("support ended " + ends)
+	case EndOfLifeSoon:
+		Info.Printf("%s will be end of life on %s", mapping.Name, ends)
+		mapping.addDetail("end of life on " + ends)
+	}
+}
+
+// addDetail appends an information to the detail of the mapping
+func (mapping *installedSoftwareMapping) addDetail(detail string) {
+	if mapping.Detail != "" {
+		mapping.Detail += "; "
+	}
+	mapping.Detail += detail
+}
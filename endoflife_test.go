@@ -0,0 +1,113 @@
+// Update Checker
+// Copyright (C) 2020-22  Florian Probst
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestCheckEndOfLife(t *testing.T) {
+	asOf := time.Date(2022, 1, 31, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		ends string
+		want endOfLifeStatus
+		json string
+	}{
+		{"", EndOfLifeUnknown, `""`},
+		{"not available", EndOfLifeUnknown, `""`},
+		{"2023-06-13", EndOfLifeSupported, `"supported"`},
+		{"2022-02-10", EndOfLifeSoon, `"ends-soon"`},
+		{"2022-01-31", EndOfLifeReached, `"reached"`},
+		{"2020-12-31", EndOfLifeReached, `"reached"`},
+	}
+	for _, test := range tests {
+		status := checkEndOfLife(test.ends, asOf, 90)
+		if status != test.want {
+			t.Errorf("%q: %s, want %s", test.ends, status, test.want)
+		}
+		if content, err := json.Marshal(status); err != nil || string(content) != test.json {
+			t.Errorf("%q: JSON %s (%v), want %s", test.ends, content, err, test.json)
+		}
+	}
+
+	// the report omits an unknown end of life
+	content, err := json.Marshal(jsonReportEntry{EndOfLife: EndOfLifeUnknown})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var entry map[string]interface{}
+	if err := json.Unmarshal(content, &entry); err != nil {
+		t.Fatal(err)
+	}
+	if _, found := entry["endOfLife"]; found {
+		t.Errorf("unknown end of life in the report: %s", content)
+	}
+}
+
+func TestApplyEndOfLifeWindows(t *testing.T) {
+	asOf := time.Date(2022, 1, 31, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name      string
+		version   WindowsVersion
+		endOfLife endOfLifeStatus
+		status    softwareStatus
+		reason    statusReason
+		detail    string
+	}{
+		{"Windows 10 21H2", WindowsVersion{CurrentMajorVersionNumber: 10, CurrentBuild: "19044", UBR: 1526, ReleaseID: "21H2"},
+			EndOfLifeSupported, StatusUpToDate, ReasonCurrent, ""},
+		{"Enterprise 1809", WindowsVersion{CurrentMajorVersionNumber: 10, CurrentBuild: "17763", UBR: 2565, ReleaseID: "1809", EditionID: "Enterprise"},
+			EndOfLifeReached, StatusOutdated, ReasonEndOfLife, "support ended 2020-11-10"},
+		// LTSC 2019 is supported longer than 1809, whose build it shares
+		{"LTSC 2019", WindowsVersion{CurrentMajorVersionNumber: 10, CurrentBuild: "17763", UBR: 2565, ReleaseID: "1809", EditionID: "EnterpriseS"},
+			EndOfLifeUnknown, StatusUpToDate, ReasonCurrent, ""},
+		{"LTSB 2016", WindowsVersion{CurrentMajorVersionNumber: 10, CurrentBuild: "14393", UBR: 4946, ReleaseID: "1607", ProductName: "Windows 10 Enterprise 2016 LTSB"},
+			EndOfLifeUnknown, StatusUnknown, ReasonNoCatalogEntry, ""},
+		{"LTSC 2021", WindowsVersion{CurrentMajorVersionNumber: 10, CurrentBuild: "19044", UBR: 1526, ReleaseID: "21H2", EditionID: "EnterpriseS"},
+			EndOfLifeSupported, StatusUpToDate, ReasonCurrent, ""},
+		{"Server 2019", WindowsVersion{CurrentMajorVersionNumber: 10, CurrentBuild: "17763", UBR: 2565, ReleaseID: "1809", InstallationType: "Server"},
+			EndOfLifeSupported, StatusUpToDate, ReasonCurrent, ""},
+	}
+	for _, test := range tests {
+		mapping := verifyOSPatchlevel(test.version, testWindowsCatalog(), buildHistory{})
+		applyEndOfLife(&mapping, asOf, 90)
+		if mapping.EndOfLife != test.endOfLife || mapping.Status != test.status || mapping.Reason != test.reason || mapping.Detail != test.detail {
+			t.Errorf("%s: %s, %s (%s, %q), want %s, %s (%s, %q)", test.name,
+				mapping.EndOfLife, statusString(mapping.Status), mapping.Reason, mapping.Detail,
+				test.endOfLife, statusString(test.status), test.reason, test.detail)
+		}
+	}
+}
+
+func TestEndOfLifeStatusJSON(t *testing.T) {
+	for _, status := range []endOfLifeStatus{EndOfLifeUnknown, EndOfLifeSupported, EndOfLifeSoon, EndOfLifeReached} {
+		data, err := json.Marshal(status)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var read endOfLifeStatus
+		if err := json.Unmarshal(data, &read); err != nil || read != status {
+			t.Errorf("%s: read %v (%v)", data, read, err)
+		}
+	}
+	var read endOfLifeStatus
+	if err := json.Unmarshal([]byte(`"expired"`), &read); err == nil {
+		t.Error("unknown status read")
+	}
+}
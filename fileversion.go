@@ -0,0 +1,174 @@
+// Update Checker
+// Copyright (C) 2020-22  Florian Probst
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+)
+
+// VersionSourceRegistry means that the version is the DisplayVersion of the
+// Uninstall key
+const VersionSourceRegistry = "registry"
+
+// VersionSourceFile means that the version was read from the version
+// resource of the executable
+const VersionSourceFile = "file"
+
+// applyFileVersions cross-checks the DisplayVersion of the installed software
+// with the version of its executable (from DisplayIcon or InstallLocation).
+// The file version is used if the DisplayVersion is missing or unparseable,
+// or if the file is newer within the same major.minor version or in a newer
+// major version with the same number of parts (auto-updating software like
+// Chrome updates the executable, but not always the Uninstall key).
+func applyFileVersions(foundSoftware map[string]installedSoftwareComponent) {
+	for key, component := range foundSoftware {
+		if component.VersionSource != VersionSourceRegistry {
+			// portable and server software found by its executable
+			continue
+		}
+		path, info, found := componentExecutable(component)
+		if !found {
+			continue
+		}
+
+		fileVersionString := info.version()
+		fileVersion, err := parseVersion(fileVersionString)
+		if err != nil {
+			Trace.Printf("%s: unparseable file version %q of %s", component.DisplayName, fileVersionString, path)
+			continue
+		}
+		if !fileVersionPreferred(component.DisplayVersion, fileVersion) {
+			continue
+		}
+
+		Info.Printf("%s: using version %s of %s instead of DisplayVersion %q", component.DisplayName, fileVersionString, path, component.DisplayVersion)
+		component.RegistryVersion = component.DisplayVersion
+		component.DisplayVersion = fileVersionString
+		component.VersionSource = VersionSourceFile
+		component.FilePath = path
+		foundSoftware[key] = component
+	}
+}
+
+// fileVersionPreferred checks if the file version replaces the DisplayVersion.
+// Versions with a different major.minor are usually not comparable: the file
+// version may count differently ("8.5.8" for the DisplayVersion "8.58") or
+// contain a build number, so the DisplayVersion is kept. A newer major version
+// with the same number of parts ("98.0.4758.82" for "97.0.4692.71") is
+// preferred, since the executable matched on the product name and uses the
+// same scheme.
+func fileVersionPreferred(displayVersion string, fileVersion softwareVersion) bool {
+	registryVersion, err := parseVersion(displayVersion)
+	if err != nil {
+		return true
+	}
+	if fileVersion.compare(registryVersion) <= 0 {
+		return false
+	}
+	if versionPart(fileVersion, 0) == versionPart(registryVersion, 0) {
+		return versionPart(fileVersion, 1) == versionPart(registryVersion, 1)
+	}
+	return len(fileVersion.Parts) == len(registryVersion.Parts)
+}
+
+// versionPart returns the i-th numeric part of v (0 if missing)
+func versionPart(v softwareVersion, i int) uint64 {
+	if i < len(v.Parts) {
+		return v.Parts[i]
+	}
+	return 0
+}
+
+// componentExecutable returns the executable of the installed software and
+// its version resource: the DisplayIcon if it is an executable, otherwise
+// the first executable in the InstallLocation. Only executables whose
+// ProductName fits the DisplayName are used.
+func componentExecutable(component installedSoftwareComponent) (string, peVersionInfo, bool) {
+	var candidates []string
+	if icon := displayIconPath(component.DisplayIcon); strings.EqualFold(filepath.Ext(icon), ".exe") {
+		candidates = append(candidates, icon)
+	}
+	if component.InstallLocation != "" {
+		entries, err := ioutil.ReadDir(component.InstallLocation)
+		if err != nil {
+			Trace.Printf("%s: %s", component.DisplayName, err)
+		}
+		for _, entry := range entries {
+			if !entry.IsDir() && strings.EqualFold(filepath.Ext(entry.Name()), ".exe") {
+				candidates = append(candidates, filepath.Join(component.InstallLocation, entry.Name()))
+			}
+		}
+	}
+
+	for _, path := range candidates {
+		info, err := readPEVersionInfo(path)
+		if err != nil {
+			Trace.Printf("%s: %s", path, err)
+			continue
+		}
+		if productNameMatches(component.DisplayName, info.ProductName) {
+			return path, info, true
+		}
+	}
+	return "", peVersionInfo{}, false
+}
+
+// displayIconPath returns the file of a DisplayIcon value like
+// "C:\Program Files\App\app.exe",0 (without quotes and icon index)
+func displayIconPath(displayIcon string) string {
+	path := strings.TrimSpace(displayIcon)
+	if strings.HasPrefix(path, "\"") {
+		if end := strings.Index(path[1:], "\""); end >= 0 {
+			return path[1 : end+1]
+		}
+	}
+	if comma := strings.LastIndex(path, ","); comma >= 0 {
+		path = path[:comma]
+	}
+	return strings.TrimSpace(path)
+}
+
+// productNameMatches checks if the ProductName of an executable belongs to
+// the DisplayName: the DisplayName contains the ProductName ("Firefox" in
+// "Mozilla Firefox 96.0 (x64 en-US)") or the ProductName contains the first
+// two words of the DisplayName ("Java 8" in "Java Platform SE 8 U321"). One
+// word is not enough, it is often only the vendor ("Mozilla Maintenance
+// Service").
+func productNameMatches(displayName string, productName string) bool {
+	productName = strings.TrimSpace(productName)
+	if productName == "" {
+		return false
+	}
+	if strings.Contains(strings.ToLower(displayName), strings.ToLower(productName)) {
+		return true
+	}
+	displayWords, productWords := nameWords(displayName), nameWords(productName)
+	if len(displayWords) > 2 {
+		displayWords = displayWords[:2]
+	}
+	if len(displayWords) == 0 || len(displayWords[0]) <= 2 {
+		return false
+	}
+	for _, word := range displayWords {
+		if !containsString(productWords, word) {
+			return false
+		}
+	}
+	return true
+}
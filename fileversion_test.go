@@ -0,0 +1,103 @@
+// Update Checker
+// Copyright (C) 2020-22  Florian Probst
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import "testing"
+
+func TestFileVersionPreferred(t *testing.T) {
+	tests := []struct {
+		displayVersion string
+		fileVersion    string
+		preferred      bool
+	}{
+		{"", "8.1.9.0", true},
+		{"Release 0.76", "0.76.0.0", true},
+		// 4-part file version of a 3-part DisplayVersion
+		{"97.0.4692", "97.0.4692.99", true},
+		{"97.0.4692", "97.0.4692.0", false},
+		{"97.0.4692.71", "97.0.4692.99", true},
+		{"97.0.4692.99", "97.0.4692", false},
+		// auto-update without updating the Uninstall key
+		{"96.0.2", "96.0.3", true},
+		{"96.0.3", "96.0.2", false},
+		// Chrome updated to a new major version
+		{"97.0.4692.71", "98.0.4758.82", true},
+		{"97.0.4692", "98.0.4758", true},
+		{"98.0.4758.82", "97.0.4692.71", false},
+		{"97.0.4692", "98.0.4758.82", false},
+		// newer minor version of the same major version
+		{"96.0.3", "96.1.0", false},
+		// Notepad++ counts differently in the version resource
+		{"8.58", "8.5.8", false},
+		{"8.5.8", "8.58", false},
+		// build number as file version
+		{"2.1", "2110.5.0.0", false},
+		{"21.07", "21.7.0.0", false},
+		{"3", "3.0.1", true},
+	}
+	for _, test := range tests {
+		fileVersion, err := parseVersion(test.fileVersion)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if preferred := fileVersionPreferred(test.displayVersion, fileVersion); preferred != test.preferred {
+			t.Errorf("%q / %q: %t, want %t", test.displayVersion, test.fileVersion, preferred, test.preferred)
+		}
+	}
+}
+
+func TestDisplayIconPath(t *testing.T) {
+	tests := map[string]string{
+		`"C:\Program Files\App\app.exe",0`: `C:\Program Files\App\app.exe`,
+		`"C:\Program Files\App\app.exe"`:   `C:\Program Files\App\app.exe`,
+		`C:\Program Files\App\app.exe,0`:   `C:\Program Files\App\app.exe`,
+		` C:\App\app.exe `:                 `C:\App\app.exe`,
+		`C:\App\app.ico`:                   `C:\App\app.ico`,
+	}
+	for displayIcon, path := range tests {
+		if got := displayIconPath(displayIcon); got != path {
+			t.Errorf("%q: %q, want %q", displayIcon, got, path)
+		}
+	}
+}
+
+func TestProductNameMatches(t *testing.T) {
+	tests := []struct {
+		displayName string
+		productName string
+		matches     bool
+	}{
+		{"Mozilla Firefox 96.0 (x64 en-US)", "Firefox", true},
+		{"Java(TM) Platform SE 8", "Java(TM) Platform SE 8", true},
+		{"Java 8 Update 321", "Java Platform SE 8 U321", true},
+		{"Java 8 Update 321", "Java(TM) Platform SE binary", false},
+		{"KeePass", "KeePass Password Safe", true},
+		// the vendor alone is not enough
+		{"Mozilla Maintenance Service", "Firefox", false},
+		{"Mozilla Maintenance Service", "Mozilla Firefox", false},
+		{"Microsoft Edge", "Microsoft Teams", false},
+		{"Microsoft Visual C++ 2019 X64 Minimum Runtime", "Microsoft® Windows® Operating System", false},
+		{"Notepad++ (64-bit x64)", "Notepad++", true},
+		{"7-Zip 21.07 (x64)", "WinRAR archiver", false},
+		{"7-Zip 21.07 (x64)", "", false},
+	}
+	for _, test := range tests {
+		if matches := productNameMatches(test.displayName, test.productName); matches != test.matches {
+			t.Errorf("%q / %q: %t, want %t", test.displayName, test.productName, matches, test.matches)
+		}
+	}
+}
@@ -8,6 +8,7 @@ require (
 	github.com/rhysd/go-github-selfupdate v1.2.3
 	github.com/sqweek/dialog v0.0.0-20200911184034-8a3d98e8211d
 	github.com/stretchr/testify v1.6.1 // indirect
+	golang.org/x/crypto v0.0.0-20201221181555-eec23a3978ad
 	golang.org/x/sys v0.0.0-20200720211630-cb9d2d5c5666
 )
 
@@ -24,33 +24,37 @@ import (
 	"fyne.io/fyne/widget"
 )
 
-var installedColumn, statusColumn, installedVersionColumn, recentVersionColumn, recentVersionReleaseDateColumn *widget.Box
+var installedColumn, statusColumn, installedVersionColumn, recentVersionColumn, recentVersionReleaseDateColumn, endOfLifeColumn *widget.Box
+var warningLabel *widget.Label
 var a fyne.App
-var otherSoftwareText string
+var otherSoftwareText, detailsText string
 
 func outputResults(installedSoftwareMappings []installedSoftwareMapping) {
 	otherSoftwareText = ""
+	detailsText = ""
 	for _, entry := range installedSoftwareMappings {
-		if entry.Status > 1 {
+		if !entry.isVerified() && entry.InstalledSoftware.isHidden() {
+			// system components and updates are not listed
+			continue
+		}
+		detailsText += entry.Name + "\n" + indentLines(entry.InstalledSoftware.details(), "    ") + "\n"
+
+		if !entry.isVerified() {
 			// write out unknown software only to second windowInfo
 			otherSoftwareText += entry.Name
 			if entry.InstalledSoftware.DisplayVersion != "" {
 				otherSoftwareText += " (Version " + entry.InstalledSoftware.DisplayVersion + ")"
 			}
+			if entry.Reason == ReasonIgnored {
+				otherSoftwareText += " - " + entry.explanation()
+			}
 			otherSoftwareText += "\n"
 		} else {
 			// show on main window
 			installedColumn.Append(widget.NewLabel(entry.Name))
-			if entry.Status == 0 {
-				statusColumn.Append(widget.NewLabelWithStyle(
-					"Outdated",
-					fyne.TextAlignLeading,
-					fyne.TextStyle{Bold: true}))
-			} else if entry.Status == 1 {
-				statusColumn.Append(widget.NewLabelWithStyle("Up-to-date",
-					fyne.TextAlignLeading,
-					fyne.TextStyle{Bold: false}))
-			}
+			statusColumn.Append(widget.NewLabelWithStyle(entry.statusText(),
+				fyne.TextAlignLeading,
+				fyne.TextStyle{Bold: entry.Status == StatusOutdated}))
 			if entry.InstalledSoftware.DisplayVersion != "" {
 				installedVersionColumn.Append(widget.NewLabel(entry.InstalledSoftware.DisplayVersion))
 			} else {
@@ -69,10 +73,25 @@ func outputResults(installedSoftwareMappings []installedSoftwareMapping) {
 			} else {
 				recentVersionReleaseDateColumn.Append(widget.NewLabel("not available"))
 			}
+
+			if entry.EndOfLife != EndOfLifeUnknown {
+				endOfLifeColumn.Append(widget.NewLabelWithStyle(
+					entry.MappedStatus.Ends,
+					fyne.TextAlignLeading,
+					fyne.TextStyle{Bold: entry.EndOfLife >= EndOfLifeSoon}))
+			} else {
+				endOfLifeColumn.Append(widget.NewLabel("not available"))
+			}
 		}
 	}
 }
 
+// showCatalogWarning shows a warning about degraded results (e.g. outdated vergrabber.json)
+func showCatalogWarning(warning string) {
+	warningLabel.SetText("Warning: " + warning)
+	warningLabel.Show()
+}
+
 func createFyneAppWindow() fyne.Window {
 	a = app.New()
 	a.Settings().SetTheme(theme.LightTheme())
@@ -94,7 +113,11 @@ func createFyneAppWindow() fyne.Window {
 		fyne.TextAlignLeading,
 		fyne.TextStyle{Bold: true}))
 	recentVersionReleaseDateColumn = widget.NewVBox(widget.NewLabelWithStyle(
-		"Release Date",
+		"Release Date    ",
+		fyne.TextAlignLeading,
+		fyne.TextStyle{Bold: true}))
+	endOfLifeColumn = widget.NewVBox(widget.NewLabelWithStyle(
+		"End of Life",
 		fyne.TextAlignLeading,
 		fyne.TextStyle{Bold: true}))
 
@@ -104,13 +127,20 @@ func createFyneAppWindow() fyne.Window {
 		installedVersionColumn,
 		recentVersionColumn,
 		recentVersionReleaseDateColumn,
+		endOfLifeColumn,
 	)
 
+	warningLabel = widget.NewLabelWithStyle("", fyne.TextAlignLeading, fyne.TextStyle{Bold: true})
+	warningLabel.Wrapping = fyne.TextWrapWord
+	warningLabel.Hide()
+
 	top := widget.NewVBox(widget.NewButton("Quit", func() {
 		a.Quit()
 	}), widget.NewButton("Show Other Software", func() {
 		showOtherSoftware()
-	}))
+	}), widget.NewButton("Show Details", func() {
+		showTextWindow("Installation details", detailsText)
+	}), warningLabel)
 	mainContent := widget.NewScrollContainer(fyne.NewContainerWithLayout(layout.NewBorderLayout(top, nil, nil, nil),
 		top, widget.NewGroup("Results", appList)))
 
@@ -124,8 +154,13 @@ func createFyneAppWindow() fyne.Window {
 
 func showOtherSoftware() {
 	// other software window
-	otherWin := a.NewWindow("Other installed software")
-	grid := widget.NewTextGridFromString(otherSoftwareText)
+	showTextWindow("Other installed software", otherSoftwareText)
+}
+
+// showTextWindow shows the text in a new window
+func showTextWindow(title string, text string) {
+	otherWin := a.NewWindow(title)
+	grid := widget.NewTextGridFromString(text)
 	//grid.ShowLineNumbers = true
 	otherWin.SetContent(widget.NewScrollContainer(fyne.NewContainerWithLayout(
 		layout.NewBorderLayout(nil, nil, nil, nil), grid)))
@@ -0,0 +1,351 @@
+// Update Checker
+// Copyright (C) 2020-21  Florian Probst
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"unicode/utf16"
+)
+
+// binary registry hive files (regf format, e.g. Windows\System32\config\SOFTWARE
+// or NTUSER.DAT), see https://github.com/msuhanov/regf for the format
+
+const (
+	hiveBaseBlockSize   = 4096  // size of the base block, hive bins start after it
+	hiveBigDataSegment  = 16344 // maximum size of one segment of big data ("db")
+	hiveMaxListDepth    = 8     // maximum nesting of "ri" sub key lists
+	hiveKeyCompName     = 0x0020
+	hiveValueCompName   = 0x0001
+	hiveResidentDataBit = 0x80000000
+)
+
+var (
+	errHiveInvalid     = errors.New("not a registry hive file")
+	errHiveCorrupt     = errors.New("corrupt registry hive")
+	errHiveKeyNotFound = errors.New("registry key not found")
+)
+
+// hive is a binary registry hive file read into memory
+type hive struct {
+	data       []byte
+	rootOffset uint32
+}
+
+// hiveKey is a key ("nk" cell) of a hive, it implements registryValueReader
+type hiveKey struct {
+	hive *hive
+	cell []byte
+	Name string
+}
+
+// openHive reads a hive file
+func openHive(path string) (*hive, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	h, err := parseHive(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return h, nil
+}
+
+// parseHive checks the base block of a hive file
+func parseHive(data []byte) (*hive, error) {
+	if len(data) < hiveBaseBlockSize || !bytes.HasPrefix(data, []byte("regf")) {
+		return nil, errHiveInvalid
+	}
+	// primary and secondary sequence numbers differ if the hive was not
+	// written completely (changes may be missing, transaction logs are not read)
+	if binary.LittleEndian.Uint32(data[4:]) != binary.LittleEndian.Uint32(data[8:]) {
+		Info.Println("Registry hive is dirty, recent changes may be missing")
+	}
+	return &hive{data: data, rootOffset: binary.LittleEndian.Uint32(data[0x24:])}, nil
+}
+
+// cell returns the data of the cell at the given offset (relative to the
+// start of the hive bins)
+func (h *hive) cell(offset uint32) ([]byte, error) {
+	pos := int64(hiveBaseBlockSize) + int64(offset)
+	if pos+4 > int64(len(h.data)) {
+		return nil, errHiveCorrupt
+	}
+	size := int64(int32(binary.LittleEndian.Uint32(h.data[pos:])))
+	if size < 0 {
+		// allocated cells have a negative size
+		size = -size
+	}
+	if size < 4 || pos+size > int64(len(h.data)) {
+		return nil, errHiveCorrupt
+	}
+	return h.data[pos+4 : pos+size], nil
+}
+
+// key returns the key ("nk" cell) at the given offset
+func (h *hive) key(offset uint32) (*hiveKey, error) {
+	cell, err := h.cell(offset)
+	if err != nil {
+		return nil, err
+	}
+	if len(cell) < 0x4c || cell[0] != 'n' || cell[1] != 'k' {
+		return nil, errHiveCorrupt
+	}
+	nameLength := int(binary.LittleEndian.Uint16(cell[0x48:]))
+	if 0x4c+nameLength > len(cell) {
+		return nil, errHiveCorrupt
+	}
+	flags := binary.LittleEndian.Uint16(cell[0x02:])
+	name := decodeHiveName(cell[0x4c:0x4c+nameLength], flags&hiveKeyCompName != 0)
+	return &hiveKey{hive: h, cell: cell, Name: name}, nil
+}
+
+// root returns the root key of the hive
+func (h *hive) root() (*hiveKey, error) {
+	return h.key(h.rootOffset)
+}
+
+// openKey returns the key with the given path below the root key (case
+// insensitive, separated by backslashes)
+func (h *hive) openKey(path string) (*hiveKey, error) {
+	k, err := h.root()
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range strings.Split(path, "\\") {
+		if name == "" {
+			continue
+		}
+		if k, err = k.subKey(name); err != nil {
+			return nil, err
+		}
+	}
+	return k, nil
+}
+
+// subKeys returns all sub keys of the key
+func (k *hiveKey) subKeys() ([]*hiveKey, error) {
+	count := binary.LittleEndian.Uint32(k.cell[0x14:])
+	if count == 0 {
+		return nil, nil
+	}
+	offsets, err := k.hive.subKeyOffsets(binary.LittleEndian.Uint32(k.cell[0x1c:]), 0)
+	if err != nil {
+		return nil, err
+	}
+
+	subKeys := make([]*hiveKey, 0, len(offsets))
+	for _, offset := range offsets {
+		subKey, err := k.hive.key(offset)
+		if err != nil {
+			return nil, err
+		}
+		subKeys = append(subKeys, subKey)
+	}
+	return subKeys, nil
+}
+
+// subKey returns the sub key with the given name (case insensitive)
+func (k *hiveKey) subKey(name string) (*hiveKey, error) {
+	subKeys, err := k.subKeys()
+	if err != nil {
+		return nil, err
+	}
+	for _, subKey := range subKeys {
+		if strings.EqualFold(subKey.Name, name) {
+			return subKey, nil
+		}
+	}
+	return nil, errHiveKeyNotFound
+}
+
+// subKeyOffsets returns the key offsets of a sub key list ("lf", "lh", "li"
+// or the index "ri" of other lists)
+func (h *hive) subKeyOffsets(listOffset uint32, depth int) ([]uint32, error) {
+	if depth > hiveMaxListDepth {
+		return nil, errHiveCorrupt
+	}
+	cell, err := h.cell(listOffset)
+	if err != nil {
+		return nil, err
+	}
+	if len(cell) < 4 {
+		return nil, errHiveCorrupt
+	}
+	count := int(binary.LittleEndian.Uint16(cell[2:]))
+	signature := string(cell[:2])
+
+	elementSize := 4
+	if signature == "lf" || signature == "lh" {
+		// offset and hash of the name
+		elementSize = 8
+	} else if signature != "li" && signature != "ri" {
+		return nil, errHiveCorrupt
+	}
+	if 4+count*elementSize > len(cell) {
+		return nil, errHiveCorrupt
+	}
+
+	var offsets []uint32
+	for i := 0; i < count; i++ {
+		offset := binary.LittleEndian.Uint32(cell[4+i*elementSize:])
+		if signature == "ri" {
+			subOffsets, err := h.subKeyOffsets(offset, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			offsets = append(offsets, subOffsets...)
+		} else {
+			offsets = append(offsets, offset)
+		}
+	}
+	return offsets, nil
+}
+
+// value returns the value with the given name (case insensitive, "" is the
+// default value)
+func (k *hiveKey) value(name string) (regValue, error) {
+	count := int(binary.LittleEndian.Uint32(k.cell[0x24:]))
+	if count == 0 {
+		return regValue{}, errRegValueNotFound
+	}
+	list, err := k.hive.cell(binary.LittleEndian.Uint32(k.cell[0x28:]))
+	if err != nil {
+		return regValue{}, err
+	}
+	if count*4 > len(list) {
+		return regValue{}, errHiveCorrupt
+	}
+
+	for i := 0; i < count; i++ {
+		cell, err := k.hive.cell(binary.LittleEndian.Uint32(list[i*4:]))
+		if err != nil {
+			return regValue{}, err
+		}
+		if len(cell) < 0x14 || cell[0] != 'v' || cell[1] != 'k' {
+			return regValue{}, errHiveCorrupt
+		}
+		nameLength := int(binary.LittleEndian.Uint16(cell[0x02:]))
+		if 0x14+nameLength > len(cell) {
+			return regValue{}, errHiveCorrupt
+		}
+		flags := binary.LittleEndian.Uint16(cell[0x10:])
+		if !strings.EqualFold(decodeHiveName(cell[0x14:0x14+nameLength], flags&hiveValueCompName != 0), name) {
+			continue
+		}
+
+		data, err := k.hive.valueData(cell)
+		if err != nil {
+			return regValue{}, err
+		}
+		return regValue{Type: binary.LittleEndian.Uint32(cell[0x0c:]), Data: data}, nil
+	}
+	return regValue{}, errRegValueNotFound
+}
+
+// valueData returns the data of a value ("vk" cell), which is stored in the
+// cell itself (up to 4 bytes), in a data cell or in big data segments ("db")
+func (h *hive) valueData(vk []byte) ([]byte, error) {
+	size := binary.LittleEndian.Uint32(vk[0x04:])
+	if size&hiveResidentDataBit != 0 {
+		size &^= hiveResidentDataBit
+		if size > 4 {
+			return nil, errHiveCorrupt
+		}
+		return vk[0x08 : 0x08+size], nil
+	}
+
+	cell, err := h.cell(binary.LittleEndian.Uint32(vk[0x08:]))
+	if err != nil {
+		return nil, err
+	}
+	if size > hiveBigDataSegment && len(cell) >= 8 && cell[0] == 'd' && cell[1] == 'b' {
+		return h.bigData(cell, size)
+	}
+	if int(size) > len(cell) {
+		return nil, errHiveCorrupt
+	}
+	return cell[:size], nil
+}
+
+// bigData joins the segments of big data ("db" cell)
+func (h *hive) bigData(db []byte, size uint32) ([]byte, error) {
+	count := int(binary.LittleEndian.Uint16(db[2:]))
+	list, err := h.cell(binary.LittleEndian.Uint32(db[4:]))
+	if err != nil {
+		return nil, err
+	}
+	if count*4 > len(list) {
+		return nil, errHiveCorrupt
+	}
+
+	data := make([]byte, 0, size)
+	for i := 0; i < count && uint32(len(data)) < size; i++ {
+		segment, err := h.cell(binary.LittleEndian.Uint32(list[i*4:]))
+		if err != nil {
+			return nil, err
+		}
+		if len(segment) > hiveBigDataSegment {
+			segment = segment[:hiveBigDataSegment]
+		}
+		data = append(data, segment...)
+	}
+	if uint32(len(data)) < size {
+		return nil, errHiveCorrupt
+	}
+	return data[:size], nil
+}
+
+// GetStringValue returns a REG_SZ or REG_EXPAND_SZ value
+func (k *hiveKey) GetStringValue(name string) (string, uint32, error) {
+	value, err := k.value(name)
+	if err != nil {
+		return "", 0, err
+	}
+	return value.stringValue()
+}
+
+// GetIntegerValue returns a REG_DWORD or REG_QWORD value
+func (k *hiveKey) GetIntegerValue(name string) (uint64, uint32, error) {
+	value, err := k.value(name)
+	if err != nil {
+		return 0, 0, err
+	}
+	return value.integerValue()
+}
+
+// decodeHiveName decodes a key or value name, which is either stored as
+// Latin-1 (compressed) or as UTF-16LE
+func decodeHiveName(raw []byte, compressed bool) string {
+	if compressed {
+		runes := make([]rune, len(raw))
+		for i, b := range raw {
+			runes[i] = rune(b)
+		}
+		return string(runes)
+	}
+	units := make([]uint16, len(raw)/2)
+	for i := range units {
+		units[i] = binary.LittleEndian.Uint16(raw[2*i:])
+	}
+	return string(utf16.Decode(units))
+}
@@ -0,0 +1,424 @@
+// Update Checker
+// Copyright (C) 2020-22  Florian Probst
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io/ioutil"
+	"math/rand"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// testdata/hive/SOFTWARE is a small SOFTWARE hive with one hive bin. The sub
+// keys of the root are in an "lf" list, of Microsoft in an "lh" list, of
+// Wow6432Node in an "li" list and of Microsoft\Windows\CurrentVersion\Uninstall
+// in an "ri" index of an "li" and an "lh" list. The value DigitalProductId4 of
+// Microsoft\Windows NT\CurrentVersion is 20000 bytes of big data ("db").
+const testHivePath = "testdata/hive/SOFTWARE"
+
+const testHiveUninstall = "Microsoft\\Windows\\CurrentVersion\\Uninstall"
+
+// readTestHive parses a fresh copy of the test hive, which may be modified
+func readTestHive(t *testing.T) *hive {
+	t.Helper()
+	data, err := ioutil.ReadFile(testHivePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h, err := parseHive(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return h
+}
+
+// openTestHiveKey opens a key of the test hive, failing the test on errors
+func openTestHiveKey(t *testing.T, h *hive, path string) *hiveKey {
+	t.Helper()
+	k, err := h.openKey(path)
+	if err != nil {
+		t.Fatalf("%s: %s", path, err)
+	}
+	return k
+}
+
+// testHiveBigData is the content of the big data value
+func testHiveBigData() []byte {
+	data := make([]byte, 20000)
+	for i := range data {
+		data[i] = byte(i * 7 % 251)
+	}
+	return data
+}
+
+func subKeyNames(t *testing.T, k *hiveKey) []string {
+	t.Helper()
+	subKeys, err := k.subKeys()
+	if err != nil {
+		t.Fatalf("%s: %s", k.Name, err)
+	}
+	var names []string
+	for _, subKey := range subKeys {
+		names = append(names, subKey.Name)
+	}
+	return names
+}
+
+func TestHiveSubKeyLists(t *testing.T) {
+	h := readTestHive(t)
+	tests := []struct {
+		path string
+		list string
+		want []string
+	}{
+		{"", "lf", []string{"Microsoft", "Wow6432Node"}},
+		{"Microsoft", "lh", []string{"Windows NT", "Windows"}},
+		{"Wow6432Node", "li", []string{"Microsoft"}},
+		{testHiveUninstall, "ri", []string{"7-Zip", "Mozilla Firefox 96.0.3 (x64 en-US)", "Notepad++", "Müller Tool"}},
+		{"Microsoft\\Windows NT\\CurrentVersion", "", nil},
+	}
+	for _, test := range tests {
+		k := openTestHiveKey(t, h, test.path)
+		if test.list != "" {
+			list, err := h.cell(binary.LittleEndian.Uint32(k.cell[0x1c:]))
+			if err != nil || string(list[:2]) != test.list {
+				t.Errorf("%s: sub key list %q (%v), want %q", test.path, list[:2], err, test.list)
+			}
+		}
+		if names := subKeyNames(t, k); !reflect.DeepEqual(names, test.want) {
+			t.Errorf("%s: sub keys %q, want %q", test.path, names, test.want)
+		}
+	}
+
+	// case insensitive, leading and double backslashes are ignored
+	k := openTestHiveKey(t, h, "\\wow6432node\\MICROSOFT\\\\Windows\\CurrentVersion\\Uninstall\\{26A24AE4-039D-4CA4-87B4-2F32180301F0}")
+	if name, _, err := k.GetStringValue("displayname"); name != "Java 8 Update 301" || err != nil {
+		t.Errorf("DisplayName %q (%v)", name, err)
+	}
+	if _, err := h.openKey(testHiveUninstall + "\\Missing"); !errors.Is(err, errHiveKeyNotFound) {
+		t.Errorf("missing key: error %v", err)
+	}
+}
+
+func TestHiveValues(t *testing.T) {
+	h := readTestHive(t)
+
+	version := openTestHiveKey(t, h, "Microsoft\\Windows NT\\CurrentVersion")
+	if ubr, valueType, err := version.GetIntegerValue("UBR"); ubr != 1466 || valueType != regDWord || err != nil {
+		t.Errorf("UBR %d (type %d, %v)", ubr, valueType, err)
+	}
+	big, err := version.value("DigitalProductId4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if big.Type != regBinary || !bytes.Equal(big.Data, testHiveBigData()) {
+		t.Errorf("big data: type %d, %d bytes", big.Type, len(big.Data))
+	}
+	if _, err := version.value("Missing"); !errors.Is(err, errRegValueNotFound) {
+		t.Errorf("missing value: error %v", err)
+	}
+
+	firefox := openTestHiveKey(t, h, testHiveUninstall+"\\Mozilla Firefox 96.0.3 (x64 en-US)")
+	if icon, valueType, err := firefox.GetStringValue("DisplayIcon"); icon != `%ProgramFiles%\Mozilla Firefox\firefox.exe,0` || valueType != regExpandSZ || err != nil {
+		t.Errorf("DisplayIcon %q (type %d, %v)", icon, valueType, err)
+	}
+	if installTime, valueType, err := firefox.GetIntegerValue("InstallTime"); installTime != 0x019db1ded53e8000 || valueType != regQWord || err != nil {
+		t.Errorf("InstallTime %#x (type %d, %v)", installTime, valueType, err)
+	}
+
+	notepad := openTestHiveKey(t, h, testHiveUninstall+"\\Notepad++")
+	if value, _, err := notepad.GetStringValue(""); value != "default" || err != nil {
+		t.Errorf("default value %q (%v)", value, err)
+	}
+	// key name stored as UTF-16
+	tool := openTestHiveKey(t, h, testHiveUninstall+"\\müller tool")
+	if name, _, err := tool.GetStringValue("DisplayName"); name != "Müller Tool" || err != nil {
+		t.Errorf("DisplayName %q (%v)", name, err)
+	}
+}
+
+// testValueCell returns the "vk" cell of the value, its bytes are part of the
+// hive data
+func testValueCell(t *testing.T, k *hiveKey, name string) []byte {
+	t.Helper()
+	list, err := k.hive.cell(binary.LittleEndian.Uint32(k.cell[0x28:]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < int(binary.LittleEndian.Uint32(k.cell[0x24:])); i++ {
+		cell, err := k.hive.cell(binary.LittleEndian.Uint32(list[i*4:]))
+		if err != nil {
+			t.Fatal(err)
+		}
+		nameLength := int(binary.LittleEndian.Uint16(cell[0x02:]))
+		if string(cell[0x14:0x14+nameLength]) == name {
+			return cell
+		}
+	}
+	t.Fatalf("value %s not found", name)
+	return nil
+}
+
+func TestHiveCorrupt(t *testing.T) {
+	const outOfRange = 0x7ffffff0
+	putUint32 := binary.LittleEndian.PutUint32
+	tests := []struct {
+		name    string
+		corrupt func(t *testing.T, h *hive) // modifies the hive
+		read    func(h *hive) error         // returns the error of the read access
+	}{
+		{
+			"root key offset out of range",
+			func(t *testing.T, h *hive) { h.rootOffset = outOfRange },
+			func(h *hive) error { _, err := h.root(); return err },
+		},
+		{
+			"root key is no key",
+			func(t *testing.T, h *hive) { h.rootOffset = 0x20 }, // first cell of the hive bin, value data
+			func(h *hive) error { _, err := h.root(); return err },
+		},
+		{
+			"sub key list offset out of range",
+			func(t *testing.T, h *hive) {
+				putUint32(openTestHiveKey(t, h, testHiveUninstall).cell[0x1c:], outOfRange)
+			},
+			func(h *hive) error { _, err := h.openKey(testHiveUninstall + "\\7-Zip"); return err },
+		},
+		{
+			"unknown sub key list",
+			func(t *testing.T, h *hive) {
+				k := openTestHiveKey(t, h, "Microsoft")
+				list, _ := h.cell(binary.LittleEndian.Uint32(k.cell[0x1c:]))
+				copy(list, "xx")
+			},
+			func(h *hive) error { _, err := h.openKey("Microsoft\\Windows"); return err },
+		},
+		{
+			"sub key list count beyond the cell",
+			func(t *testing.T, h *hive) {
+				k := openTestHiveKey(t, h, "Microsoft")
+				list, _ := h.cell(binary.LittleEndian.Uint32(k.cell[0x1c:]))
+				binary.LittleEndian.PutUint16(list[2:], 0xffff)
+			},
+			func(h *hive) error { _, err := h.openKey("Microsoft\\Windows"); return err },
+		},
+		{
+			"ri index referencing itself",
+			func(t *testing.T, h *hive) {
+				k := openTestHiveKey(t, h, testHiveUninstall)
+				listOffset := binary.LittleEndian.Uint32(k.cell[0x1c:])
+				list, _ := h.cell(listOffset)
+				putUint32(list[4:], listOffset)
+			},
+			func(h *hive) error { _, err := h.openKey(testHiveUninstall + "\\7-Zip"); return err },
+		},
+		{
+			"sub key offset out of range",
+			func(t *testing.T, h *hive) {
+				k := openTestHiveKey(t, h, "Wow6432Node")
+				list, _ := h.cell(binary.LittleEndian.Uint32(k.cell[0x1c:]))
+				putUint32(list[4:], outOfRange)
+			},
+			func(h *hive) error { _, err := h.openKey("Wow6432Node\\Microsoft"); return err },
+		},
+		{
+			"key name beyond the cell",
+			func(t *testing.T, h *hive) {
+				binary.LittleEndian.PutUint16(openTestHiveKey(t, h, "Wow6432Node").cell[0x48:], 0x1000)
+			},
+			func(h *hive) error { _, err := h.openKey("Wow6432Node"); return err },
+		},
+		{
+			"value list offset out of range",
+			func(t *testing.T, h *hive) {
+				putUint32(openTestHiveKey(t, h, testHiveUninstall+"\\7-Zip").cell[0x28:], outOfRange)
+			},
+			func(h *hive) error {
+				k, _ := h.openKey(testHiveUninstall + "\\7-Zip")
+				_, _, err := k.GetStringValue("DisplayName")
+				return err
+			},
+		},
+		{
+			"value count beyond the list",
+			func(t *testing.T, h *hive) {
+				putUint32(openTestHiveKey(t, h, testHiveUninstall+"\\7-Zip").cell[0x24:], 0xffffffff)
+			},
+			func(h *hive) error {
+				k, _ := h.openKey(testHiveUninstall + "\\7-Zip")
+				_, _, err := k.GetStringValue("DisplayName")
+				return err
+			},
+		},
+		{
+			"value data offset out of range",
+			func(t *testing.T, h *hive) {
+				putUint32(testValueCell(t, openTestHiveKey(t, h, testHiveUninstall+"\\7-Zip"), "DisplayName")[0x08:], outOfRange)
+			},
+			func(h *hive) error {
+				k, _ := h.openKey(testHiveUninstall + "\\7-Zip")
+				_, _, err := k.GetStringValue("DisplayName")
+				return err
+			},
+		},
+		{
+			"value data size beyond the cell",
+			func(t *testing.T, h *hive) {
+				putUint32(testValueCell(t, openTestHiveKey(t, h, testHiveUninstall+"\\7-Zip"), "DisplayName")[0x04:], 0x1000)
+			},
+			func(h *hive) error {
+				k, _ := h.openKey(testHiveUninstall + "\\7-Zip")
+				_, _, err := k.GetStringValue("DisplayName")
+				return err
+			},
+		},
+		{
+			"resident data larger than 4 bytes",
+			func(t *testing.T, h *hive) {
+				putUint32(testValueCell(t, openTestHiveKey(t, h, testHiveUninstall+"\\7-Zip"), "EstimatedSize")[0x04:], hiveResidentDataBit|8)
+			},
+			func(h *hive) error {
+				k, _ := h.openKey(testHiveUninstall + "\\7-Zip")
+				_, _, err := k.GetIntegerValue("EstimatedSize")
+				return err
+			},
+		},
+		{
+			"big data segment list out of range",
+			func(t *testing.T, h *hive) {
+				vk := testValueCell(t, openTestHiveKey(t, h, "Microsoft\\Windows NT\\CurrentVersion"), "DigitalProductId4")
+				db, _ := h.cell(binary.LittleEndian.Uint32(vk[0x08:]))
+				putUint32(db[4:], outOfRange)
+			},
+			func(h *hive) error {
+				k, _ := h.openKey("Microsoft\\Windows NT\\CurrentVersion")
+				_, err := k.value("DigitalProductId4")
+				return err
+			},
+		},
+		{
+			"big data larger than its segments",
+			func(t *testing.T, h *hive) {
+				vk := testValueCell(t, openTestHiveKey(t, h, "Microsoft\\Windows NT\\CurrentVersion"), "DigitalProductId4")
+				putUint32(vk[0x04:], 3*hiveBigDataSegment)
+			},
+			func(h *hive) error {
+				k, _ := h.openKey("Microsoft\\Windows NT\\CurrentVersion")
+				_, err := k.value("DigitalProductId4")
+				return err
+			},
+		},
+		{
+			"big data segment count beyond the list",
+			func(t *testing.T, h *hive) {
+				vk := testValueCell(t, openTestHiveKey(t, h, "Microsoft\\Windows NT\\CurrentVersion"), "DigitalProductId4")
+				db, _ := h.cell(binary.LittleEndian.Uint32(vk[0x08:]))
+				binary.LittleEndian.PutUint16(db[2:], 0xffff)
+			},
+			func(h *hive) error {
+				k, _ := h.openKey("Microsoft\\Windows NT\\CurrentVersion")
+				_, err := k.value("DigitalProductId4")
+				return err
+			},
+		},
+		{
+			"cell size beyond the file",
+			func(t *testing.T, h *hive) {
+				k := openTestHiveKey(t, h, "Wow6432Node")
+				list, _ := h.cell(binary.LittleEndian.Uint32(k.cell[0x1c:]))
+				offset := binary.LittleEndian.Uint32(list[4:])
+				putUint32(h.data[hiveBaseBlockSize+offset:], uint32(len(h.data)))
+			},
+			func(h *hive) error { _, err := h.openKey("Wow6432Node\\Microsoft"); return err },
+		},
+	}
+	for _, test := range tests {
+		h := readTestHive(t)
+		test.corrupt(t, h)
+		if err := test.read(h); !errors.Is(err, errHiveCorrupt) {
+			t.Errorf("%s: error %v, want errHiveCorrupt", test.name, err)
+		}
+	}
+}
+
+// walkTestHive reads all keys and the values of the test hive, it must not
+// panic on corrupt data
+func walkTestHive(h *hive) {
+	var walk func(k *hiveKey, depth int)
+	walk = func(k *hiveKey, depth int) {
+		for _, name := range []string{"", "DisplayName", "DisplayVersion", "DisplayIcon", "EstimatedSize", "InstallTime", "UBR", "DigitalProductId4"} {
+			k.GetStringValue(name)
+			k.GetIntegerValue(name)
+		}
+		subKeys, err := k.subKeys()
+		if err != nil || depth > 8 {
+			return
+		}
+		for _, subKey := range subKeys {
+			walk(subKey, depth+1)
+		}
+	}
+	if root, err := h.root(); err == nil {
+		walk(root, 0)
+	}
+}
+
+func TestHiveTruncated(t *testing.T) {
+	data, err := ioutil.ReadFile(testHivePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for length := 0; length < len(data); length += 97 {
+		h, err := parseHive(data[:length])
+		if length < hiveBaseBlockSize {
+			if !errors.Is(err, errHiveInvalid) {
+				t.Errorf("%d bytes: error %v, want errHiveInvalid", length, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%d bytes: %s", length, err)
+		}
+		walkTestHive(h)
+	}
+	if _, err := parseHive([]byte(strings.Repeat("x", hiveBaseBlockSize))); !errors.Is(err, errHiveInvalid) {
+		t.Errorf("no hive: error %v, want errHiveInvalid", err)
+	}
+}
+
+func TestHiveRandomCorruption(t *testing.T) {
+	data, err := ioutil.ReadFile(testHivePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	random := rand.New(rand.NewSource(1))
+	for i := 0; i < 2000; i++ {
+		corrupt := append([]byte{}, data...)
+		for j := 0; j < 8; j++ {
+			corrupt[hiveBaseBlockSize+random.Intn(len(corrupt)-hiveBaseBlockSize)] = byte(random.Intn(256))
+		}
+		h, err := parseHive(corrupt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		walkTestHive(h)
+	}
+}
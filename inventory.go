@@ -0,0 +1,175 @@
+// Update Checker
+// Copyright (C) 2020-22  Florian Probst
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// inventoryProvider is a source of installed software (e.g. the local registry)
+type inventoryProvider interface {
+	// Name returns a short name of the source, used for logging and to
+	// disambiguate conflicting keys
+	Name() string
+	// InstalledSoftware returns the installed software, keyed by an identifier
+	// that is unique within this source (e.g. the Uninstall sub key name)
+	InstalledSoftware() (map[string]installedSoftwareComponent, error)
+}
+
+// windowsVersionProvider is implemented by inventory providers that also know
+// the Windows version of the inventoried system
+type windowsVersionProvider interface {
+	WindowsVersion() (WindowsVersion, error)
+}
+
+// inventoryProviders are the default sources of installed software, filled in
+// by registerInventoryProvider
+var inventoryProviders []inventoryProvider
+
+// registerInventoryProvider adds a default source of installed software
+func registerInventoryProvider(provider inventoryProvider) {
+	inventoryProviders = append(inventoryProviders, provider)
+}
+
+// inventoryIdentity identifies an installation across inventory providers,
+// which report it with different registry keys or file paths
+type inventoryIdentity struct {
+	DisplayName, DisplayVersion string
+}
+
+// identity returns the normalized identity of the installed software
+func (component installedSoftwareComponent) identity() inventoryIdentity {
+	return inventoryIdentity{
+		DisplayName:    strings.ToLower(strings.Join(strings.Fields(component.DisplayName), " ")),
+		DisplayVersion: strings.TrimSpace(component.DisplayVersion),
+	}
+}
+
+// inventoryOrigin is a provider that reported an installation
+type inventoryOrigin struct {
+	provider  string
+	component installedSoftwareComponent
+}
+
+// matches checks if the component can be the installation reported by the
+// origin. Portable and server software have no scope and often no
+// architecture, an empty value matches every value unless the registry keys
+// or file paths of both tell the installations apart (e.g. the native and
+// the Wow6432Node Uninstall key given as separate registry exports, where
+// the native key has no architecture).
+func (origin inventoryOrigin) matches(component installedSoftwareComponent) bool {
+	reported := origin.component
+	if reported.Architecture == component.Architecture && reported.Scope == component.Scope {
+		return true
+	}
+	if reported.RegistryKey != "" && component.RegistryKey != "" &&
+		normalizeRegistryKey(reported.RegistryKey) != normalizeRegistryKey(component.RegistryKey) {
+		return false
+	}
+	if reported.FilePath != "" && component.FilePath != "" && !strings.EqualFold(reported.FilePath, component.FilePath) {
+		return false
+	}
+	return (reported.Architecture == "" || component.Architecture == "" || reported.Architecture == component.Architecture) &&
+		(reported.Scope == "" || component.Scope == "" || reported.Scope == component.Scope)
+}
+
+// registryRootAbbreviations replaces the root keys by their abbreviations
+var registryRootAbbreviations = strings.NewReplacer("hkey_local_machine\\", "hklm\\", "hkey_current_user\\", "hkcu\\", "hkey_users\\", "hku\\")
+
+// normalizeRegistryKey returns the lower case registry key path with
+// abbreviated root key, so that keys written differently can be compared
+func normalizeRegistryKey(path string) string {
+	return registryRootAbbreviations.Replace(strings.ToLower(strings.TrimSpace(path)))
+}
+
+// collectInventory reads the installed software from all providers and merges
+// it into one map. Software that is reported by more than one provider (same
+// DisplayName and DisplayVersion, same or unknown architecture and scope, see
+// inventoryOrigin.matches) is only added once, conflicting keys get the provider name as prefix (and a
+// number, if that is taken too).
+func collectInventory(providers []inventoryProvider) (map[string]installedSoftwareComponent, error) {
+	if len(providers) == 0 {
+		return nil, errors.New("No inventory source available")
+	}
+
+	foundSoftware := make(map[string]installedSoftwareComponent)
+	seenBy := make(map[inventoryIdentity][]inventoryOrigin)
+
+	for _, provider := range providers {
+		software, err := provider.InstalledSoftware()
+		if err != nil {
+			return nil, fmt.Errorf("Inventory source %s failed: %w", provider.Name(), err)
+		}
+		Info.Printf("Inventory source %s: %d entries", provider.Name(), len(software))
+
+		for key, component := range software {
+			identity := component.identity()
+			if seenByProvider := reportedBy(seenBy[identity], provider.Name(), component); seenByProvider != "" {
+				Trace.Printf("%s: %s already reported by %s", provider.Name(), component.DisplayName, seenByProvider)
+				continue
+			}
+			seenBy[identity] = append(seenBy[identity], inventoryOrigin{provider.Name(), component})
+
+			if _, exists := foundSoftware[key]; exists {
+				key = provider.Name() + ":" + key
+				for i, prefixed := 2, key; ; i++ {
+					if _, exists := foundSoftware[key]; !exists {
+						break
+					}
+					key = prefixed + "#" + strconv.Itoa(i)
+				}
+			}
+			foundSoftware[key] = component
+		}
+	}
+
+	return foundSoftware, nil
+}
+
+// reportedBy returns the name of another provider that already reported the
+// component, or an empty string. Entries of the same provider are separate
+// installations.
+func reportedBy(origins []inventoryOrigin, providerName string, component installedSoftwareComponent) string {
+	for _, origin := range origins {
+		if origin.provider != providerName && origin.matches(component) {
+			return origin.provider
+		}
+	}
+	return ""
+}
+
+// inventoryWindowsVersion returns the Windows version from the first provider
+// that knows it. If no provider can read it, the result and error of the last
+// one are returned (partial version information, if any).
+func inventoryWindowsVersion(providers []inventoryProvider) (WindowsVersion, error) {
+	windowsVersion, err := WindowsVersion{}, errors.New("No inventory source provides the Windows version")
+	for _, provider := range providers {
+		versionProvider, ok := provider.(windowsVersionProvider)
+		if !ok {
+			continue
+		}
+		windowsVersion, err = versionProvider.WindowsVersion()
+		if err == nil {
+			return windowsVersion, nil
+		}
+		Info.Printf("Inventory source %s: %s", provider.Name(), err)
+	}
+	return windowsVersion, err
+}
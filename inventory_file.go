@@ -0,0 +1,125 @@
+// Update Checker
+// Copyright (C) 2020-22  Florian Probst
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"time"
+)
+
+// inventoryFormatVersion has to be increased on incompatible changes of the
+// inventory file format
+const inventoryFormatVersion = 1
+
+// inventoryFile is the format of exported inventories (-export-inventory),
+// which can be evaluated offline on another machine (-inventory)
+type inventoryFile struct {
+	FormatVersion  int                                   `json:"formatVersion"`
+	Host           string                                `json:"host"`
+	Created        time.Time                             `json:"created"`
+	WindowsVersion *WindowsVersion                       `json:"windowsVersion,omitempty"`
+	Software       map[string]installedSoftwareComponent `json:"software"`
+}
+
+// fileInventory is the inventory provider for an exported inventory file
+type fileInventory struct {
+	path string
+	file *inventoryFile
+}
+
+// newFileInventory returns an inventory provider for the given inventory file
+func newFileInventory(path string) *fileInventory {
+	return &fileInventory{path: path}
+}
+
+// Name returns the name of the inventory source
+func (f *fileInventory) Name() string {
+	return "file:" + f.path
+}
+
+// InstalledSoftware returns the installed software from the inventory file
+func (f *fileInventory) InstalledSoftware() (map[string]installedSoftwareComponent, error) {
+	if err := f.load(); err != nil {
+		return nil, err
+	}
+	return f.file.Software, nil
+}
+
+// WindowsVersion returns the Windows version from the inventory file
+func (f *fileInventory) WindowsVersion() (WindowsVersion, error) {
+	if err := f.load(); err != nil {
+		return WindowsVersion{}, err
+	}
+	if f.file.WindowsVersion == nil {
+		return WindowsVersion{}, errors.New("Inventory file " + f.path + " contains no Windows version")
+	}
+	return *f.file.WindowsVersion, nil
+}
+
+// load reads the inventory file (only once)
+func (f *fileInventory) load() error {
+	if f.file != nil {
+		return nil
+	}
+
+	content, err := ioutil.ReadFile(f.path)
+	if err != nil {
+		return err
+	}
+	var file inventoryFile
+	if err := json.Unmarshal(content, &file); err != nil {
+		return fmt.Errorf("Could not parse inventory file %s: %w", f.path, err)
+	}
+	if file.FormatVersion != inventoryFormatVersion {
+		return fmt.Errorf("Inventory file %s has unsupported format version %d", f.path, file.FormatVersion)
+	}
+
+	f.file = &file
+	return nil
+}
+
+// writeInventoryFile exports the inventory of the given providers to a file
+func writeInventoryFile(path string, providers []inventoryProvider) error {
+	software, err := collectInventory(providers)
+	if err != nil {
+		return err
+	}
+
+	file := inventoryFile{
+		FormatVersion: inventoryFormatVersion,
+		Created:       time.Now(),
+		Software:      software,
+	}
+	file.Host, _ = os.Hostname()
+	windowsVersion, err := inventoryWindowsVersion(providers)
+	if err == nil || windowsVersion.ProductName != "" {
+		// partial version information is still useful for the evaluation
+		file.WindowsVersion = &windowsVersion
+	} else {
+		Info.Println("Exporting inventory without Windows version:", err)
+	}
+
+	content, err := json.MarshalIndent(file, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, content, 0644)
+}
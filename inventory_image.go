@@ -0,0 +1,206 @@
+// Update Checker
+// Copyright (C) 2020-21  Florian Probst
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// imageInventory is the inventory provider for the registry hives of an
+// offline Windows installation (a mounted disk or a forensic image directory)
+type imageInventory struct {
+	root         string
+	softwareHive *hive
+}
+
+// newImageInventory returns an inventory provider for the Windows
+// installation in the given directory
+func newImageInventory(root string) *imageInventory {
+	return &imageInventory{root: root}
+}
+
+// Name returns the name of the inventory source
+func (img *imageInventory) Name() string {
+	return "image:" + img.root
+}
+
+// InstalledSoftware reads the Uninstall keys from the SOFTWARE hive (64-bit
+// and Wow6432Node) and from the NTUSER.DAT hives of all user profiles
+func (img *imageInventory) InstalledSoftware() (map[string]installedSoftwareComponent, error) {
+	if err := img.load(); err != nil {
+		return nil, err
+	}
+
+	foundSoftware := make(map[string]installedSoftwareComponent)
+
+	// the native Uninstall key holds 64-bit software if there is a Wow6432Node
+	nativeArchitecture := ""
+	if _, err := img.softwareHive.openKey("Wow6432Node"); err == nil {
+		nativeArchitecture = ArchitectureX64
+	}
+	err := addHiveUninstallKeys(foundSoftware, img.softwareHive, "HKLM\\SOFTWARE",
+		strings.TrimPrefix(uninstallKeyPath, "SOFTWARE\\"), ScopeMachine, nativeArchitecture)
+	if err != nil {
+		return nil, err
+	}
+	err = addHiveUninstallKeys(foundSoftware, img.softwareHive, "HKLM\\SOFTWARE",
+		strings.TrimPrefix(uninstallKeyPathWow64, "SOFTWARE\\"), ScopeMachine, ArchitectureX86)
+	if err != nil {
+		return nil, err
+	}
+
+	for user, path := range img.userHivePaths() {
+		userHive, err := openHive(path)
+		if err != nil {
+			// a broken user profile should not prevent the scan of the others
+			Info.Printf("Could not read registry hive of user %s: %s", user, err)
+			continue
+		}
+		if err := addHiveUninstallKeys(foundSoftware, userHive, "HKU\\"+user, uninstallKeyPath, ScopeUser, ""); err != nil {
+			Info.Printf("Could not read installed software of user %s: %s", user, err)
+		}
+	}
+
+	return foundSoftware, nil
+}
+
+// WindowsVersion reads the Windows version from the SOFTWARE hive
+func (img *imageInventory) WindowsVersion() (WindowsVersion, error) {
+	if err := img.load(); err != nil {
+		return WindowsVersion{}, err
+	}
+	k, err := img.softwareHive.openKey(strings.TrimPrefix(windowsVersionKeyPath, "SOFTWARE\\"))
+	if err != nil {
+		return WindowsVersion{}, fmt.Errorf("Could not get version information from registry hive: %w", err)
+	}
+	return readWindowsVersion(k)
+}
+
+// load reads the SOFTWARE hive (only once)
+func (img *imageInventory) load() error {
+	if img.softwareHive != nil {
+		return nil
+	}
+
+	// Windows\System32\config\SOFTWARE of a mounted disk, or only the hive
+	// files copied into one directory
+	path, found := findFileFold(img.root, "Windows", "System32", "config", "SOFTWARE")
+	if !found {
+		path, found = findFileFold(img.root, "SOFTWARE")
+	}
+	if !found {
+		return errors.New("No SOFTWARE registry hive found in " + img.root)
+	}
+	Info.Println("Reading registry hive", path)
+
+	softwareHive, err := openHive(path)
+	if err != nil {
+		return err
+	}
+	img.softwareHive = softwareHive
+	return nil
+}
+
+// userHivePaths returns the NTUSER.DAT files of all user profiles, keyed by
+// the profile directory name
+func (img *imageInventory) userHivePaths() map[string]string {
+	paths := make(map[string]string)
+	usersDir, found := findFileFold(img.root, "Users")
+	if !found {
+		return paths
+	}
+	profiles, err := ioutil.ReadDir(usersDir)
+	if err != nil {
+		Info.Printf("Could not read user profiles in %s: %s", usersDir, err)
+		return paths
+	}
+	for _, profile := range profiles {
+		if !profile.IsDir() {
+			continue
+		}
+		if path, found := findFileFold(filepath.Join(usersDir, profile.Name()), "NTUSER.DAT"); found {
+			paths[profile.Name()] = path
+		}
+	}
+	return paths
+}
+
+// addHiveUninstallKeys adds the software of all sub keys of the Uninstall key
+// at keyPath in the hive (a missing Uninstall key is no error)
+func addHiveUninstallKeys(foundSoftware map[string]installedSoftwareComponent, h *hive, hiveName string, keyPath string, scope string, architecture string) error {
+	k, err := h.openKey(keyPath)
+	if errors.Is(err, errHiveKeyNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	subKeys, err := k.subKeys()
+	if err != nil {
+		return err
+	}
+
+	for _, subKey := range subKeys {
+		registryKey := hiveName + "\\" + keyPath + "\\" + subKey.Name
+		component := uninstallComponent(registryKey, subKey.Name, subKey)
+		component.Scope = scope
+		component.Architecture = architecture
+
+		key := subKey.Name
+		if _, exists := foundSoftware[key]; exists {
+			// same sub key in another hive or in Wow6432Node
+			key = registryKey
+		}
+		foundSoftware[key] = component
+	}
+	return nil
+}
+
+// findFileFold returns the path of dir/elements..., matching every element
+// case insensitively (images of NTFS volumes are mounted case sensitive)
+func findFileFold(dir string, elements ...string) (string, bool) {
+	path := dir
+	for _, element := range elements {
+		entries, err := ioutil.ReadDir(path)
+		if err != nil {
+			return "", false
+		}
+		next := ""
+		for _, entry := range entries {
+			if entry.Name() == element {
+				next = entry.Name()
+				break
+			}
+			if next == "" && strings.EqualFold(entry.Name(), element) {
+				next = entry.Name()
+			}
+		}
+		if next == "" {
+			return "", false
+		}
+		path = filepath.Join(path, next)
+	}
+	if _, err := os.Stat(path); err != nil {
+		return "", false
+	}
+	return path, true
+}
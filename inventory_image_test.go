@@ -0,0 +1,73 @@
+// Update Checker
+// Copyright (C) 2020-22  Florian Probst
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// testHiveSoftware is the software in the Uninstall keys of the test hive
+var testHiveSoftware = map[string]testPlacement{
+	"7-Zip":                                  {"7-Zip 21.07 (x64)", ScopeMachine, ArchitectureX64},
+	"Mozilla Firefox 96.0.3 (x64 en-US)":     {"Mozilla Firefox (x64 en-US)", ScopeMachine, ArchitectureX64},
+	"Notepad++":                              {"Notepad++ (64-bit x64)", ScopeMachine, ArchitectureX64},
+	"Müller Tool":                            {"Müller Tool", ScopeMachine, ArchitectureX64},
+	"{26A24AE4-039D-4CA4-87B4-2F32180301F0}": {"Java 8 Update 301", ScopeMachine, ArchitectureX86},
+}
+
+func TestImageInventory(t *testing.T) {
+	// only the hive files copied into one directory
+	inventory := newImageInventory("testdata/hive")
+	if inventory.Name() != "image:testdata/hive" {
+		t.Errorf("name %q", inventory.Name())
+	}
+	checkInstalledSoftware(t, inventory, testHiveSoftware)
+
+	version, err := inventory.WindowsVersion()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version.CurrentBuild != "19044" || version.UBR != 1466 || version.ReleaseID != "21H2" {
+		t.Errorf("Windows version %+v", version)
+	}
+}
+
+func TestImageInventoryMountedDisk(t *testing.T) {
+	root := t.TempDir()
+	writeTestFiles(t, root, map[string]string{
+		// the case of the path differs on images mounted case sensitive
+		"windows/system32/CONFIG/software": testHivePath,
+		// a broken profile does not prevent the scan
+		"Users/alice/NTUSER.DAT": "no registry hive",
+		// a hive without Uninstall key adds no software
+		"Users/bob/ntuser.dat": testHivePath,
+	})
+	checkInstalledSoftware(t, newImageInventory(root), testHiveSoftware)
+}
+
+func TestImageInventoryWithoutHive(t *testing.T) {
+	root := t.TempDir()
+	writeTestFiles(t, root, map[string]string{"Windows/System32/config/SYSTEM": ""})
+	inventory := newImageInventory(root)
+	if _, err := inventory.InstalledSoftware(); err == nil || !strings.HasPrefix(err.Error(), "No SOFTWARE registry hive found") {
+		t.Errorf("error %v", err)
+	}
+	if _, err := inventory.WindowsVersion(); err == nil {
+		t.Error("no error without hive")
+	}
+}
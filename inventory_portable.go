@@ -0,0 +1,143 @@
+// Update Checker
+// Copyright (C) 2020-22  Florian Probst
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// windowsEnvironmentVariable matches %NAME% in configured directories
+var windowsEnvironmentVariable = regexp.MustCompile(`%([^%]+)%`)
+
+// portableInventory is the inventory provider for portable software, which
+// is found by reading the version resources of the executables in the
+// configured directories
+type portableInventory struct {
+	directories []string
+	maxDepth    int
+}
+
+// newPortableInventory returns an inventory provider for the directories of
+// the configuration
+func newPortableInventory(cfg portableConfig) *portableInventory {
+	return &portableInventory{directories: cfg.Directories, maxDepth: cfg.MaxDepth}
+}
+
+// Name returns the name of the inventory source
+func (p *portableInventory) Name() string {
+	return "portable:" + strings.Join(p.directories, ";")
+}
+
+// InstalledSoftware returns one entry per product and directory for all
+// executables with a ProductName in their version resource. Directories that
+// do not exist or cannot be read are only logged.
+func (p *portableInventory) InstalledSoftware() (map[string]installedSoftwareComponent, error) {
+	foundSoftware := make(map[string]installedSoftwareComponent)
+
+	for _, configured := range p.directories {
+		root := expandWindowsEnvironment(configured)
+		if _, err := os.Stat(root); err != nil {
+			Info.Printf("Skipping directory %s of portable software: %s", root, err)
+			continue
+		}
+
+		walkFiles(root, p.maxDepth, nil, func(path string) {
+			if !strings.EqualFold(filepath.Ext(path), ".exe") {
+				return
+			}
+
+			info, err := readPEVersionInfo(path)
+			if err != nil {
+				Trace.Printf("%s: %s", path, err)
+				return
+			}
+			if info.ProductName == "" {
+				return
+			}
+
+			// all executables of a product (e.g. 7z.exe and 7zFM.exe) are
+			// reported once per directory
+			key := filepath.Dir(path) + "|" + info.ProductName
+			if _, exists := foundSoftware[key]; exists {
+				return
+			}
+			foundSoftware[key] = installedSoftwareComponent{
+				DisplayName:     info.ProductName,
+				DisplayVersion:  info.version(),
+				Publisher:       info.CompanyName,
+				Architecture:    info.Architecture,
+				InstallLocation: filepath.Dir(path),
+				FilePath:        path,
+				VersionSource:   VersionSourceFile,
+			}
+		})
+	}
+
+	return foundSoftware, nil
+}
+
+// walkFiles calls visit for all regular files below root, up to maxDepth
+// levels of subdirectories. Directories for which skipDir (if not nil)
+// returns true are left out, errors are only logged.
+func walkFiles(root string, maxDepth int, skipDir func(path string) bool, visit func(path string)) {
+	err := filepath.WalkDir(root, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			Info.Printf("Could not read %s: %s", path, err)
+			if entry != nil && entry.IsDir() && path != root {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if entry.IsDir() {
+			if path != root && (pathDepth(root, path) > maxDepth || (skipDir != nil && skipDir(path))) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if entry.Type().IsRegular() {
+			visit(path)
+		}
+		return nil
+	})
+	if err != nil {
+		Info.Printf("Could not read %s: %s", root, err)
+	}
+}
+
+// pathDepth returns the number of directories between root and path
+func pathDepth(root string, path string) int {
+	rel, err := filepath.Rel(root, path)
+	if err != nil || rel == "." {
+		return 0
+	}
+	return strings.Count(rel, string(filepath.Separator)) + 1
+}
+
+// expandWindowsEnvironment replaces %NAME% by the value of the environment
+// variable (unknown variables are kept)
+func expandWindowsEnvironment(path string) string {
+	return windowsEnvironmentVariable.ReplaceAllStringFunc(path, func(variable string) string {
+		if value, ok := os.LookupEnv(variable[1 : len(variable)-1]); ok {
+			return value
+		}
+		return variable
+	})
+}
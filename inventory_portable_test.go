@@ -0,0 +1,173 @@
+// Update Checker
+// Copyright (C) 2020-22  Florian Probst
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// writeTestFiles creates the files below root, the content is either the
+// file content or "testdata/..." to copy a fixture
+func writeTestFiles(t *testing.T, root string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		data := []byte(content)
+		if strings.HasPrefix(content, "testdata/") {
+			var err error
+			if data, err = ioutil.ReadFile(content); err != nil {
+				t.Fatal(err)
+			}
+		}
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestWalkFiles(t *testing.T) {
+	root := t.TempDir()
+	writeTestFiles(t, root, map[string]string{
+		"a.txt":               "",
+		"one/b.txt":           "",
+		"one/two/c.txt":       "",
+		"one/two/three/d.txt": "",
+		"skip/e.txt":          "",
+		"other/skip/f.txt":    "",
+	})
+	skipDir := func(path string) bool {
+		return filepath.Base(path) == "skip"
+	}
+
+	tests := []struct {
+		maxDepth int
+		skipDir  func(path string) bool
+		visited  []string
+	}{
+		{0, nil, []string{"a.txt"}},
+		{1, skipDir, []string{"a.txt", "one/b.txt"}},
+		{2, skipDir, []string{"a.txt", "one/b.txt", "one/two/c.txt"}},
+		{2, nil, []string{"a.txt", "one/b.txt", "one/two/c.txt", "other/skip/f.txt", "skip/e.txt"}},
+		{3, skipDir, []string{"a.txt", "one/b.txt", "one/two/c.txt", "one/two/three/d.txt"}},
+	}
+	for _, test := range tests {
+		var visited []string
+		walkFiles(root, test.maxDepth, test.skipDir, func(path string) {
+			rel, err := filepath.Rel(root, path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			visited = append(visited, filepath.ToSlash(rel))
+		})
+		sort.Strings(visited)
+		if !reflect.DeepEqual(visited, test.visited) {
+			t.Errorf("depth %d, skip %t: %q, want %q", test.maxDepth, test.skipDir != nil, visited, test.visited)
+		}
+	}
+
+	// a missing root is only logged
+	walkFiles(filepath.Join(root, "missing"), 3, nil, func(path string) {
+		t.Errorf("visited %s", path)
+	})
+}
+
+func TestPortableInventory(t *testing.T) {
+	root := t.TempDir()
+	writeTestFiles(t, root, map[string]string{
+		"putty/putty.exe":           "testdata/pe/putty.exe",
+		"putty/readme.txt":          "PuTTY",
+		"npp/notepad++.exe":         "testdata/pe/notepad++.exe",
+		"npp/notepad++ (copy).exe":  "testdata/pe/notepad++.exe",
+		"crypt/VeraCrypt.EXE":       "testdata/pe/veracrypt.exe",
+		"icons/icons.exe":           "testdata/pe/icononly.exe",
+		"noversion/tool.exe":        "testdata/pe/noversion.exe",
+		"broken/broken.exe":         "MZ",
+		"deep/a/b/putty.exe":        "testdata/pe/putty.exe",
+		"putty/putty.exe.bak/x.exe": "testdata/pe/putty.exe",
+	})
+	os.Setenv("UPDATECHECKER_TEST_TOOLS", root)
+	defer os.Unsetenv("UPDATECHECKER_TEST_TOOLS")
+
+	provider := newPortableInventory(portableConfig{
+		Directories: []string{"%UPDATECHECKER_TEST_TOOLS%", filepath.Join(root, "missing")},
+		MaxDepth:    2,
+	})
+	foundSoftware, err := provider.InstalledSoftware()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]installedSoftwareComponent{
+		"PuTTY suite|putty": {
+			DisplayName:    "PuTTY suite",
+			DisplayVersion: "0.76.0.0",
+			Publisher:      "Simon Tatham",
+			Architecture:   ArchitectureX64,
+			FilePath:       filepath.Join(root, "putty", "putty.exe"),
+		},
+		"Notepad++|npp": {
+			DisplayName:    "Notepad++",
+			DisplayVersion: "8.1.9.0",
+			Publisher:      "Don HO don.h@free.fr",
+			Architecture:   ArchitectureX64,
+			FilePath:       filepath.Join(root, "npp", "notepad++ (copy).exe"),
+		},
+		"VeraCrypt|crypt": {
+			DisplayName:    "VeraCrypt",
+			DisplayVersion: "1.24-Update7",
+			Publisher:      "IDRIX",
+			Architecture:   ArchitectureX86,
+			FilePath:       filepath.Join(root, "crypt", "VeraCrypt.EXE"),
+		},
+		"PuTTY suite|putty/putty.exe.bak": {
+			DisplayName:    "PuTTY suite",
+			DisplayVersion: "0.76.0.0",
+			Publisher:      "Simon Tatham",
+			Architecture:   ArchitectureX64,
+			FilePath:       filepath.Join(root, "putty", "putty.exe.bak", "x.exe"),
+		},
+	}
+	found := make(map[string]installedSoftwareComponent)
+	for _, component := range foundSoftware {
+		rel, err := filepath.Rel(root, component.InstallLocation)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if component.VersionSource != VersionSourceFile {
+			t.Errorf("%s: version source %q", component.DisplayName, component.VersionSource)
+		}
+		component.InstallLocation, component.VersionSource = "", ""
+		found[component.DisplayName+"|"+filepath.ToSlash(rel)] = component
+	}
+	for key, component := range want {
+		if found[key] != component {
+			t.Errorf("%s: %+v, want %+v", key, found[key], component)
+		}
+	}
+	if len(found) != len(want) {
+		t.Errorf("found %d programs, want %d: %v", len(found), len(want), found)
+	}
+}
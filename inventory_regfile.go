@@ -0,0 +1,170 @@
+// Update Checker
+// Copyright (C) 2020-21  Florian Probst
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+)
+
+// regFileInventory is the inventory provider for registry exports of the
+// Uninstall keys (e.g. "reg export HKLM\...\Uninstall uninstall.reg")
+type regFileInventory struct {
+	path string
+	file *regFile
+}
+
+// newRegFileInventory returns an inventory provider for the given .reg file
+func newRegFileInventory(path string) *regFileInventory {
+	return &regFileInventory{path: path}
+}
+
+// Name returns the name of the inventory source
+func (f *regFileInventory) Name() string {
+	return "regfile:" + f.path
+}
+
+// InstalledSoftware returns the software of all Uninstall sub keys in the
+// export, with scope and architecture taken from the key path
+func (f *regFileInventory) InstalledSoftware() (map[string]installedSoftwareComponent, error) {
+	if err := f.load(); err != nil {
+		return nil, err
+	}
+
+	// the native Uninstall key holds 64-bit software if there is a Wow6432Node
+	hasWow64 := false
+	for _, lowerPath := range f.file.Order {
+		if strings.Contains(lowerPath, "\\wow6432node\\") {
+			hasWow64 = true
+			break
+		}
+	}
+
+	foundSoftware := make(map[string]installedSoftwareComponent)
+	for _, lowerPath := range f.file.Order {
+		k := f.file.Keys[lowerPath]
+		subKeyName, scope, architecture, ok := uninstallKeyPlacement(k.Path, hasWow64)
+		if !ok {
+			continue
+		}
+
+		component := uninstallComponent(k.Path, subKeyName, k)
+		component.Scope = scope
+		component.Architecture = architecture
+
+		key := subKeyName
+		if _, exists := foundSoftware[key]; exists {
+			// same sub key in another hive or in Wow6432Node
+			key = k.Path
+		}
+		foundSoftware[key] = component
+	}
+
+	return foundSoftware, nil
+}
+
+// WindowsVersion returns the Windows version if the export contains the
+// key HKLM\SOFTWARE\Microsoft\Windows NT\CurrentVersion
+func (f *regFileInventory) WindowsVersion() (WindowsVersion, error) {
+	if err := f.load(); err != nil {
+		return WindowsVersion{}, err
+	}
+	for _, lowerPath := range f.file.Order {
+		k := f.file.Keys[lowerPath]
+		scope, rest, ok := splitRegistryRoot(k.Path)
+		if ok && scope == ScopeMachine && strings.EqualFold(rest, windowsVersionKeyPath) {
+			return readWindowsVersion(k)
+		}
+	}
+	return WindowsVersion{}, errors.New("Registry export " + f.path + " contains no Windows version")
+}
+
+// load reads the registry export (only once)
+func (f *regFileInventory) load() error {
+	if f.file != nil {
+		return nil
+	}
+
+	content, err := ioutil.ReadFile(f.path)
+	if err != nil {
+		return err
+	}
+	file, err := parseRegFile(content)
+	if err != nil {
+		return fmt.Errorf("Could not parse registry export %s: %w", f.path, err)
+	}
+
+	f.file = file
+	return nil
+}
+
+// splitRegistryRoot splits a full registry path into the scope of its root
+// key and the path below it (for HKEY_USERS below the user SID). ok is false
+// for other root keys.
+func splitRegistryRoot(path string) (scope string, rest string, ok bool) {
+	parts := strings.SplitN(path, "\\", 2)
+	if len(parts) < 2 {
+		return "", "", false
+	}
+
+	switch strings.ToUpper(parts[0]) {
+	case "HKEY_LOCAL_MACHINE", "HKLM":
+		return ScopeMachine, parts[1], true
+	case "HKEY_CURRENT_USER", "HKCU":
+		return ScopeUser, parts[1], true
+	case "HKEY_USERS", "HKU":
+		userParts := strings.SplitN(parts[1], "\\", 2)
+		if len(userParts) < 2 || strings.HasSuffix(strings.ToLower(userParts[0]), "_classes") {
+			return "", "", false
+		}
+		return ScopeUser, userParts[1], true
+	}
+	return "", "", false
+}
+
+// uninstallKeyPlacement checks if the registry path is a direct sub key of
+// an Uninstall key and returns its name, scope and architecture (empty if
+// unknown, i.e. for the native key of a system without Wow6432Node)
+func uninstallKeyPlacement(path string, hasWow64 bool) (subKeyName string, scope string, architecture string, ok bool) {
+	scope, rest, ok := splitRegistryRoot(path)
+	if !ok {
+		return "", "", "", false
+	}
+
+	for _, uninstallKey := range []string{uninstallKeyPathWow64, uninstallKeyPath} {
+		prefix := uninstallKey + "\\"
+		if len(rest) <= len(prefix) || !strings.EqualFold(rest[:len(prefix)], prefix) {
+			continue
+		}
+		subKeyName = rest[len(prefix):]
+		if strings.Contains(subKeyName, "\\") {
+			// deeper sub key
+			return "", "", "", false
+		}
+
+		switch {
+		case uninstallKey == uninstallKeyPathWow64:
+			architecture = ArchitectureX86
+		case scope == ScopeMachine && hasWow64:
+			architecture = ArchitectureX64
+		}
+		return subKeyName, scope, architecture, true
+	}
+	return "", "", "", false
+}
@@ -0,0 +1,106 @@
+// Update Checker
+// Copyright (C) 2020-22  Florian Probst
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import "testing"
+
+// testPlacement is the expected software of an Uninstall sub key
+type testPlacement struct {
+	displayName  string
+	scope        string
+	architecture string
+}
+
+// checkInstalledSoftware compares the software of an inventory provider
+func checkInstalledSoftware(t *testing.T, provider inventoryProvider, want map[string]testPlacement) {
+	t.Helper()
+	foundSoftware, err := provider.InstalledSoftware()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(foundSoftware) != len(want) {
+		t.Errorf("%d programs, want %d: %v", len(foundSoftware), len(want), foundSoftware)
+	}
+	for key, expected := range want {
+		component, found := foundSoftware[key]
+		if !found {
+			t.Errorf("%s not found", key)
+			continue
+		}
+		if component.DisplayName != expected.displayName || component.Scope != expected.scope || component.Architecture != expected.architecture {
+			t.Errorf("%s: %q, scope %q, architecture %q, want %q, %q, %q", key,
+				component.DisplayName, component.Scope, component.Architecture,
+				expected.displayName, expected.scope, expected.architecture)
+		}
+	}
+}
+
+func TestRegFileInventory(t *testing.T) {
+	inventory := newRegFileInventory("testdata/uninstall_utf16.reg")
+	// the native key holds 64-bit software since the export contains Wow6432Node
+	checkInstalledSoftware(t, inventory, map[string]testPlacement{
+		"Mozilla Firefox 96.0.3 (x64 en-US)": {"Mozilla Firefox (x64 en-US)", ScopeMachine, ArchitectureX64},
+		"7-Zip":                              {"7-Zip 21.07", ScopeMachine, ArchitectureX86},
+		"HKEY_LOCAL_MACHINE\\SOFTWARE\\Microsoft\\Windows\\CurrentVersion\\Uninstall\\7-Zip": {"7-Zip 21.07 (x64)", ScopeMachine, ArchitectureX64},
+		"Teams": {"Microsoft Teams", ScopeUser, ""},
+	})
+
+	windowsVersion, err := inventory.WindowsVersion()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if windowsVersion.CurrentMajorVersionNumber != 10 || windowsVersion.CurrentBuild != "19044" || windowsVersion.UBR != 1402 || windowsVersion.ReleaseID != "21H2" {
+		t.Errorf("Windows version %+v", windowsVersion)
+	}
+}
+
+func TestRegFileInventoryWithoutWow64(t *testing.T) {
+	inventory := newRegFileInventory("testdata/uninstall_regedit4.reg")
+	// without Wow6432Node the architecture of the native key is unknown
+	checkInstalledSoftware(t, inventory, map[string]testPlacement{
+		"Notepad++":   {"Notepad++ (64-bit x64)", ScopeMachine, ""},
+		"Müller Tool": {"Müller Tool", ScopeUser, ""},
+	})
+	if _, err := inventory.WindowsVersion(); err == nil {
+		t.Error("no error for an export without Windows version")
+	}
+}
+
+func TestSplitRegistryRoot(t *testing.T) {
+	tests := []struct {
+		path  string
+		scope string
+		rest  string
+		ok    bool
+	}{
+		{"HKEY_LOCAL_MACHINE\\SOFTWARE\\Microsoft", ScopeMachine, "SOFTWARE\\Microsoft", true},
+		{"HKLM\\SOFTWARE", ScopeMachine, "SOFTWARE", true},
+		{"HKEY_CURRENT_USER\\Software", ScopeUser, "Software", true},
+		{"hkcu\\Software", ScopeUser, "Software", true},
+		{"HKEY_USERS\\S-1-5-21-1-2-3-1001\\Software", ScopeUser, "Software", true},
+		{"HKEY_USERS\\S-1-5-21-1-2-3-1001_Classes\\Software", "", "", false},
+		{"HKEY_USERS\\.DEFAULT", "", "", false},
+		{"HKEY_CLASSES_ROOT\\.reg", "", "", false},
+		{"HKEY_LOCAL_MACHINE", "", "", false},
+	}
+	for _, test := range tests {
+		scope, rest, ok := splitRegistryRoot(test.path)
+		if scope != test.scope || rest != test.rest || ok != test.ok {
+			t.Errorf("%s: %q %q %t, want %q %q %t", test.path, scope, rest, ok, test.scope, test.rest, test.ok)
+		}
+	}
+}
@@ -0,0 +1,284 @@
+// Update Checker
+// Copyright (C) 2020-22  Florian Probst
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// VersionSourcePath means that the version was taken from the name of the
+// installation directory (e.g. "nginx-1.21.6")
+const VersionSourcePath = "path"
+
+// maxVersionFileSize is the maximum number of bytes searched for a version
+// string in an executable or version file
+const maxVersionFileSize = 64 << 20
+
+// serverProduct describes how an installation of server software is found
+// and how its version is determined
+type serverProduct struct {
+	DisplayName    string         // name of the found installations, matched by the product rules
+	Executable     *regexp.Regexp // file name of the executable that identifies an installation
+	Hint           *regexp.Regexp // has to match ProductName or path of the executable (optional)
+	IgnoreResource bool           // the version resource is not the product version (e.g. procrun of Tomcat)
+	VersionFiles   []string       // further files with the version string, relative to the executable
+	VersionString  *regexp.Regexp // version string in the executable or the version files (submatch 1)
+	RootLevels     int            // levels of the installation directory above the executable (bin = 1)
+}
+
+// serverProducts are the server software products detected by their
+// executables. MariaDB is checked before MySQL (both have a mysqld.exe).
+var serverProducts = []serverProduct{
+	{
+		DisplayName:   "Apache HTTP Server",
+		Executable:    regexp.MustCompile(`(?i)^httpd\.exe$`),
+		VersionFiles:  []string{"libhttpd.dll"},
+		VersionString: regexp.MustCompile(`Apache/(\d+\.\d+\.\d+)`),
+		RootLevels:    1,
+	},
+	{
+		DisplayName:   "nginx",
+		Executable:    regexp.MustCompile(`(?i)^nginx\.exe$`),
+		VersionString: regexp.MustCompile(`nginx/(\d+\.\d+\.\d+)`),
+	},
+	{
+		DisplayName:   "PHP",
+		Executable:    regexp.MustCompile(`(?i)^php\.exe$`),
+		VersionString: regexp.MustCompile(`X-Powered-By: PHP/(\d+\.\d+\.\d+)`),
+	},
+	{
+		DisplayName: "MariaDB",
+		Executable:  regexp.MustCompile(`(?i)^(mariadbd|mysqld)\.exe$`),
+		Hint:        regexp.MustCompile(`(?i)mariadb`),
+		RootLevels:  1,
+	},
+	{
+		DisplayName: "MySQL Server",
+		Executable:  regexp.MustCompile(`(?i)^mysqld\.exe$`),
+		RootLevels:  1,
+	},
+	{
+		DisplayName: "PostgreSQL",
+		Executable:  regexp.MustCompile(`(?i)^postgres\.exe$`),
+		RootLevels:  1,
+	},
+	{
+		DisplayName:   "OpenSSL",
+		Executable:    regexp.MustCompile(`(?i)^openssl\.exe$`),
+		VersionString: regexp.MustCompile(`OpenSSL (\d+\.\d+\.\d+[a-z]?) `),
+		RootLevels:    1,
+	},
+	{
+		DisplayName:    "Apache Tomcat",
+		Executable:     regexp.MustCompile(`(?i)^tomcat\d*\.exe$`),
+		IgnoreResource: true,
+		VersionFiles:   []string{filepath.Join("..", "RELEASE-NOTES"), filepath.Join("..", "RUNNING.txt")},
+		VersionString:  regexp.MustCompile(`Apache Tomcat Version (\d+\.\d+\.\d+)`),
+		RootLevels:     1,
+	},
+}
+
+// pathVersion matches a version with at least three parts in a directory
+// name, e.g. "nginx-1.21.6" or "php-8.1.2-Win32-vs16-x64"
+var pathVersion = regexp.MustCompile(`(?:^|[-_ ])[vV]?(\d+\.\d+\.\d+[a-z]?)(?:$|[-_ ])`)
+
+// serverSkippedDirectories are not searched for server software (the program
+// files directories are configured separately)
+var serverSkippedDirectories = []string{"windows", "users", "programdata", "$recycle.bin", "system volume information", "node_modules", "winsxs", "program files", "program files (x86)"}
+
+// serverInventory is the inventory provider for server software (e.g. nginx
+// or PHP extracted from a zip file), which has often no Uninstall key
+type serverInventory struct {
+	directories []string
+	maxDepth    int
+}
+
+// newServerInventory returns an inventory provider for the directories of
+// the configuration
+func newServerInventory(cfg serverSoftwareConfig) *serverInventory {
+	return &serverInventory{directories: cfg.Directories, maxDepth: cfg.MaxDepth}
+}
+
+// Name returns the name of the inventory source
+func (s *serverInventory) Name() string {
+	return "server:" + strings.Join(s.directories, ";")
+}
+
+// InstalledSoftware returns one entry per found server software installation
+func (s *serverInventory) InstalledSoftware() (map[string]installedSoftwareComponent, error) {
+	foundSoftware := make(map[string]installedSoftwareComponent)
+
+	for _, configured := range s.directories {
+		root := expandWindowsEnvironment(configured)
+		if _, err := os.Stat(root); err != nil {
+			Trace.Printf("Skipping directory %s of server software: %s", root, err)
+			continue
+		}
+
+		skipDir := func(path string) bool {
+			return containsString(serverSkippedDirectories, strings.ToLower(filepath.Base(path)))
+		}
+		walkFiles(root, s.maxDepth, skipDir, func(path string) {
+			component, found := detectServerSoftware(path)
+			if !found {
+				return
+			}
+			// the directories may overlap (e.g. C:\ and C:\Program Files)
+			key := strings.ToLower(component.InstallLocation) + "|" + component.DisplayName
+			if _, exists := foundSoftware[key]; !exists {
+				foundSoftware[key] = component
+			}
+		})
+	}
+
+	return foundSoftware, nil
+}
+
+// detectServerSoftware checks if the file is the executable of a server
+// software product and determines the version of the installation
+func detectServerSoftware(path string) (installedSoftwareComponent, bool) {
+	name := filepath.Base(path)
+	for _, product := range serverProducts {
+		if !product.Executable.MatchString(name) {
+			continue
+		}
+		info, err := readPEVersionInfo(path)
+		if err != nil {
+			Trace.Printf("%s: %s", path, err)
+		}
+		if product.Hint != nil && !product.Hint.MatchString(info.ProductName+" "+path) {
+			continue
+		}
+
+		installLocation := filepath.Dir(path)
+		for i := 0; i < product.RootLevels; i++ {
+			installLocation = filepath.Dir(installLocation)
+		}
+		component := installedSoftwareComponent{
+			DisplayName:     product.DisplayName,
+			Publisher:       info.CompanyName,
+			Architecture:    info.Architecture,
+			InstallLocation: installLocation,
+			FilePath:        path,
+		}
+		component.DisplayVersion, component.VersionSource = product.version(path, info)
+		Trace.Printf("%s %s found in %s (version from %s)", component.DisplayName, component.DisplayVersion, path, component.VersionSource)
+		return component, true
+	}
+	return installedSoftwareComponent{}, false
+}
+
+// version returns the version of an installation and where it was found:
+// the version resource of the executable, a version string in the
+// executable or its version files, or the installation path
+func (product serverProduct) version(path string, info peVersionInfo) (string, string) {
+	if !product.IgnoreResource {
+		if _, err := parseVersion(info.version()); err == nil && info.version() != "0.0.0.0" {
+			return info.version(), VersionSourceFile
+		}
+	}
+
+	if product.VersionString != nil {
+		files := []string{path}
+		for _, versionFile := range product.VersionFiles {
+			files = append(files, filepath.Join(filepath.Dir(path), versionFile))
+		}
+		for _, file := range files {
+			if version, found := findVersionString(file, product.VersionString); found {
+				return version, VersionSourceFile
+			}
+		}
+	}
+
+	for dir := filepath.Dir(path); dir != filepath.Dir(dir); dir = filepath.Dir(dir) {
+		if match := pathVersion.FindStringSubmatch(filepath.Base(dir)); match != nil {
+			return match[1], VersionSourcePath
+		}
+	}
+	return "", ""
+}
+
+// findVersionString searches the file for the version regexp and returns
+// its first submatch
+func findVersionString(path string, versionString *regexp.Regexp) (string, bool) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", false
+	}
+	defer f.Close()
+	content, err := io.ReadAll(io.LimitReader(f, maxVersionFileSize))
+	if err != nil {
+		Trace.Printf("%s: %s", path, err)
+		return "", false
+	}
+	match := versionString.FindSubmatch(content)
+	if match == nil {
+		return "", false
+	}
+	return string(match[1]), true
+}
+
+// mergeServerInstallations removes found server software installations that
+// are also installed software with an Uninstall key (the executable is in its
+// InstallLocation). If the Uninstall key has no usable version, the version
+// of the found installation is used.
+func mergeServerInstallations(foundSoftware map[string]installedSoftwareComponent) {
+	for serverKey, server := range foundSoftware {
+		if server.RegistryKey != "" || server.FilePath == "" || !isServerProduct(server.DisplayName) {
+			continue
+		}
+		for key, component := range foundSoftware {
+			if component.RegistryKey == "" || !isPathBelow(server.FilePath, component.InstallLocation) {
+				continue
+			}
+			if _, err := parseVersion(component.DisplayVersion); err != nil && server.DisplayVersion != "" {
+				Info.Printf("%s: using version %s of %s", component.DisplayName, server.DisplayVersion, server.FilePath)
+				component.RegistryVersion = component.DisplayVersion
+				component.DisplayVersion = server.DisplayVersion
+				component.VersionSource = server.VersionSource
+				component.FilePath = server.FilePath
+				foundSoftware[key] = component
+			}
+			delete(foundSoftware, serverKey)
+			break
+		}
+	}
+}
+
+// isServerProduct checks if the name is the DisplayName of a server product
+func isServerProduct(name string) bool {
+	for _, product := range serverProducts {
+		if product.DisplayName == name {
+			return true
+		}
+	}
+	return false
+}
+
+// isPathBelow checks if path is in the directory dir (case insensitive)
+func isPathBelow(path string, dir string) bool {
+	dir = strings.TrimSpace(dir)
+	if dir == "" {
+		return false
+	}
+	rel, err := filepath.Rel(strings.ToLower(filepath.Clean(dir)), strings.ToLower(filepath.Clean(path)))
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
@@ -0,0 +1,256 @@
+// Update Checker
+// Copyright (C) 2020-22  Florian Probst
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"path/filepath"
+	"regexp"
+	"testing"
+)
+
+// testServerFiles are extracted server software installations, the
+// executables only contain a version string or are copies of fixtures
+var testServerFiles = map[string]string{
+	"nginx-1.21.6/nginx.exe":                    "MZ\x00 NGINX nginx/1.21.6 \x00",
+	"php/php.exe":                               "MZ\x00 X-Powered-By: PHP/8.1.2\r\n",
+	"mariadb-10.6.5-winx64/bin/mysqld.exe":      "MZ",
+	"mysql-8.0.28-winx64/bin/mysqld.exe":        "MZ",
+	"tomcat/bin/tomcat9.exe":                    "testdata/pe/putty.exe",
+	"tomcat/RELEASE-NOTES":                      "\n                     Apache Tomcat Version 9.0.58\n",
+	"tomcat10/bin/tomcat10.exe":                 "testdata/pe/putty.exe",
+	"tomcat10/RUNNING.txt":                      "Apache Tomcat Version 10.0.16\n",
+	"pgsql/bin/postgres.exe":                    "testdata/pe/notepad++.exe",
+	"OpenSSL-Win64/bin/openssl.exe":             "MZ",
+	"OpenSSL-Win64/bin/README.txt":              "OpenSSL 3.0.1 14 Dec 2021",
+	"Windows/System32/nginx.exe":                "nginx/1.0.0",
+	"Apache24/bin/httpd.txt":                    "Apache/2.4.52",
+	"Apache24/bin/ApacheMonitor.exe":            "Apache/2.4.52",
+	"deep/one/two/three/nginx-1.20.2/nginx.exe": "nginx/1.20.2",
+}
+
+func TestDetectServerSoftware(t *testing.T) {
+	root := t.TempDir()
+	writeTestFiles(t, root, testServerFiles)
+
+	tests := []struct {
+		path            string
+		displayName     string
+		version         string
+		versionSource   string
+		installLocation string
+	}{
+		{"nginx-1.21.6/nginx.exe", "nginx", "1.21.6", VersionSourceFile, "nginx-1.21.6"},
+		{"php/php.exe", "PHP", "8.1.2", VersionSourceFile, "php"},
+		// mysqld.exe of MariaDB is recognized by its path
+		{"mariadb-10.6.5-winx64/bin/mysqld.exe", "MariaDB", "10.6.5", VersionSourcePath, "mariadb-10.6.5-winx64"},
+		{"mysql-8.0.28-winx64/bin/mysqld.exe", "MySQL Server", "8.0.28", VersionSourcePath, "mysql-8.0.28-winx64"},
+		// the version resource of procrun is not the Tomcat version
+		{"tomcat/bin/tomcat9.exe", "Apache Tomcat", "9.0.58", VersionSourceFile, "tomcat"},
+		{"tomcat10/bin/tomcat10.exe", "Apache Tomcat", "10.0.16", VersionSourceFile, "tomcat10"},
+		{"pgsql/bin/postgres.exe", "PostgreSQL", "8.1.9.0", VersionSourceFile, "pgsql"},
+		// the version string is only searched in the executable
+		{"OpenSSL-Win64/bin/openssl.exe", "OpenSSL", "", "", "OpenSSL-Win64"},
+	}
+	for _, test := range tests {
+		component, found := detectServerSoftware(filepath.Join(root, filepath.FromSlash(test.path)))
+		if !found {
+			t.Errorf("%s: not found", test.path)
+			continue
+		}
+		if component.DisplayName != test.displayName || component.DisplayVersion != test.version || component.VersionSource != test.versionSource {
+			t.Errorf("%s: %s %q from %q, want %s %q from %q", test.path, component.DisplayName, component.DisplayVersion, component.VersionSource, test.displayName, test.version, test.versionSource)
+		}
+		if installLocation := filepath.Join(root, filepath.FromSlash(test.installLocation)); component.InstallLocation != installLocation {
+			t.Errorf("%s: install location %s, want %s", test.path, component.InstallLocation, installLocation)
+		}
+	}
+
+	for _, path := range []string{"Apache24/bin/httpd.txt", "Apache24/bin/ApacheMonitor.exe", "tomcat/RELEASE-NOTES"} {
+		if component, found := detectServerSoftware(filepath.Join(root, filepath.FromSlash(path))); found {
+			t.Errorf("%s: found %s", path, component.DisplayName)
+		}
+	}
+}
+
+func TestServerInventory(t *testing.T) {
+	root := t.TempDir()
+	writeTestFiles(t, root, testServerFiles)
+
+	// overlapping directories report each installation once
+	provider := newServerInventory(serverSoftwareConfig{
+		Directories: []string{root, filepath.Join(root, "php"), filepath.Join(root, "missing")},
+		MaxDepth:    3,
+	})
+	foundSoftware, err := provider.InstalledSoftware()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		"nginx-1.21.6":          "nginx",
+		"php":                   "PHP",
+		"mariadb-10.6.5-winx64": "MariaDB",
+		"mysql-8.0.28-winx64":   "MySQL Server",
+		"tomcat":                "Apache Tomcat",
+		"tomcat10":              "Apache Tomcat",
+		"pgsql":                 "PostgreSQL",
+		"OpenSSL-Win64":         "OpenSSL",
+	}
+	for _, component := range foundSoftware {
+		rel, err := filepath.Rel(root, component.InstallLocation)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if name, expected := want[filepath.ToSlash(rel)]; !expected || name != component.DisplayName {
+			t.Errorf("unexpected %s in %s", component.DisplayName, rel)
+		}
+	}
+	if len(foundSoftware) != len(want) {
+		t.Errorf("found %d installations, want %d", len(foundSoftware), len(want))
+	}
+}
+
+func TestServerProductVersion(t *testing.T) {
+	nginx := serverProduct{
+		DisplayName:   "nginx",
+		VersionString: regexp.MustCompile(`nginx/(\d+\.\d+\.\d+)`),
+	}
+	tomcat := serverProduct{
+		DisplayName:    "Apache Tomcat",
+		IgnoreResource: true,
+	}
+	root := filepath.Join(string(filepath.Separator), "srv")
+
+	tests := []struct {
+		product       serverProduct
+		path          string
+		info          peVersionInfo
+		version       string
+		versionSource string
+	}{
+		{nginx, "nginx-1.21.6/nginx.exe", peVersionInfo{}, "1.21.6", VersionSourcePath},
+		{nginx, "nginx-1.21.6/nginx.exe", peVersionInfo{ProductVersion: "1.21.5"}, "1.21.5", VersionSourceFile},
+		{nginx, "nginx-1.21.6/nginx.exe", peVersionInfo{FixedProductVersion: "0.0.0.0"}, "1.21.6", VersionSourcePath},
+		{nginx, "nginx-1.21.6/nginx.exe", peVersionInfo{ProductVersion: "nginx"}, "1.21.6", VersionSourcePath},
+		{nginx, "nginx/nginx.exe", peVersionInfo{}, "", ""},
+		{nginx, "nginx-1.21/nginx.exe", peVersionInfo{}, "", ""},
+		{nginx, "nginx1.21.6/nginx.exe", peVersionInfo{}, "", ""},
+		{nginx, "php-8.1.2-Win32-vs16-x64/ext/nginx.exe", peVersionInfo{}, "8.1.2", VersionSourcePath},
+		{nginx, "OpenSSL_v1.1.1m/bin/nginx.exe", peVersionInfo{}, "1.1.1m", VersionSourcePath},
+		{nginx, "apache 2.4.52/Apache24/bin/nginx.exe", peVersionInfo{}, "2.4.52", VersionSourcePath},
+		{tomcat, "apache-tomcat-9.0.58/bin/tomcat9.exe", peVersionInfo{ProductVersion: "1.3.0.0"}, "9.0.58", VersionSourcePath},
+	}
+	for _, test := range tests {
+		path := filepath.Join(root, filepath.FromSlash(test.path))
+		version, versionSource := test.product.version(path, test.info)
+		if version != test.version || versionSource != test.versionSource {
+			t.Errorf("%s %+v: %q from %q, want %q from %q", test.path, test.info, version, versionSource, test.version, test.versionSource)
+		}
+	}
+}
+
+func TestFindVersionString(t *testing.T) {
+	root := t.TempDir()
+	writeTestFiles(t, root, map[string]string{
+		"httpd.exe":   "MZ\x00\x00Apache/2.4.52 (Win64)\x00Apache/2.4.51",
+		"libhttpd.dl": "no version",
+	})
+	versionString := regexp.MustCompile(`Apache/(\d+\.\d+\.\d+)`)
+
+	tests := []struct {
+		file    string
+		version string
+		found   bool
+	}{
+		{"httpd.exe", "2.4.52", true},
+		{"libhttpd.dl", "", false},
+		{"missing.dll", "", false},
+	}
+	for _, test := range tests {
+		version, found := findVersionString(filepath.Join(root, test.file), versionString)
+		if version != test.version || found != test.found {
+			t.Errorf("%s: %q %t, want %q %t", test.file, version, found, test.version, test.found)
+		}
+	}
+}
+
+func TestMergeServerInstallations(t *testing.T) {
+	root := filepath.Join(string(filepath.Separator), "Programs")
+	path := func(elem ...string) string {
+		return filepath.Join(append([]string{root}, elem...)...)
+	}
+	foundSoftware := map[string]installedSoftwareComponent{
+		// Uninstall key without DisplayVersion
+		"postgresql": {DisplayName: "PostgreSQL 14", InstallLocation: path("PostgreSQL", "14"), RegistryKey: `HKLM\...\PostgreSQL 14`},
+		"server:postgresql": {DisplayName: "PostgreSQL", DisplayVersion: "14.2", VersionSource: VersionSourceFile,
+			FilePath: path("POSTGRESQL", "14", "bin", "postgres.exe")},
+		// Uninstall key with DisplayVersion
+		"nginx":        {DisplayName: "nginx", DisplayVersion: "1.20.2", InstallLocation: path("nginx") + string(filepath.Separator), RegistryKey: `HKLM\...\nginx`},
+		"server:nginx": {DisplayName: "nginx", DisplayVersion: "1.21.6", VersionSource: VersionSourcePath, FilePath: path("nginx", "nginx.exe")},
+		// not below the InstallLocation
+		"php":            {DisplayName: "PHP 8.1", DisplayVersion: "8.1.2", InstallLocation: path("php", "8.1"), RegistryKey: `HKLM\...\PHP 8.1`},
+		"server:php":     {DisplayName: "PHP", DisplayVersion: "7.4.27", FilePath: path("php", "8.1", "..", "7.4", "php.exe")},
+		"apache":         {DisplayName: "Apache HTTP Server", DisplayVersion: "2.4.52", InstallLocation: path("Apache2"), RegistryKey: `HKLM\...\Apache`},
+		"server:apache":  {DisplayName: "Apache HTTP Server", DisplayVersion: "2.4.51", FilePath: path("Apache24", "bin", "httpd.exe")},
+		"portable:putty": {DisplayName: "PuTTY suite", DisplayVersion: "0.76.0.0", FilePath: path("PostgreSQL", "14", "bin", "putty.exe")},
+	}
+	mergeServerInstallations(foundSoftware)
+
+	for _, key := range []string{"server:postgresql", "server:nginx"} {
+		if _, exists := foundSoftware[key]; exists {
+			t.Errorf("%s was not merged", key)
+		}
+	}
+	for _, key := range []string{"server:php", "server:apache", "portable:putty"} {
+		if _, exists := foundSoftware[key]; !exists {
+			t.Errorf("%s was merged", key)
+		}
+	}
+	if postgresql := foundSoftware["postgresql"]; postgresql.DisplayVersion != "14.2" || postgresql.VersionSource != VersionSourceFile || postgresql.FilePath != path("POSTGRESQL", "14", "bin", "postgres.exe") {
+		t.Errorf("postgresql: %+v", postgresql)
+	}
+	if nginx := foundSoftware["nginx"]; nginx.DisplayVersion != "1.20.2" || nginx.VersionSource != "" {
+		t.Errorf("nginx: %+v", nginx)
+	}
+}
+
+func TestIsPathBelow(t *testing.T) {
+	root := string(filepath.Separator)
+	path := func(s string) string {
+		return root + filepath.FromSlash(s)
+	}
+	tests := []struct {
+		path  string
+		dir   string
+		below bool
+	}{
+		{path("Program Files/nginx/nginx.exe"), path("Program Files/nginx"), true},
+		{path("PROGRAM FILES/NGINX/nginx.exe"), path("program files/nginx/"), true},
+		{path("Program Files/nginx/nginx.exe"), " " + path("Program Files") + " ", true},
+		{path("Program Files/nginx2/nginx.exe"), path("Program Files/nginx"), false},
+		{path("Program Files/nginx/../php/php.exe"), path("Program Files/nginx"), false},
+		{path("Program Files/nginx/nginx.exe"), path("Program Files/nginx/conf/.."), true},
+		{path("Program Files/nginx/..file.exe"), path("Program Files/nginx"), true},
+		{path("Program Files"), path("Program Files/nginx"), false},
+		{path("Program Files/nginx/nginx.exe"), "", false},
+		{path("Program Files/nginx/nginx.exe"), "  ", false},
+	}
+	for _, test := range tests {
+		if below := isPathBelow(test.path, test.dir); below != test.below {
+			t.Errorf("%q below %q: %t, want %t", test.path, test.dir, below, test.below)
+		}
+	}
+}
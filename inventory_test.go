@@ -0,0 +1,190 @@
+// Update Checker
+// Copyright (C) 2020-22  Florian Probst
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// testInventory is an inventory provider with fixed software
+type testInventory struct {
+	name     string
+	software map[string]installedSoftwareComponent
+	err      error
+}
+
+func (inventory testInventory) Name() string {
+	return inventory.name
+}
+
+func (inventory testInventory) InstalledSoftware() (map[string]installedSoftwareComponent, error) {
+	return inventory.software, inventory.err
+}
+
+func TestCollectInventory(t *testing.T) {
+	registry := testInventory{name: "registry", software: map[string]installedSoftwareComponent{
+		"7-Zip":     {DisplayName: "7-Zip 21.07 (x64)", DisplayVersion: "21.07", Architecture: ArchitectureX64, Scope: ScopeMachine, RegistryKey: "HKLM\\SOFTWARE\\Microsoft\\Windows\\CurrentVersion\\Uninstall\\7-Zip"},
+		"Java":      {DisplayName: "Java 8 Update 321", DisplayVersion: "8.0.3210.7", Architecture: ArchitectureX64, Scope: ScopeMachine},
+		"tool":      {DisplayName: "Tool", DisplayVersion: "1.0"},
+		"file:tool": {DisplayName: "Tool", DisplayVersion: "2.0"},
+	}}
+	file := testInventory{name: "file", software: map[string]installedSoftwareComponent{
+		// the same installation with another key and path
+		"HKLM\\7-Zip": {DisplayName: "7-zip  21.07 (x64) ", DisplayVersion: "21.07 ", Architecture: ArchitectureX64, Scope: ScopeMachine, RegistryKey: "HKEY_LOCAL_MACHINE\\SOFTWARE\\Microsoft\\Windows\\CurrentVersion\\Uninstall\\7-Zip"},
+		// another architecture, version or scope is another installation
+		"Java":  {DisplayName: "Java 8 Update 321", DisplayVersion: "8.0.3210.7", Architecture: ArchitectureX86, Scope: ScopeMachine},
+		"Java8": {DisplayName: "Java 8 Update 321", DisplayVersion: "8.0.3210.7", Architecture: ArchitectureX64, Scope: ScopeUser},
+		"tool":  {DisplayName: "Tool", DisplayVersion: "3.0"},
+	}}
+
+	foundSoftware, err := collectInventory([]inventoryProvider{registry, file})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]installedSoftwareComponent{
+		"7-Zip":       registry.software["7-Zip"],
+		"Java":        registry.software["Java"],
+		"tool":        registry.software["tool"],
+		"file:tool":   registry.software["file:tool"],
+		"file:Java":   file.software["Java"],
+		"Java8":       file.software["Java8"],
+		"file:tool#2": file.software["tool"],
+	}
+	for key, component := range want {
+		if foundSoftware[key] != component {
+			t.Errorf("%s: %+v, want %+v", key, foundSoftware[key], component)
+		}
+	}
+	if len(foundSoftware) != len(want) {
+		t.Errorf("%d programs, want %d: %v", len(foundSoftware), len(want), foundSoftware)
+	}
+}
+
+func TestCollectInventoryErrors(t *testing.T) {
+	if _, err := collectInventory(nil); err == nil {
+		t.Error("no error without providers")
+	}
+	errBroken := errors.New("broken")
+	_, err := collectInventory([]inventoryProvider{testInventory{name: "registry"}, testInventory{name: "file", err: errBroken}})
+	if !errors.Is(err, errBroken) || err.Error() != "Inventory source file failed: broken" {
+		t.Errorf("error %v", err)
+	}
+}
+
+func TestInventoryWindowsVersion(t *testing.T) {
+	version, err := inventoryWindowsVersion([]inventoryProvider{testInventory{name: "file"}, newImageInventory("testdata/hive")})
+	if err != nil || version.CurrentBuild != "19044" {
+		t.Errorf("Windows version %+v (%v)", version, err)
+	}
+	if _, err := inventoryWindowsVersion([]inventoryProvider{testInventory{name: "file"}}); err == nil {
+		t.Error("no error without Windows version")
+	}
+
+	// an image without SOFTWARE hive before an inventory file with the version
+	image := t.TempDir()
+	writeTestFiles(t, image, map[string]string{"Windows/System32/config/SYSTEM": ""})
+	windowsVersion := &WindowsVersion{CurrentMajorVersionNumber: 10, UBR: 1466, CurrentBuild: "19044", ReleaseID: "21H2", ProductName: "Windows 10 Pro"}
+	file := newFileInventory(writeTestInventory(t, windowsVersion, nil))
+	version, err = inventoryWindowsVersion([]inventoryProvider{newImageInventory(image), file})
+	if err != nil || version != *windowsVersion {
+		t.Errorf("Windows version %+v (%v), want the version of the inventory file", version, err)
+	}
+
+	// the error of the last provider if none knows the version
+	noVersion := newFileInventory(writeTestInventory(t, nil, nil))
+	_, err = inventoryWindowsVersion([]inventoryProvider{newImageInventory(image), noVersion})
+	if err == nil || !strings.HasSuffix(err.Error(), "contains no Windows version") {
+		t.Errorf("error %v, want the error of the inventory file", err)
+	}
+}
+
+func TestCollectInventoryPortable(t *testing.T) {
+	registry := testInventory{name: "registry", software: map[string]installedSoftwareComponent{
+		"PuTTY": {DisplayName: "PuTTY", DisplayVersion: "0.76", Architecture: ArchitectureX64, Scope: ScopeMachine, RegistryKey: "HKLM\\SOFTWARE\\Microsoft\\Windows\\CurrentVersion\\Uninstall\\PuTTY"},
+		"7-Zip": {DisplayName: "7-Zip", DisplayVersion: "21.07", Architecture: ArchitectureX86, Scope: ScopeUser},
+	}}
+	portable := testInventory{name: "portable", software: map[string]installedSoftwareComponent{
+		// the installed PuTTY and 7-Zip found by the directory search (no scope)
+		"C:\\Program Files\\PuTTY": {DisplayName: "PuTTY ", DisplayVersion: "0.76", Architecture: ArchitectureX64, FilePath: "C:\\Program Files\\PuTTY\\putty.exe"},
+		"C:\\Users\\a\\7-Zip":      {DisplayName: "7-zip", DisplayVersion: "21.07", FilePath: "C:\\Users\\a\\7-Zip\\7z.exe"},
+		// a portable copy of another version or architecture
+		"D:\\Tools\\PuTTY":   {DisplayName: "PuTTY", DisplayVersion: "0.75", Architecture: ArchitectureX64, FilePath: "D:\\Tools\\PuTTY\\putty.exe"},
+		"D:\\Tools\\7-Zip64": {DisplayName: "7-Zip", DisplayVersion: "21.07", Architecture: ArchitectureX64, FilePath: "D:\\Tools\\7-Zip64\\7z.exe"},
+		// further copies of the installed version without architecture
+		"D:\\Tools\\7-Zip":  {DisplayName: "7-Zip", DisplayVersion: "21.07", FilePath: "D:\\Tools\\7-Zip\\7z.exe"},
+		"D:\\Backup\\7-Zip": {DisplayName: "7-Zip", DisplayVersion: "21.07", FilePath: "D:\\Backup\\7-Zip\\7z.exe"},
+	}}
+
+	foundSoftware, err := collectInventory([]inventoryProvider{registry, portable})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]installedSoftwareComponent{
+		"PuTTY":              registry.software["PuTTY"],
+		"7-Zip":              registry.software["7-Zip"],
+		"D:\\Tools\\PuTTY":   portable.software["D:\\Tools\\PuTTY"],
+		"D:\\Tools\\7-Zip64": portable.software["D:\\Tools\\7-Zip64"],
+	}
+	for key, component := range want {
+		if foundSoftware[key] != component {
+			t.Errorf("%s: %+v, want %+v", key, foundSoftware[key], component)
+		}
+	}
+	if len(foundSoftware) != len(want) {
+		t.Errorf("%d programs, want %d: %v", len(foundSoftware), len(want), foundSoftware)
+	}
+}
+
+func TestCollectInventoryRegFiles(t *testing.T) {
+	// the native and the Wow6432Node Uninstall key exported separately, the
+	// native key has no architecture then
+	dir := t.TempDir()
+	exports := map[string]string{
+		"native.reg": "REGEDIT4\n\n[HKEY_LOCAL_MACHINE\\SOFTWARE\\Microsoft\\Windows\\CurrentVersion\\Uninstall\\7-Zip]\n" +
+			"\"DisplayName\"=\"7-Zip 19.00\"\n\"DisplayVersion\"=\"19.00\"\n",
+		"wow64.reg": "REGEDIT4\n\n[HKEY_LOCAL_MACHINE\\SOFTWARE\\Wow6432Node\\Microsoft\\Windows\\CurrentVersion\\Uninstall\\7-Zip]\n" +
+			"\"DisplayName\"=\"7-Zip 19.00\"\n\"DisplayVersion\"=\"19.00\"\n",
+	}
+	var providers []inventoryProvider
+	for _, name := range []string{"native.reg", "wow64.reg"} {
+		path := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(path, []byte(exports[name]), 0644); err != nil {
+			t.Fatal(err)
+		}
+		providers = append(providers, newRegFileInventory(path))
+	}
+	// the x64 installation found by the directory search is the native one
+	providers = append(providers, testInventory{name: "portable", software: map[string]installedSoftwareComponent{
+		"C:\\Program Files\\7-Zip": {DisplayName: "7-Zip 19.00", DisplayVersion: "19.00", Architecture: ArchitectureX64, FilePath: "C:\\Program Files\\7-Zip\\7z.exe"},
+	}})
+
+	foundSoftware, err := collectInventory(providers)
+	if err != nil {
+		t.Fatal(err)
+	}
+	architectures := map[string]int{}
+	for _, component := range foundSoftware {
+		architectures[component.Architecture]++
+	}
+	if len(foundSoftware) != 2 || architectures[""] != 1 || architectures[ArchitectureX86] != 1 {
+		t.Errorf("installations %v, want the native and the 32-bit 7-Zip", foundSoftware)
+	}
+}
@@ -0,0 +1,258 @@
+// Update Checker
+// Copyright (C) 2020-22  Florian Probst
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+)
+
+// strategyJava selects the catalog entry of the Java feature release (e.g. 8
+// or 17). Installed and catalog versions are translated from the different
+// vendor formats ("8.0.3210.7", "8u322-b06", "1.8.0_321", "17.0.2+8") to
+// feature release and update number before they are compared.
+const strategyJava = "java"
+
+// javaVendorOracle is the vendor of the Oracle Java SE builds, which encode
+// the update number times ten in the DisplayVersion ("8.0.3210.7")
+const javaVendorOracle = "Oracle"
+
+// javaVendors identify the vendor of a Java installation by its DisplayName
+// and Publisher. The first match wins, OpenJDK builds are checked before
+// Oracle (AdoptOpenJDK contains "Java" as well).
+var javaVendors = []struct {
+	Name    string
+	Pattern *regexp.Regexp
+}{
+	{"Eclipse Adoptium", regexp.MustCompile(`(?i)temurin|adoptium|adoptopenjdk`)},
+	{"Azul Zulu", regexp.MustCompile(`(?i)zulu|azul`)},
+	{"Amazon Corretto", regexp.MustCompile(`(?i)corretto|amazon`)},
+	{"Microsoft", regexp.MustCompile(`(?i)microsoft build of openjdk`)},
+	{"BellSoft Liberica", regexp.MustCompile(`(?i)liberica|bellsoft`)},
+	{"Red Hat", regexp.MustCompile(`(?i)red ?hat`)},
+	{javaVendorOracle, regexp.MustCompile(`(?i)oracle|sun microsystems|^java(\(tm\))? `)},
+}
+
+var (
+	// "1.8.0_321" or "1.8.0.321"
+	javaLegacyVersion = regexp.MustCompile(`\b1\.([1-8])\.0[._](\d+)`)
+	// "8 Update 321" or "8u322-b06"
+	javaUpdateVersion = regexp.MustCompile(`(?i)\b(\d+)(?:u| update )(\d+)`)
+	// "17.0.2+8" or "8.0.322"
+	javaDottedVersion = regexp.MustCompile(`\b(\d+)\.(\d+)\.(\d+)`)
+	// text in parentheses, e.g. "(8u322-b06)" in "Zulu JDK 8.60.0.21 (8u322-b06), 64-bit"
+	javaParentheses = regexp.MustCompile(`\(([^)]*)\)`)
+)
+
+// javaVersion is a Java version translated to feature release, interim
+// release and update number (8u321 is 8.0.321, 17.0.2 stays 17.0.2)
+type javaVersion struct {
+	Vendor  string
+	Feature uint64
+	Interim uint64
+	Update  uint64
+}
+
+// parseJavaInstallation identifies vendor and version of installed Java. The
+// version is taken from a version in parentheses in the DisplayName (Zulu
+// has its own version scheme in DisplayVersion), else from the
+// DisplayVersion, else from the DisplayName.
+func parseJavaInstallation(installedComponent installedSoftwareComponent) (javaVersion, bool) {
+	vendor := "OpenJDK"
+	for _, javaVendor := range javaVendors {
+		if javaVendor.Pattern.MatchString(installedComponent.DisplayName) || javaVendor.Pattern.MatchString(installedComponent.Publisher) {
+			vendor = javaVendor.Name
+			break
+		}
+	}
+
+	for _, parentheses := range javaParentheses.FindAllStringSubmatch(installedComponent.DisplayName, -1) {
+		if version, ok := parseJavaVersionText(parentheses[1], false); ok {
+			version.Vendor = vendor
+			return version, true
+		}
+	}
+	if vendor != "Azul Zulu" {
+		if version, ok := parseJavaVersionText(installedComponent.DisplayVersion, vendor == javaVendorOracle); ok {
+			version.Vendor = vendor
+			return version, true
+		}
+	}
+	if version, ok := parseJavaVersionText(installedComponent.DisplayName, false); ok {
+		version.Vendor = vendor
+		return version, true
+	}
+	return javaVersion{Vendor: vendor}, false
+}
+
+// parseJavaVersionText finds a Java version in the text. With oracleEncoding
+// the third part of versions up to Java 8 is the update number times ten.
+func parseJavaVersionText(text string, oracleEncoding bool) (javaVersion, bool) {
+	if match := javaLegacyVersion.FindStringSubmatch(text); match != nil {
+		feature, _ := strconv.ParseUint(match[1], 10, 64)
+		update, err := strconv.ParseUint(match[2], 10, 64)
+		return javaVersion{Feature: feature, Update: update}, err == nil
+	}
+	if match := javaUpdateVersion.FindStringSubmatch(text); match != nil {
+		feature, err1 := strconv.ParseUint(match[1], 10, 64)
+		update, err2 := strconv.ParseUint(match[2], 10, 64)
+		return javaVersion{Feature: feature, Update: update}, err1 == nil && err2 == nil
+	}
+	match := javaDottedVersion.FindStringSubmatch(text)
+	if match == nil {
+		return javaVersion{}, false
+	}
+	var parts [3]uint64
+	for i := range parts {
+		part, err := strconv.ParseUint(match[i+1], 10, 64)
+		if err != nil {
+			return javaVersion{}, false
+		}
+		parts[i] = part
+	}
+
+	switch {
+	case parts[0] >= 9:
+		// new scheme since Java 9: feature.interim.update
+		return javaVersion{Feature: parts[0], Interim: parts[1], Update: parts[2]}, true
+	case oracleEncoding:
+		// Oracle: 8.0.3210.7 is 8 Update 321
+		return javaVersion{Feature: parts[0], Update: parts[2] / 10}, true
+	case parts[1] == 0:
+		// Adoptium and others: 8.0.322.6 is 8u322
+		return javaVersion{Feature: parts[0], Update: parts[2]}, true
+	default:
+		// Corretto: 8.322.06.1 is 8u322
+		return javaVersion{Feature: parts[0], Update: parts[1]}, true
+	}
+}
+
+// compare returns -1 if v < other, 0 if v == other and 1 if v > other (the
+// vendor is not compared)
+func (v javaVersion) compare(other javaVersion) int {
+	a := []uint64{v.Feature, v.Interim, v.Update}
+	b := []uint64{other.Feature, other.Interim, other.Update}
+	for i := range a {
+		if a[i] < b[i] {
+			return -1
+		} else if a[i] > b[i] {
+			return 1
+		}
+	}
+	return 0
+}
+
+// String returns the version in the usual notation of the feature release,
+// e.g. "8 Update 321" or "17.0.2"
+func (v javaVersion) String() string {
+	if v.Feature <= 8 {
+		return fmt.Sprintf("%d Update %d", v.Feature, v.Update)
+	}
+	return fmt.Sprintf("%d.%d.%d", v.Feature, v.Interim, v.Update)
+}
+
+// isJavaLTS checks if the feature release has long term support (all
+// releases up to 8, then 11 and every fourth release since 17)
+func isJavaLTS(feature uint64) bool {
+	return feature <= 8 || feature == 11 || (feature >= 17 && (feature-17)%4 == 0)
+}
+
+// evaluateJava maps installed Java to the catalog entry of its feature
+// release. Feature releases that are not in the catalog (non-LTS releases
+// after their six months of support, or old LTS releases) are end of life if
+// the catalog has a newer feature release; the next one is the mapped entry.
+func (rule productRule) evaluateJava(installedComponent installedSoftwareComponent, softwareReleaseStatii map[string]softwareReleaseStatus, catalog string) (softwareReleaseStatus, softwareStatus, statusReason) {
+	installed, ok := parseJavaInstallation(installedComponent)
+	if !ok {
+		Trace.Printf("%s: no Java version in %q (%s)", rule.Name, installedComponent.DisplayName, installedComponent.DisplayVersion)
+		return softwareReleaseStatus{}, StatusUnknown, ReasonVersionUnparseable
+	}
+
+	if currentRelease, found := catalogBranch(softwareReleaseStatii, catalog, strconv.FormatUint(installed.Feature, 10)); found {
+		current, ok := parseJavaVersionText(currentRelease.Version, false)
+		if !ok {
+			Trace.Printf("%s: catalog version %q is no Java version", rule.Name, currentRelease.Version)
+			return currentRelease, StatusUnknown, ReasonVersionUnparseable
+		}
+		switch c := installed.compare(current); {
+		case c == 0:
+			return currentRelease, StatusUpToDate, ReasonCurrent
+		case c > 0:
+			// e.g. OpenJDK 8u322 is released together with Oracle 8u321
+			return currentRelease, StatusUpToDate, ReasonNewerThanCatalog
+		default:
+			return currentRelease, StatusOutdated, ReasonUpdateAvailable
+		}
+	}
+
+	// next feature release in the catalog (sorted for deterministic results)
+	var keys []string
+	for statName := range softwareReleaseStatii {
+		keys = append(keys, statName)
+	}
+	sort.Strings(keys)
+	var successor softwareReleaseStatus
+	var successorFeature uint64
+	for _, statName := range keys {
+		statValue := softwareReleaseStatii[statName]
+		feature, err := strconv.ParseUint(statValue.MajorRelease, 10, 64)
+		if statValue.Name != catalog || err != nil || feature <= installed.Feature {
+			continue
+		}
+		if successorFeature == 0 || feature < successorFeature {
+			successor = statValue
+			successorFeature = feature
+		}
+	}
+	if successorFeature == 0 {
+		newest, found := newestCatalogEntry(softwareReleaseStatii, func(statName string, statValue softwareReleaseStatus) bool {
+			return statValue.Name == catalog
+		})
+		if !found {
+			return newest, StatusUnknown, ReasonNoCatalogEntry
+		}
+		// e.g. an early access build of the next feature release
+		return newest, StatusUpToDate, ReasonNewerThanCatalog
+	}
+	// the end of the installed release is not in the catalog
+	successor.Ends = ""
+	return successor, StatusOutdated, ReasonEndOfLife
+}
+
+// javaDetail describes installed Java for the detail of the mapping, e.g.
+// "Oracle Java 8 Update 321 (LTS)" or "Java 16 is no LTS release, update to
+// Java 17"
+func javaDetail(installedComponent installedSoftwareComponent, mapping installedSoftwareMapping) string {
+	installed, ok := parseJavaInstallation(installedComponent)
+	if !ok {
+		return ""
+	}
+	detail := installed.Vendor + " Java " + installed.String()
+	if isJavaLTS(installed.Feature) {
+		detail += " (LTS)"
+	}
+	if mapping.Reason == ReasonEndOfLife && mapping.MappedStatus.MajorRelease != strconv.FormatUint(installed.Feature, 10) {
+		if isJavaLTS(installed.Feature) {
+			detail += fmt.Sprintf("; Java %d is not supported anymore, update to Java %s", installed.Feature, mapping.MappedStatus.MajorRelease)
+		} else {
+			detail += fmt.Sprintf("; Java %d is no LTS release, update to Java %s", installed.Feature, mapping.MappedStatus.MajorRelease)
+		}
+	}
+	return detail
+}
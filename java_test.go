@@ -0,0 +1,110 @@
+// Update Checker
+// Copyright (C) 2020-22  Florian Probst
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// verifyTest is the expected row of an installed software
+type verifyTest struct {
+	status  softwareStatus
+	reason  statusReason
+	catalog string // mapped catalog version
+	detail  string
+}
+
+// checkVerifiedSoftware verifies the installed software with the embedded
+// rules and the channel policy against the test catalog and checks the rows
+// by name
+func checkVerifiedSoftware(t *testing.T, installedSoftware map[string]installedSoftwareComponent, channelPolicy map[string][]string, want map[string]verifyTest) {
+	t.Helper()
+	rules, _, err := parseProductRules(embeddedRules)
+	if err != nil {
+		t.Fatal(err)
+	}
+	asOf := time.Date(2022, 1, 31, 0, 0, 0, 0, time.UTC)
+	mappings := verifyInstalledSoftwareVersions(installedSoftware, testCatalogStatii(t), rules, nil, channelPolicy, asOf)
+	disambiguateInstances(mappings)
+
+	found := make(map[string]bool)
+	for _, mapping := range mappings {
+		found[mapping.Name] = true
+		test, expected := want[mapping.Name]
+		if !expected {
+			t.Errorf("unexpected row %s", mapping.Name)
+			continue
+		}
+		if mapping.Status != test.status || mapping.Reason != test.reason || mapping.MappedStatus.Version != test.catalog || mapping.Detail != test.detail {
+			t.Errorf("%s: %s (%s) %q %q, want %s (%s) %q %q", mapping.Name,
+				statusString(mapping.Status), mapping.Reason, mapping.MappedStatus.Version, mapping.Detail,
+				statusString(test.status), test.reason, test.catalog, test.detail)
+		}
+	}
+	for name := range want {
+		if !found[name] {
+			t.Errorf("no row %s", name)
+		}
+	}
+}
+
+func TestEvaluateJava(t *testing.T) {
+	installedSoftware := map[string]installedSoftwareComponent{
+		// 32-bit and 64-bit Oracle Java of the same update
+		"oracle-x64":  {DisplayName: "Java 8 Update 321", DisplayVersion: "8.0.3210.7", Publisher: "Oracle Corporation", Architecture: ArchitectureX64},
+		"oracle-x86":  {DisplayName: "Java 8 Update 321", DisplayVersion: "8.0.3210.7", Publisher: "Oracle Corporation", Architecture: ArchitectureX86},
+		"oracle-311":  {DisplayName: "Java 8 Update 311 (64-bit)", DisplayVersion: "8.0.3110.11", Publisher: "Oracle Corporation", Architecture: ArchitectureX64},
+		"oracle-7":    {DisplayName: "Java 7 Update 80", DisplayVersion: "7.0.800", Publisher: "Oracle", Architecture: ArchitectureX86},
+		"oracle-16":   {DisplayName: "Java(TM) SE Development Kit 16.0.2 (64-bit)", DisplayVersion: "16.0.2.0", Publisher: "Oracle Corporation"},
+		"corretto":    {DisplayName: "Amazon Corretto 8", DisplayVersion: "8.322.06.1", Publisher: "Amazon"},
+		"temurin-8":   {DisplayName: "Eclipse Temurin JDK with Hotspot 8u322-b06 (x64)", DisplayVersion: "8.0.322.6", Publisher: "Eclipse Adoptium"},
+		"temurin-11":  {DisplayName: "Eclipse Temurin JDK with Hotspot 11.0.14+9 (x64)", DisplayVersion: "11.0.14.9", Publisher: "Eclipse Adoptium"},
+		"zulu-8":      {DisplayName: "Zulu JDK 8.60.0.21 (8u322-b06), 64-bit", DisplayVersion: "8.60.0.21", Publisher: "Azul Systems, Inc."},
+		"zulu-17":     {DisplayName: "Zulu JDK 17.32.13 (17.0.2), 64-bit", DisplayVersion: "17.32.13", Publisher: "Azul Systems, Inc."},
+		"liberica-11": {DisplayName: "Liberica JDK 11", DisplayVersion: "11.0.13.8", Publisher: "BellSoft"},
+		"openjdk-17":  {DisplayName: "OpenJDK 17.0.2", DisplayVersion: "17.0.2"},
+		"openjdk-18":  {DisplayName: "Microsoft Build of OpenJDK with Hotspot 18.0.0 (x64)", DisplayVersion: "18.0.0.36", Publisher: "Microsoft"},
+		"unknown":     {DisplayName: "Java(TM) Platform SE binary", DisplayVersion: "", Publisher: "Oracle Corporation"},
+	}
+	checkVerifiedSoftware(t, installedSoftware, nil, map[string]verifyTest{
+		"Java 8 Update 321 (x64)":    {StatusUpToDate, ReasonCurrent, "1.8.0_321", "Oracle Java 8 Update 321 (LTS)"},
+		"Java 8 Update 321 (x86)":    {StatusUpToDate, ReasonCurrent, "1.8.0_321", "Oracle Java 8 Update 321 (LTS)"},
+		"Java 8 Update 311 (64-bit)": {StatusOutdated, ReasonUpdateAvailable, "1.8.0_321", "Oracle Java 8 Update 311 (LTS)"},
+		// feature releases without catalog branch
+		"Java 7 Update 80": {StatusOutdated, ReasonEndOfLife, "1.8.0_321", "Oracle Java 7 Update 80 (LTS); Java 7 is not supported anymore, update to Java 8"},
+		"Java(TM) SE Development Kit 16.0.2 (64-bit)": {StatusOutdated, ReasonEndOfLife, "17.0.2", "Oracle Java 16.0.2; Java 16 is no LTS release, update to Java 17"},
+		// other vendors are compared with Oracle
+		"Amazon Corretto 8": {StatusUpToDate, ReasonNewerThanCatalog, "1.8.0_321", "Amazon Corretto Java 8 Update 322 (LTS)"},
+		"Eclipse Temurin JDK with Hotspot 8u322-b06 (x64)":     {StatusUpToDate, ReasonNewerThanCatalog, "1.8.0_321", "Eclipse Adoptium Java 8 Update 322 (LTS)"},
+		"Eclipse Temurin JDK with Hotspot 11.0.14+9 (x64)":     {StatusUpToDate, ReasonCurrent, "11.0.14", "Eclipse Adoptium Java 11.0.14 (LTS)"},
+		"Zulu JDK 8.60.0.21 (8u322-b06), 64-bit":               {StatusUpToDate, ReasonNewerThanCatalog, "1.8.0_321", "Azul Zulu Java 8 Update 322 (LTS)"},
+		"Zulu JDK 17.32.13 (17.0.2), 64-bit":                   {StatusUpToDate, ReasonCurrent, "17.0.2", "Azul Zulu Java 17.0.2 (LTS)"},
+		"Liberica JDK 11":                                      {StatusOutdated, ReasonUpdateAvailable, "11.0.14", "BellSoft Liberica Java 11.0.13 (LTS)"},
+		"OpenJDK 17.0.2":                                       {StatusUpToDate, ReasonCurrent, "17.0.2", "OpenJDK Java 17.0.2 (LTS)"},
+		"Microsoft Build of OpenJDK with Hotspot 18.0.0 (x64)": {StatusUpToDate, ReasonNewerThanCatalog, "17.0.2", "Microsoft Java 18.0.0"},
+		"Java(TM) Platform SE binary":                          {StatusUnknown, ReasonVersionUnparseable, "", ""},
+	})
+}
+
+func TestIsJavaLTS(t *testing.T) {
+	for feature, lts := range map[uint64]bool{7: true, 8: true, 9: false, 11: true, 16: false, 17: true, 18: false, 21: true, 25: true} {
+		if isJavaLTS(feature) != lts {
+			t.Errorf("Java %d: LTS %t", feature, !lts)
+		}
+	}
+}
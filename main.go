@@ -20,14 +20,18 @@ package main
 
 import (
 	_ "embed"
+	"flag"
+	"fmt"
 	"io"
 	"log"
 	"os"
 	"sort"
 	"strings"
+	"time"
 
 	"github.com/blang/semver"
 	"github.com/rhysd/go-github-selfupdate/selfupdate"
+	"github.com/sqweek/dialog"
 )
 
 //go:embed version.txt
@@ -35,6 +39,40 @@ var version string
 
 const logpath = "UpdateChecker.log"
 
+// command line flags
+var (
+	headless            = flag.Bool("headless", false, "run without GUI, print results to stdout and exit with a status code")
+	showAllRows         = flag.Bool("all", false, "headless mode: also print software that is not verified by Update Checker")
+	outputFormat        = flag.String("format", "table", "headless mode: output format written to stdout (table or json)")
+	reportPath          = flag.String("report", "", "write a JSON report of the results to the given file")
+	inventoryPath       = flag.String("inventory", "", "offline evaluation: read the installed software from this inventory file instead of the registry")
+	catalogPath         = flag.String("catalog", "", "offline evaluation: use this vergrabber.json snapshot instead of downloading it")
+	asOfDate            = flag.String("asof", "", "evaluate as of this date (YYYY-MM-DD) instead of today")
+	exportInventoryPath = flag.String("export-inventory", "", "write the inventory of this machine to the given file and exit")
+	configPath          = flag.String("config", "", "read the configuration from this file (default "+defaultConfigFile+" if it exists)")
+	rulesPath           = flag.String("rules", "", "read additional product rules from this file (default "+localRulesFile+" if it exists)")
+	imagePath           = flag.String("image", "", "offline evaluation: read the installed software and the Windows version from the registry hives of the Windows installation in this directory")
+	regFilePaths        stringList
+)
+
+func init() {
+	flag.Var(&regFilePaths, "regfile", "offline evaluation: read the installed software from this registry export (.reg) instead of the registry, can be given more than once")
+}
+
+// stringList is a command line flag that can be given more than once
+type stringList []string
+
+// String returns the values separated by commas
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+// Set adds a value
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
 // Loggers for log output (we only need info and trace, errors have to be
 // displayed in the GUI)
 var (
@@ -59,6 +97,7 @@ func initLogging(traceHandle io.Writer, infoHandle io.Writer) {
 type softwareReleaseStatus struct {
 	Name         string // filled in manually from Vergrabber.json
 	MajorRelease string // filled in manually from Vergrabber.json
+	Category     string // filled in manually from Vergrabber.json ("client" or "server")
 	Stable       bool   // automatically unmarshalled from Vergrabber.json
 	Version      string // automatically unmarshalled from Vergrabber.json
 	Latest       bool   // automatically unmarshalled from Vergrabber.json
@@ -71,28 +110,87 @@ type softwareReleaseStatus struct {
 // this struct is used for filling in software attributes for software
 // that is actually installed on the system
 type installedSoftwareComponent struct {
-	DisplayName    string
-	DisplayVersion string
-	Publisher      string
+	DisplayName    string `json:"displayName"`
+	DisplayVersion string `json:"displayVersion"`
+	Publisher      string `json:"publisher"`
+	Scope          string `json:"scope,omitempty"`        // ScopeMachine or ScopeUser, empty if unknown
+	Architecture   string `json:"architecture,omitempty"` // ArchitectureX64 or ArchitectureX86, empty if unknown
+
+	// further values of the Uninstall key
+	InstallDate      string `json:"installDate,omitempty"` // YYYYMMDD
+	InstallLocation  string `json:"installLocation,omitempty"`
+	DisplayIcon      string `json:"displayIcon,omitempty"`
+	UninstallString  string `json:"uninstallString,omitempty"`
+	EstimatedSize    uint64 `json:"estimatedSize,omitempty"`    // in KB
+	SystemComponent  bool   `json:"systemComponent,omitempty"`  // hidden in "Programs and Features"
+	ParentKeyName    string `json:"parentKeyName,omitempty"`    // set for updates of another software
+	ReleaseType      string `json:"releaseType,omitempty"`      // e.g. "Update" or "Security Update"
+	WindowsInstaller bool   `json:"windowsInstaller,omitempty"` // installed by Windows Installer (MSI)
+	RegistryKey      string `json:"registryKey,omitempty"`      // full path of the Uninstall sub key
+	FilePath         string `json:"filePath,omitempty"`         // executable the version was read from (portable software or file version)
+	VersionSource    string `json:"versionSource,omitempty"`    // VersionSourceRegistry or VersionSourceFile
+	RegistryVersion  string `json:"registryVersion,omitempty"`  // DisplayVersion of the Uninstall key if replaced by the file version
+	Channel          string `json:"channel,omitempty"`          // release channel of the product rule (e.g. "esr" or "beta"), set on verification
 }
 
+// softwareStatus is the result of the verification of a software, the
+// statusReason tells why
+type softwareStatus int
+
 //StatusOutdated means that the software is not up-to-date
-const StatusOutdated = 0
+const StatusOutdated softwareStatus = 0
 
 //StatusUpToDate means that the software is up-to-date
-const StatusUpToDate = 1
+const StatusUpToDate softwareStatus = 1
 
 //StatusUnknown means that the software status or the software itself is unknown
-const StatusUnknown = 2
+const StatusUnknown softwareStatus = 2
+
+// ExitUpToDate is the headless mode exit code if all verified software is up-to-date
+const ExitUpToDate = 0
+
+// ExitOutdated is the headless mode exit code if at least one software is outdated
+const ExitOutdated = 1
+
+// ExitCheckFailed is the headless mode exit code if the check itself failed
+const ExitCheckFailed = 2
 
 type installedSoftwareMapping struct {
 	Name              string
-	Status            int
+	Status            softwareStatus
+	Reason            statusReason
 	InstalledSoftware installedSoftwareComponent
 	MappedStatus      softwareReleaseStatus
+	Detail            string          // additional information on the reason, e.g. "2 cumulative updates behind"
+	EndOfLife         endOfLifeStatus // end of life of the mapped release (see endOfLifeStatus constants)
+	MatchConfidence   int             // confidence of an automatic catalog match in percent, 0 if matched by a product rule
+}
+
+// scanOptions controls the sources used by runChecks
+type scanOptions struct {
+	Providers    []inventoryProvider // sources of the installed software and Windows version
+	CatalogFile  string              // vergrabber.json snapshot to use instead of downloading (offline)
+	AsOf         time.Time           // date of the evaluation, zero means now
+	RulesFile    string              // local product rules file, empty means the default file
+	Config       config              // settings from the configuration file
+	Offline      bool                // evaluation of a snapshot: the local rules file and build history are not used
+	RequireOS    bool                // fail if the Windows version cannot be read (headless mode)
+	FileVersions bool                // cross-check versions with the executables (local scans only)
+}
+
+// scanResult holds the results of one run of all checks
+type scanResult struct {
+	Mappings       []installedSoftwareMapping // Windows first, then sorted by status and name
+	Host           string
+	ScanTime       time.Time
+	AsOf           time.Time // only set if the evaluation date was given explicitly
+	CatalogUpdated time.Time // "updated" date of vergrabber.json
+	CatalogWarning string    // set if an outdated vergrabber.json had to be used
 }
 
 func main() {
+	flag.Parse()
+
 	// init logging
 	var logfile, err = os.Create(logpath)
 	if err != nil {
@@ -100,61 +198,242 @@ func main() {
 	}
 	initLogging(logfile, logfile)
 
-	doSelfUpdate()
+	options, err := scanOptionsFromFlags()
+	if err != nil {
+		attachConsole()
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(ExitCheckFailed)
+	}
+
+	if *exportInventoryPath != "" {
+		attachConsole()
+		if err := writeInventoryFile(*exportInventoryPath, options.Providers); err != nil {
+			Info.Println("Could not export inventory:", err)
+			fmt.Fprintln(os.Stderr, "Could not export inventory:", err)
+			os.Exit(ExitCheckFailed)
+		}
+		os.Exit(ExitUpToDate)
+	}
+
+	if *headless {
+		attachConsole()
+		os.Exit(runHeadless(options, os.Stdout, os.Stderr))
+	}
+
+	// no self update in offline evaluation mode
+	if options.CatalogFile == "" {
+		doSelfUpdate()
+	}
 
 	// build up main windows
 	mainWindow := createFyneAppWindow()
 
-	go main2()
+	go main2(options)
 
 	mainWindow.ShowAndRun()
 }
 
-func main2() {
+func main2(options scanOptions) {
+	result, err := runChecks(options)
+	if err != nil {
+		Info.Println("Check failed:", err)
+		showErrorMessage("Check failed: " + err.Error())
+		return
+	}
+
+	if *reportPath != "" {
+		if err := writeJSONReportFile(*reportPath, result); err != nil {
+			Info.Println("Could not write report:", err)
+			showErrorMessage("Could not write report: " + err.Error())
+		}
+	}
+
+	// show results
+	if result.CatalogWarning != "" {
+		showCatalogWarning(result.CatalogWarning)
+	}
+	outputResults(result.Mappings)
+}
+
+// scanOptionsFromFlags returns the scan options given on the command line
+func scanOptionsFromFlags() (scanOptions, error) {
+	options := scanOptions{
+		Providers:   inventoryProviders,
+		CatalogFile: *catalogPath,
+		RulesFile:   *rulesPath,
+	}
+
+	// offline inventory sources replace the local registry
+	var offlineProviders []inventoryProvider
+	if *inventoryPath != "" {
+		offlineProviders = append(offlineProviders, newFileInventory(*inventoryPath))
+	}
+	if *imagePath != "" {
+		offlineProviders = append(offlineProviders, newImageInventory(*imagePath))
+	}
+	for _, path := range regFilePaths {
+		offlineProviders = append(offlineProviders, newRegFileInventory(path))
+	}
+
+	// offline evaluations only depend on the given files, so that the same
+	// snapshot gives the same results on every machine: the default
+	// configuration and rules files are not read
+	options.Offline = options.CatalogFile != "" || len(offlineProviders) > 0
+	var err error
+	if options.Offline && *configPath == "" {
+		options.Config = defaultConfig()
+	} else {
+		options.Config, err = loadConfig(*configPath)
+		if err != nil {
+			return options, fmt.Errorf("Could not load configuration: %w", err)
+		}
+	}
+	// the exit code of a headless run includes the OS check, registry exports
+	// often contain only the Uninstall keys
+	options.RequireOS = *headless && len(regFilePaths) == 0
+
+	// executables can only be read on the local machine
+	options.FileVersions = len(offlineProviders) == 0 && options.Config.FileVersions.Enabled
+	if len(offlineProviders) > 0 {
+		options.Providers = offlineProviders
+	} else {
+		// portable and server software is only searched on the local machine
+		options.Providers = append([]inventoryProvider(nil), inventoryProviders...)
+		if len(options.Config.Portable.Directories) > 0 {
+			options.Providers = append(options.Providers, newPortableInventory(options.Config.Portable))
+		}
+		if options.Config.ServerSoftware.Enabled {
+			options.Providers = append(options.Providers, newServerInventory(options.Config.ServerSoftware))
+		}
+	}
+
+	if *asOfDate != "" {
+		asOf, err := time.Parse("2006-01-02", *asOfDate)
+		if err != nil {
+			return options, fmt.Errorf("Invalid date for -asof: %w", err)
+		}
+		options.AsOf = asOf
+	}
+
+	return options, nil
+}
+
+// runChecks fetches the Windows version and the installed software from the
+// inventory providers, verifies them against Vergrabber and returns the
+// sorted results (Windows first)
+func runChecks(options scanOptions) (scanResult, error) {
 	var installedSoftwareMappings []installedSoftwareMapping
+	result := scanResult{ScanTime: time.Now(), AsOf: options.AsOf}
+	result.Host, _ = os.Hostname()
+
+	asOf := options.AsOf
+	if asOf.IsZero() {
+		asOf = result.ScanTime
+	}
+
+	var rules []productRule
+	var catalogOverrides []catalogOverride
+	var err error
+	if options.Offline && options.RulesFile == "" {
+		rules, catalogOverrides, err = parseProductRules(embeddedRules)
+	} else {
+		rules, catalogOverrides, err = loadProductRules(options.RulesFile)
+	}
+	if err != nil {
+		return result, fmt.Errorf("Could not load product rules: %w", err)
+	}
 
 	// fetch Windows version
-	windowsVersion, err := getWindowsVersion()
+	windowsVersion, err := inventoryWindowsVersion(options.Providers)
+	if err != nil && options.RequireOS {
+		return result, fmt.Errorf("Error getting Windows Version: %w", err)
+	}
 	checkWindowsVersionError(windowsVersion, err)
 
 	// fetch installed software
-	foundSoftware, err := getInstalledSoftware()
-	if err == nil {
-		for key, soft := range foundSoftware {
-			Trace.Printf("%s: %s %s (%s)", key, soft.DisplayName, soft.DisplayVersion, soft.Publisher)
-		}
-	} else {
-		return
+	foundSoftware, err := collectInventory(options.Providers)
+	if err != nil {
+		return result, err
+	}
+	mergeServerInstallations(foundSoftware)
+	if options.FileVersions {
+		applyFileVersions(foundSoftware)
+	}
+	for key, soft := range foundSoftware {
+		Trace.Printf("%s: %s %s (%s)", key, soft.DisplayName, soft.DisplayVersion, soft.Publisher)
 	}
 
 	// fetch software current release information from Vergrabber
-	softwareReleaseStatii := getSoftwareVersionsFromVergrabber()
+	var catalog vergrabberCatalog
+	if options.CatalogFile != "" {
+		catalog, err = loadVergrabberFile(options.Config.Catalog, options.CatalogFile, asOf)
+	} else {
+		catalog, err = getSoftwareVersionsFromVergrabber(options.Config.Catalog, asOf)
+	}
+	if err != nil {
+		return result, err
+	}
+	softwareReleaseStatii := catalog.Releases
+	result.CatalogUpdated = catalog.Updated
+	result.CatalogWarning = catalog.Warning
 
 	// get mappings between installed software and currentReleases
-	installedSoftwareMappings = verifyInstalledSoftwareVersions(foundSoftware, softwareReleaseStatii)
+	var matcher *catalogMatcher
+	if options.Config.CatalogMatching.Enabled {
+		matcher = newCatalogMatcher(softwareReleaseStatii, catalogOverrides, options.Config.CatalogMatching.MinConfidence)
+	}
+	installedSoftwareMappings = verifyInstalledSoftwareVersions(foundSoftware, softwareReleaseStatii, rules, matcher, options.Config.Channels, asOf)
+	disambiguateInstances(installedSoftwareMappings)
+	for i := range installedSoftwareMappings {
+		applyEndOfLife(&installedSoftwareMappings[i], asOf, options.Config.EndOfLife.WarningDays)
+	}
 
 	// sort installed software mappings
 	sort.Slice(installedSoftwareMappings, func(i, j int) bool {
-		if installedSoftwareMappings[i].Status < installedSoftwareMappings[j].Status {
-			return true
-		} else if installedSoftwareMappings[i].Status > installedSoftwareMappings[j].Status {
-			return false
-		} else {
-			return strings.ToUpper(installedSoftwareMappings[i].Name) < strings.ToUpper(installedSoftwareMappings[j].Name)
-		}
+		return installedSoftwareMappings[i].less(installedSoftwareMappings[j])
 	})
 
-	// verify OS patch level against Vergrabber
-	windowsMapping := verifyOSPatchlevel(windowsVersion, softwareReleaseStatii)
+	// verify OS patch level against Vergrabber (offline evaluations only use
+	// the builds of the given catalog, the local build history is neither
+	// read nor updated)
+	history := buildHistory{}
+	if !options.Offline {
+		history = readBuildHistory()
+	}
+	if history.record(softwareReleaseStatii) && !options.Offline {
+		if err := writeBuildHistory(history); err != nil {
+			Info.Println("Could not write " + buildHistoryFile + ": " + err.Error())
+		}
+	}
+	windowsMapping := verifyOSPatchlevel(windowsVersion, softwareReleaseStatii, history)
+	applyEndOfLife(&windowsMapping, asOf, options.Config.EndOfLife.WarningDays)
 
 	// create Combined Mapping for Windows itself and installed software
 	newMappings := make([]installedSoftwareMapping, 0)
 	newMappings = append(newMappings, windowsMapping)
-	installedSoftwareMappings = append(newMappings, installedSoftwareMappings...)
+	result.Mappings = append(newMappings, installedSoftwareMappings...)
 
-	// show results
-	outputResults(installedSoftwareMappings)
+	return result, nil
+}
 
+// showErrorMessage shows an error dialog, or writes the message to stderr
+// in headless mode
+func showErrorMessage(message string) {
+	if *headless {
+		fmt.Fprintln(os.Stderr, "Error:", message)
+		return
+	}
+	dialog.Message("%s", message).Title("Error").Error()
+}
+
+// showInfoMessage shows an info dialog, or writes the message to stderr
+// in headless mode
+func showInfoMessage(message string) {
+	if *headless {
+		fmt.Fprintln(os.Stderr, "Info:", message)
+		return
+	}
+	dialog.Message("%s", message).Title("Info").Info()
 }
 
 // updates the exe file (only)
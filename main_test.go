@@ -0,0 +1,191 @@
+// Update Checker
+// Copyright (C) 2020-22  Florian Probst
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestMain(m *testing.M) {
+	Trace = log.New(io.Discard, "", 0)
+	Info = log.New(io.Discard, "", 0)
+	os.Exit(m.Run())
+}
+
+func TestRunChecksOffline(t *testing.T) {
+	options := scanOptions{
+		Providers:   []inventoryProvider{newFileInventory("testdata/inventory.json")},
+		CatalogFile: "testdata/vergrabber.json",
+		AsOf:        time.Date(2022, 1, 31, 0, 0, 0, 0, time.UTC),
+		Config:      defaultConfig(),
+		Offline:     true,
+	}
+	// KeePass and Notepad++ have no product rule
+	options.Config.CatalogMatching.Enabled = true
+	result, err := runChecks(options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]struct {
+		status softwareStatus
+		reason statusReason
+	}{
+		"Microsoft Windows 10 21H2":         {StatusOutdated, ReasonUpdateAvailable},
+		"Adobe Flash Player 32 NPAPI":       {StatusOutdated, ReasonEndOfLife},
+		"Google Chrome":                     {StatusOutdated, ReasonUpdateAvailable},
+		"Java 8 Update 301":                 {StatusOutdated, ReasonUpdateAvailable},
+		"Mozilla Thunderbird (x64 de)":      {StatusOutdated, ReasonUpdateAvailable},
+		"Notepad++ (64-bit x64)":            {StatusOutdated, ReasonNoCatalogBranch},
+		"7-Zip 21.07 (x64)":                 {StatusUpToDate, ReasonCurrent},
+		"Adobe Acrobat Reader DC - Deutsch": {StatusUpToDate, ReasonCurrent},
+		"KeePass Password Safe 2.50":        {StatusUpToDate, ReasonCurrent},
+		"LibreOffice 7.1.8.1":               {StatusUpToDate, ReasonCurrent},
+		"Mozilla Firefox (x64 en-US)":       {StatusUpToDate, ReasonCurrent},
+		"VeraCrypt":                         {StatusUpToDate, ReasonCurrent},
+		"Java Auto Updater":                 {StatusUnknown, ReasonIgnored},
+		"Some Tool":                         {StatusUnknown, ReasonNotTracked},
+	}
+	if len(result.Mappings) != len(want) {
+		t.Errorf("%d mappings, want %d", len(result.Mappings), len(want))
+	}
+	for _, mapping := range result.Mappings {
+		expected, found := want[mapping.InstalledSoftware.DisplayName]
+		if !found {
+			t.Errorf("unexpected mapping %q", mapping.InstalledSoftware.DisplayName)
+			continue
+		}
+		if mapping.Status != expected.status || mapping.Reason != expected.reason {
+			t.Errorf("%s: status %s (%s), want %s (%s)", mapping.InstalledSoftware.DisplayName,
+				statusString(mapping.Status), mapping.Reason, statusString(expected.status), expected.reason)
+		}
+	}
+	if name := result.Mappings[0].InstalledSoftware.DisplayName; name != "Microsoft Windows 10 21H2" {
+		t.Errorf("first mapping %q, want Windows", name)
+	}
+	if detail := result.Mappings[0].Detail; detail != "at least 1 cumulative update behind" {
+		t.Errorf("Windows detail %q", detail)
+	}
+
+	if code := exitCode(result); code != ExitOutdated {
+		t.Errorf("exit code %d, want %d", code, ExitOutdated)
+	}
+	var upToDate scanResult
+	for _, mapping := range result.Mappings {
+		if mapping.Status != StatusOutdated {
+			upToDate.Mappings = append(upToDate.Mappings, mapping)
+		}
+	}
+	if code := exitCode(upToDate); code != ExitUpToDate {
+		t.Errorf("exit code without outdated software %d, want %d", code, ExitUpToDate)
+	}
+}
+
+func TestRunChecksOfflineIgnoresLocalState(t *testing.T) {
+	inventory, err := filepath.Abs("testdata/inventory.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	catalog, err := filepath.Abs("testdata/vergrabber.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	chdirTemp(t)
+	// local state that would change the results of the offline evaluation
+	history := []byte(`{"Microsoft Windows 10 21H2": ["19044.1415", "19044.1466"]}`)
+	for file, content := range map[string][]byte{
+		localRulesFile:    []byte("{"),
+		defaultConfigFile: []byte("{"),
+		buildHistoryFile:  history,
+	} {
+		if err := ioutil.WriteFile(file, content, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	defer func(inventory, catalog string) {
+		*inventoryPath, *catalogPath = inventory, catalog
+	}(*inventoryPath, *catalogPath)
+	*inventoryPath, *catalogPath = inventory, catalog
+	options, err := scanOptionsFromFlags()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !options.Offline || !reflect.DeepEqual(options.Config, defaultConfig()) {
+		t.Errorf("offline %t, config %+v, want the default configuration", options.Offline, options.Config)
+	}
+	options.AsOf = time.Date(2022, 1, 31, 0, 0, 0, 0, time.UTC)
+
+	result, err := runChecks(options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if detail := result.Mappings[0].Detail; detail != "at least 1 cumulative update behind" {
+		t.Errorf("Windows detail %q, want the catalog builds only", detail)
+	}
+	if content, err := ioutil.ReadFile(buildHistoryFile); err != nil || string(content) != string(history) {
+		t.Errorf("build history changed: %q, %v", content, err)
+	}
+
+	// without offline sources the local files are used
+	options.Offline = false
+	if _, err := runChecks(options); err == nil {
+		t.Error("invalid local rules file ignored in a local scan")
+	}
+}
+
+func TestMappingOrder(t *testing.T) {
+	java := installedSoftwareComponent{DisplayName: "Java 8 Update 311", DisplayVersion: "8.0.3110.11", Architecture: ArchitectureX86}
+	javaUser, javaRegistry, javaFile := java, java, java
+	javaUser.Scope = ScopeUser
+	javaRegistry.Scope = ScopeMachine
+	javaRegistry.RegistryKey = "HKLM\\SOFTWARE\\WOW6432Node\\Microsoft\\Windows\\CurrentVersion\\Uninstall\\{26A24AE4-039D-4CA4-87B4-2F32180311F0}"
+	javaFile.Scope = ScopeMachine
+	javaFile.FilePath = "D:\\Tools\\jre\\bin\\java.exe"
+	java64 := java
+	java64.Architecture = ArchitectureX64
+	javaNewer := java
+	javaNewer.DisplayVersion = "8.0.3210.7"
+	want := []installedSoftwareMapping{
+		{Name: "Google Chrome", Status: StatusOutdated, Reason: ReasonUpdateAvailable},
+		{Name: "Java", Status: StatusOutdated, Reason: ReasonUpdateAvailable, InstalledSoftware: java64},
+		{Name: "Java", Status: StatusOutdated, Reason: ReasonUpdateAvailable, InstalledSoftware: java},
+		{Name: "Java", Status: StatusOutdated, Reason: ReasonUpdateAvailable, InstalledSoftware: javaFile},
+		{Name: "Java", Status: StatusOutdated, Reason: ReasonUpdateAvailable, InstalledSoftware: javaRegistry},
+		{Name: "Java", Status: StatusOutdated, Reason: ReasonUpdateAvailable, InstalledSoftware: javaUser},
+		{Name: "Java", Status: StatusOutdated, Reason: ReasonUpdateAvailable, InstalledSoftware: javaNewer},
+		{Name: "7-Zip", Status: StatusUpToDate, Reason: ReasonCurrent},
+		{Name: "Some Tool", Status: StatusUnknown, Reason: ReasonNoCatalogEntry},
+		{Name: "Other Tool", Status: StatusUnknown, Reason: ReasonNotTracked},
+	}
+
+	// every rotation of the mappings gives the same order
+	for i := 0; i < len(want); i++ {
+		mappings := append(append([]installedSoftwareMapping(nil), want[i:]...), want[:i]...)
+		sort.Slice(mappings, func(i, j int) bool { return mappings[i].less(mappings[j]) })
+		if !reflect.DeepEqual(mappings, want) {
+			t.Errorf("rotation %d: mappings\n%+v\nwant\n%+v", i, mappings, want)
+		}
+	}
+}
@@ -0,0 +1,160 @@
+// Update Checker
+// Copyright (C) 2020-21  Florian Probst
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// first build number of Windows 11 (Windows 11 still reports major version 10)
+const firstWindows11Build = 22000
+
+// Windows Server releases (long-term servicing) by build number
+var windowsServerReleases = map[string]string{
+	"14393": "2016",
+	"17763": "2019",
+	"20348": "2022",
+	"26100": "2025",
+}
+
+// Windows 10/11 LTSC (LTSB) releases by build number
+var windowsLTSCReleases = map[string]string{
+	"10240": "2015",
+	"14393": "2016",
+	"17763": "2019",
+	"19044": "2021",
+	"26100": "2024",
+}
+
+// windowsRelease identifies a Windows release and its entries in Vergrabber
+type windowsRelease struct {
+	Name        string   // e.g. "Microsoft Windows 11" or "Microsoft Windows Server 2022"
+	Product     string   // Vergrabber product name, e.g. "Microsoft Windows Server"
+	Release     string   // e.g. "Microsoft Windows 11 21H2"
+	Category    string   // Vergrabber category, "client" or "server"
+	CatalogKeys []string // Vergrabber keys to try, in order of preference
+	LTSC        bool     // long-term servicing release, the end of life of other entries does not apply
+}
+
+// identifyWindowsRelease maps the Windows version to Windows 10, Windows 11,
+// LTSC or Windows Server. Returns false for Windows 8 and older.
+func identifyWindowsRelease(windowsVersion WindowsVersion) (windowsRelease, bool) {
+	if windowsVersion.CurrentMajorVersionNumber != 10 {
+		return windowsRelease{}, false
+	}
+
+	if isWindowsServer(windowsVersion) {
+		release := windowsRelease{Name: "Microsoft Windows Server", Product: "Microsoft Windows Server", Category: "server"}
+		if year, ok := windowsServerReleases[windowsVersion.CurrentBuild]; ok {
+			// long-term servicing release, e.g. Server 2019
+			release.Name += " " + year
+			release.Release = release.Name
+			release.CatalogKeys = []string{release.Name}
+		} else {
+			// semi-annual or annual channel release, e.g. Server 1909 or 23H2
+			release.Release = release.Name + " " + windowsVersion.ReleaseID
+			release.CatalogKeys = []string{release.Release}
+		}
+		return release, true
+	}
+
+	release := windowsRelease{Name: "Microsoft Windows 10", Category: "client"}
+	build, _ := strconv.Atoi(windowsVersion.CurrentBuild)
+	if build >= firstWindows11Build {
+		release.Name = "Microsoft Windows 11"
+	}
+	release.Product = release.Name
+	release.Release = release.Name + " " + windowsVersion.ReleaseID
+	release.CatalogKeys = []string{release.Release}
+
+	if year, ok := windowsLTSCReleases[windowsVersion.CurrentBuild]; ok && isWindowsLTSC(windowsVersion) {
+		// LTSC shares its build (and its cumulative updates) with the
+		// general availability release, which is tried second
+		release.Release = release.Name + " LTSC " + year
+		release.CatalogKeys = []string{release.Release, release.Name + " " + windowsVersion.ReleaseID}
+		release.LTSC = true
+	}
+
+	return release, true
+}
+
+// isWindowsServer checks if the Windows version is a server edition
+func isWindowsServer(windowsVersion WindowsVersion) bool {
+	return strings.HasPrefix(windowsVersion.InstallationType, "Server") ||
+		strings.HasPrefix(windowsVersion.EditionID, "Server") ||
+		strings.Contains(windowsVersion.ProductName, "Server")
+}
+
+// isWindowsLTSC checks if the Windows version is a long-term servicing
+// edition (EditionID EnterpriseS, EnterpriseSN, IoTEnterpriseS, ...)
+func isWindowsLTSC(windowsVersion WindowsVersion) bool {
+	return strings.Contains(windowsVersion.EditionID, "EnterpriseS") ||
+		strings.Contains(windowsVersion.ProductName, "LTSC") ||
+		strings.Contains(windowsVersion.ProductName, "LTSB")
+}
+
+// findWindowsCatalogEntry returns the Vergrabber entry of the Windows
+// release. If none of its keys is found, the entry of the same category
+// with the same build number is used (e.g. Windows 10 21H2 and LTSC 2021
+// share build 19044). An LTSC release only takes the build from the entry
+// of another release, not its end of life.
+func findWindowsCatalogEntry(release windowsRelease, windowsVersion WindowsVersion, softwareReleaseStatii map[string]softwareReleaseStatus) (softwareReleaseStatus, bool) {
+	key, found := findWindowsCatalogKey(release, windowsVersion, softwareReleaseStatii)
+	if !found {
+		return softwareReleaseStatus{}, false
+	}
+	status := softwareReleaseStatii[key]
+	if release.LTSC && key != release.Release {
+		status.Ends = ""
+	}
+	return status, true
+}
+
+// findWindowsCatalogKey returns the Vergrabber key of the entry of the
+// Windows release (see findWindowsCatalogEntry)
+func findWindowsCatalogKey(release windowsRelease, windowsVersion WindowsVersion, softwareReleaseStatii map[string]softwareReleaseStatus) (string, bool) {
+	for _, key := range release.CatalogKeys {
+		if _, ok := softwareReleaseStatii[key]; ok {
+			return key, true
+		}
+	}
+
+	var keys []string
+	for key, status := range softwareReleaseStatii {
+		if status.Category == release.Category &&
+			strings.HasPrefix(status.Name, "Microsoft Windows") &&
+			strings.HasPrefix(status.Version, windowsVersion.CurrentBuild+".") {
+			keys = append(keys, key)
+		}
+	}
+	if len(keys) == 0 {
+		return "", false
+	}
+
+	// prefer entries of the same product
+	sort.Slice(keys, func(i, j int) bool {
+		iSame := softwareReleaseStatii[keys[i]].Name == release.Product
+		jSame := softwareReleaseStatii[keys[j]].Name == release.Product
+		if iSame != jSame {
+			return iSame
+		}
+		return keys[i] < keys[j]
+	})
+	return keys[0], true
+}
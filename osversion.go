@@ -0,0 +1,108 @@
+// Update Checker
+// Copyright (C) 2020-22  Florian Probst
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import "errors"
+
+// WindowsVersion can hold the relevant Major, Minor and so on version numbers of Windows (10)
+type WindowsVersion struct {
+	CurrentMajorVersionNumber uint64 `json:"currentMajorVersionNumber"`
+	UBR                       uint64 `json:"ubr"`
+	CurrentMinorVersionNumber uint64 `json:"currentMinorVersionNumber"`
+	CurrentBuild              string `json:"currentBuild"`
+	ReleaseID                 string `json:"releaseID"`
+	ProductName               string `json:"productName"`
+	EditionID                 string `json:"editionID,omitempty"`        // e.g. "EnterpriseS", empty if unknown
+	InstallationType          string `json:"installationType,omitempty"` // e.g. "Server", empty if unknown
+}
+
+// registryValueReader reads values of a registry key (implemented by
+// registry.Key)
+type registryValueReader interface {
+	GetStringValue(name string) (val string, valtype uint32, err error)
+	GetIntegerValue(name string) (val uint64, valtype uint32, err error)
+}
+
+// readWindowsVersion reads the Windows version numbers from the values of
+// the key "SOFTWARE\Microsoft\Windows NT\CurrentVersion". On errors the
+// values read so far are returned.
+func readWindowsVersion(k registryValueReader) (windowsVersion WindowsVersion, err error) {
+	windowsVersion.ProductName, _, err = k.GetStringValue("ProductName")
+	if err != nil {
+		return WindowsVersion{}, errors.New("Could not get version information from registry - ProductName")
+	}
+
+	// optional values, not available on older Windows versions
+	windowsVersion.EditionID, _, _ = k.GetStringValue("EditionID")
+	windowsVersion.InstallationType, _, _ = k.GetStringValue("InstallationType")
+
+	windowsVersion.CurrentBuild, _, err = k.GetStringValue("CurrentBuild")
+	if err != nil {
+		return windowsVersion, errors.New("Could not get version information from registry - CurrentBuild")
+	}
+
+	windowsVersion.CurrentMajorVersionNumber, _, err = k.GetIntegerValue("CurrentMajorVersionNumber")
+	if err != nil {
+		return windowsVersion, errors.New("Could not get version information from registry - CurrentMajorVersionNumber")
+	}
+
+	// since 20H2 MS has messed up version numbering - working around this here
+	// DisplayVersion seems to be new. We take this field, if available, otherwise ReleaseID
+	relDisplayVersion, _, _ := k.GetStringValue("DisplayVersion")
+	if relDisplayVersion != "" {
+		windowsVersion.ReleaseID = relDisplayVersion
+	} else {
+		windowsVersion.ReleaseID, _, err = k.GetStringValue("ReleaseId")
+		if err != nil {
+			return windowsVersion, errors.New("Could not get version information from registry - ReleaseId")
+		}
+	}
+
+	windowsVersion.UBR, _, err = k.GetIntegerValue("UBR")
+	if err != nil {
+		return windowsVersion, errors.New("Could not get version information from registry - UBR")
+	}
+
+	windowsVersion.CurrentMinorVersionNumber, _, err = k.GetIntegerValue("CurrentMinorVersionNumber")
+	if err != nil {
+		return windowsVersion, errors.New("Could not get version information from registry - CurrentMinorVersionNumber")
+	}
+
+	return windowsVersion, nil
+}
+
+func checkWindowsVersionError(windowsVersion WindowsVersion, err error) {
+	if err == nil {
+		Info.Printf("Windows Product Name: %s", windowsVersion.ProductName)
+		Info.Printf("Windows Version: %d.%d.%s.%d",
+			windowsVersion.CurrentMajorVersionNumber,
+			windowsVersion.CurrentMinorVersionNumber,
+			windowsVersion.CurrentBuild, windowsVersion.UBR)
+		Info.Printf("Windows Release ID: %s", windowsVersion.ReleaseID)
+		Info.Printf("Windows Edition: %s (%s)", windowsVersion.EditionID, windowsVersion.InstallationType)
+	} else {
+		if windowsVersion.ProductName != "" {
+			Info.Printf("Windows Product Name: %s", windowsVersion.ProductName)
+			if windowsVersion.CurrentBuild != "" {
+				Info.Printf("Windows Current Build: %s", windowsVersion.CurrentBuild)
+			}
+		} else {
+			Info.Printf("Error getting Windows Version: %s", err)
+			showErrorMessage("Error getting Windows Version: " + err.Error())
+		}
+	}
+}
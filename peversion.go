@@ -0,0 +1,312 @@
+// Update Checker
+// Copyright (C) 2020-22  Florian Probst
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"debug/pe"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// version resources of PE executables (VS_VERSIONINFO), see
+// https://docs.microsoft.com/en-us/windows/win32/menurc/vs-versioninfo
+
+const (
+	peResourceDirectory   = 2  // index of the resource table in the data directories
+	peResourceTypeVersion = 16 // RT_VERSION
+	peResourceMaxDepth    = 3  // type, name and language
+	peFixedFileInfoMagic  = 0xfeef04bd
+	peFixedFileInfoSize   = 52
+	peSubdirectoryBit     = 0x80000000
+)
+
+var (
+	errPENoVersionInfo = errors.New("executable has no version resource")
+	errPECorrupt       = errors.New("corrupt version resource")
+)
+
+// peVersionInfo holds the values of the version resource of an executable
+type peVersionInfo struct {
+	ProductName         string
+	ProductVersion      string // as given in the string table, e.g. "Release 0.76" for PuTTY
+	CompanyName         string
+	FileDescription     string
+	FixedProductVersion string // "a.b.c.d" from VS_FIXEDFILEINFO
+	Architecture        string // ArchitectureX64 or ArchitectureX86, empty for other machines
+}
+
+// readPEVersionInfo reads the version resource of the executable
+func readPEVersionInfo(path string) (peVersionInfo, error) {
+	f, err := pe.Open(path)
+	if err != nil {
+		return peVersionInfo{}, err
+	}
+	defer f.Close()
+	return parsePEVersionInfo(f)
+}
+
+// parsePEVersionInfo finds the version resource in the resource table of the
+// executable and parses it
+func parsePEVersionInfo(f *pe.File) (peVersionInfo, error) {
+	var info peVersionInfo
+	var resourceTable pe.DataDirectory
+	switch header := f.OptionalHeader.(type) {
+	case *pe.OptionalHeader32:
+		if header.NumberOfRvaAndSizes > peResourceDirectory {
+			resourceTable = header.DataDirectory[peResourceDirectory]
+		}
+	case *pe.OptionalHeader64:
+		if header.NumberOfRvaAndSizes > peResourceDirectory {
+			resourceTable = header.DataDirectory[peResourceDirectory]
+		}
+	}
+	switch f.Machine {
+	case pe.IMAGE_FILE_MACHINE_AMD64:
+		info.Architecture = ArchitectureX64
+	case pe.IMAGE_FILE_MACHINE_I386:
+		info.Architecture = ArchitectureX86
+	}
+	if resourceTable.VirtualAddress == 0 || resourceTable.Size == 0 {
+		return info, errPENoVersionInfo
+	}
+
+	resources, err := peSectionData(f, resourceTable.VirtualAddress)
+	if err != nil {
+		return info, err
+	}
+
+	// the version resource is the first entry of type RT_VERSION, with any
+	// name and language
+	offset := uint32(0)
+	id := uint32(peResourceTypeVersion)
+	for depth := 0; depth < peResourceMaxDepth; depth++ {
+		entry, found, err := peResourceEntry(resources, offset, id, depth > 0)
+		if err != nil {
+			return info, err
+		}
+		if !found {
+			return info, errPENoVersionInfo
+		}
+		if (entry&peSubdirectoryBit != 0) != (depth < peResourceMaxDepth-1) {
+			// type and name entries point to directories, language entries to data
+			return info, errPECorrupt
+		}
+		offset = entry &^ peSubdirectoryBit
+	}
+
+	// data entry: RVA and size of the resource data
+	if int64(offset)+8 > int64(len(resources)) {
+		return info, errPECorrupt
+	}
+	dataRVA := binary.LittleEndian.Uint32(resources[offset:])
+	dataSize := binary.LittleEndian.Uint32(resources[offset+4:])
+	data, err := peSectionData(f, dataRVA)
+	if err != nil {
+		return info, err
+	}
+	if int64(dataSize) > int64(len(data)) {
+		return info, errPECorrupt
+	}
+
+	err = parseVersionResource(data[:dataSize], &info)
+	return info, err
+}
+
+// peSectionData returns the data of the section containing the RVA, starting
+// at the RVA
+func peSectionData(f *pe.File, rva uint32) ([]byte, error) {
+	for _, section := range f.Sections {
+		size := section.VirtualSize
+		if size < section.Size {
+			size = section.Size
+		}
+		if rva < section.VirtualAddress || rva >= section.VirtualAddress+size {
+			continue
+		}
+		data, err := section.Data()
+		if err != nil {
+			return nil, fmt.Errorf("could not read section %s: %w", section.Name, err)
+		}
+		if int64(rva-section.VirtualAddress) >= int64(len(data)) {
+			return nil, errPECorrupt
+		}
+		return data[rva-section.VirtualAddress:], nil
+	}
+	return nil, errPECorrupt
+}
+
+// peResourceEntry returns the offset field of the entry of the resource
+// directory at the given offset with the given ID (or of the first entry if
+// first is true)
+func peResourceEntry(resources []byte, offset uint32, id uint32, first bool) (uint32, bool, error) {
+	if int64(offset)+16 > int64(len(resources)) {
+		return 0, false, errPECorrupt
+	}
+	namedEntries := int(binary.LittleEndian.Uint16(resources[offset+12:]))
+	idEntries := int(binary.LittleEndian.Uint16(resources[offset+14:]))
+	entries := resources[offset+16:]
+	if (namedEntries+idEntries)*8 > len(entries) {
+		return 0, false, errPECorrupt
+	}
+
+	for i := 0; i < namedEntries+idEntries; i++ {
+		name := binary.LittleEndian.Uint32(entries[i*8:])
+		if first || name == id {
+			return binary.LittleEndian.Uint32(entries[i*8+4:]), true, nil
+		}
+	}
+	return 0, false, nil
+}
+
+// parseVersionResource reads the fixed file info and the string table of a
+// VS_VERSIONINFO structure. The US English string table is preferred, otherwise
+// the first one is used.
+func parseVersionResource(data []byte, info *peVersionInfo) error {
+	key, value, children, _, err := parseVersionBlock(data)
+	if err != nil {
+		return err
+	}
+	if key != "VS_VERSION_INFO" {
+		return errPECorrupt
+	}
+	if len(value) >= peFixedFileInfoSize && binary.LittleEndian.Uint32(value) == peFixedFileInfoMagic {
+		productVersionMS := binary.LittleEndian.Uint32(value[16:])
+		productVersionLS := binary.LittleEndian.Uint32(value[20:])
+		info.FixedProductVersion = fmt.Sprintf("%d.%d.%d.%d",
+			productVersionMS>>16, productVersionMS&0xffff, productVersionLS>>16, productVersionLS&0xffff)
+	}
+
+	var stringTable map[string]string
+	err = forEachVersionBlock(children, func(key string, value []byte, children []byte) error {
+		if key != "StringFileInfo" {
+			// VarFileInfo
+			return nil
+		}
+		return forEachVersionBlock(children, func(language string, value []byte, children []byte) error {
+			if stringTable != nil && !isUSEnglishStringTable(language) {
+				return nil
+			}
+			table := make(map[string]string)
+			err := forEachVersionBlock(children, func(name string, value []byte, children []byte) error {
+				table[name] = trimVersionString(decodeUTF16String(value))
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			stringTable = table
+			return nil
+		})
+	})
+	if err != nil {
+		return err
+	}
+
+	info.ProductName = stringTable["ProductName"]
+	info.ProductVersion = stringTable["ProductVersion"]
+	info.CompanyName = stringTable["CompanyName"]
+	info.FileDescription = stringTable["FileDescription"]
+	return nil
+}
+
+// forEachVersionBlock calls fn for every block of a list of version blocks
+// (the children of a block)
+func forEachVersionBlock(data []byte, fn func(key string, value []byte, children []byte) error) error {
+	for len(data) > 0 {
+		key, value, children, length, err := parseVersionBlock(data)
+		if err != nil {
+			return err
+		}
+		if err := fn(key, value, children); err != nil {
+			return err
+		}
+		data = data[alignVersionBlock(length, len(data)):]
+	}
+	return nil
+}
+
+// parseVersionBlock parses one block (wLength, wValueLength, wType, szKey,
+// Value, Children) and returns its key, value, children and length
+func parseVersionBlock(data []byte) (key string, value []byte, children []byte, length int, err error) {
+	if len(data) < 6 {
+		return "", nil, nil, 0, errPECorrupt
+	}
+	length = int(binary.LittleEndian.Uint16(data))
+	valueLength := int(binary.LittleEndian.Uint16(data[2:]))
+	textValue := binary.LittleEndian.Uint16(data[4:]) == 1
+	if length < 6 || length > len(data) {
+		return "", nil, nil, 0, errPECorrupt
+	}
+	data = data[:length]
+
+	// zero terminated UTF-16 key
+	keyEnd := 6
+	for keyEnd+1 < length && (data[keyEnd] != 0 || data[keyEnd+1] != 0) {
+		keyEnd += 2
+	}
+	key = decodeUTF16String(data[6:keyEnd])
+	position := alignVersionBlock(keyEnd+2, length)
+
+	if textValue {
+		// length in characters
+		valueLength *= 2
+	}
+	if position+valueLength > length {
+		// some resource compilers count the bytes of text values
+		valueLength = length - position
+	}
+	value = data[position : position+valueLength]
+	children = data[alignVersionBlock(position+valueLength, length):]
+	return key, value, children, length, nil
+}
+
+// alignVersionBlock rounds the position up to the next 32 bit boundary (at
+// most to the end of the data)
+func alignVersionBlock(position int, end int) int {
+	position = (position + 3) &^ 3
+	if position > end {
+		return end
+	}
+	return position
+}
+
+// isUSEnglishStringTable checks the language of a string table, e.g. "040904b0"
+func isUSEnglishStringTable(language string) bool {
+	return strings.HasPrefix(strings.ToLower(language), "0409")
+}
+
+// trimVersionString removes padding from a version resource string
+func trimVersionString(s string) string {
+	return strings.TrimSpace(strings.TrimRight(s, "\x00"))
+}
+
+// version returns the version to compare with the catalog: the product
+// version of the string table if it is a version number, otherwise the fixed
+// product version (e.g. "0.76.0.0" for "Release 0.76")
+func (info peVersionInfo) version() string {
+	version := strings.ReplaceAll(info.ProductVersion, ", ", ".")
+	version = strings.ReplaceAll(version, ",", ".")
+	if version != "" && version[0] >= '0' && version[0] <= '9' {
+		return version
+	}
+	if info.FixedProductVersion != "0.0.0.0" {
+		return info.FixedProductVersion
+	}
+	return info.ProductVersion
+}
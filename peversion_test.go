@@ -0,0 +1,137 @@
+// Update Checker
+// Copyright (C) 2020-22  Florian Probst
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"bytes"
+	"debug/pe"
+	"errors"
+	"io/ioutil"
+	"testing"
+)
+
+// the executables in testdata/pe only consist of headers and a resource (or
+// code) section
+func TestReadPEVersionInfo(t *testing.T) {
+	tests := []struct {
+		path    string
+		info    peVersionInfo
+		version string
+	}{
+		{
+			"testdata/pe/putty.exe",
+			peVersionInfo{
+				ProductName:         "PuTTY suite",
+				ProductVersion:      "Release 0.76",
+				CompanyName:         "Simon Tatham",
+				FileDescription:     "SSH, Telnet and Rlogin client",
+				FixedProductVersion: "0.76.0.0",
+				Architecture:        ArchitectureX64,
+			},
+			"0.76.0.0",
+		},
+		{
+			"testdata/pe/notepad++.exe",
+			peVersionInfo{
+				ProductName:         "Notepad++",
+				ProductVersion:      "8, 1, 9, 0",
+				CompanyName:         "Don HO don.h@free.fr",
+				FileDescription:     "Notepad++",
+				FixedProductVersion: "8.1.9.0",
+				Architecture:        ArchitectureX64,
+			},
+			"8.1.9.0",
+		},
+		{
+			// German string table first, the US English one is used
+			"testdata/pe/veracrypt.exe",
+			peVersionInfo{
+				ProductName:         "VeraCrypt",
+				ProductVersion:      "1.24-Update7",
+				CompanyName:         "IDRIX",
+				FileDescription:     "VeraCrypt",
+				FixedProductVersion: "1.24.0.7",
+				Architecture:        ArchitectureX86,
+			},
+			"1.24-Update7",
+		},
+	}
+	for _, test := range tests {
+		info, err := readPEVersionInfo(test.path)
+		if err != nil {
+			t.Errorf("%s: %s", test.path, err)
+			continue
+		}
+		if info != test.info {
+			t.Errorf("%s: %+v, want %+v", test.path, info, test.info)
+		}
+		if version := info.version(); version != test.version {
+			t.Errorf("%s: version %q, want %q", test.path, version, test.version)
+		}
+	}
+}
+
+func TestReadPEVersionInfoWithoutVersion(t *testing.T) {
+	for path, architecture := range map[string]string{
+		"testdata/pe/noversion.exe": ArchitectureX86, // no resources at all
+		"testdata/pe/icononly.exe":  ArchitectureX64, // resources without RT_VERSION
+	} {
+		info, err := readPEVersionInfo(path)
+		if !errors.Is(err, errPENoVersionInfo) {
+			t.Errorf("%s: error %v, want errPENoVersionInfo", path, err)
+		}
+		if info.Architecture != architecture {
+			t.Errorf("%s: architecture %q, want %q", path, info.Architecture, architecture)
+		}
+	}
+
+	if _, err := readPEVersionInfo("testdata/inventory.json"); err == nil || errors.Is(err, errPENoVersionInfo) {
+		t.Errorf("no executable: error %v", err)
+	}
+}
+
+func TestReadPEVersionInfoTruncated(t *testing.T) {
+	data, err := ioutil.ReadFile("testdata/pe/veracrypt.exe")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for length := 0; length < len(data); length++ {
+		f, err := pe.NewFile(bytes.NewReader(data[:length]))
+		if err != nil {
+			continue
+		}
+		// must not panic, errors are expected
+		parsePEVersionInfo(f)
+	}
+
+	// version resource without string table
+	info := peVersionInfo{}
+	resource := versionResourceOf(t, data)
+	for length := 0; length < len(resource); length++ {
+		parseVersionResource(resource[:length], &info)
+	}
+}
+
+// versionResourceOf returns the VS_VERSIONINFO structure of the executable
+func versionResourceOf(t *testing.T, data []byte) []byte {
+	t.Helper()
+	start := bytes.Index(data, []byte("V\x00S\x00_\x00V\x00E\x00R\x00S\x00I\x00O\x00N\x00_\x00I\x00N\x00F\x00O\x00"))
+	if start < 6 {
+		t.Fatal("no VS_VERSION_INFO")
+	}
+	return data[start-6:]
+}
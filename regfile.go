@@ -0,0 +1,364 @@
+// Update Checker
+// Copyright (C) 2020-21  Florian Probst
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+// registry value types (same values as in golang.org/x/sys/windows/registry,
+// which is only available on Windows)
+const (
+	regSZ       = 1
+	regExpandSZ = 2
+	regBinary   = 3
+	regDWord    = 4
+	regMultiSZ  = 7
+	regQWord    = 11
+)
+
+var (
+	errRegValueNotFound   = errors.New("registry value not found")
+	errRegUnexpectedType  = errors.New("unexpected registry value type")
+	errRegFileUnsupported = errors.New("not a registry export file")
+)
+
+// regValue is a value of a registry key as read from an export or a hive
+type regValue struct {
+	Type uint32
+	Data []byte // raw data, strings are UTF-16LE like in the registry
+}
+
+// regKey is a registry key of an export, it implements registryValueReader
+type regKey struct {
+	Path   string              // full path including the root key, e.g. "HKEY_LOCAL_MACHINE\\SOFTWARE"
+	Values map[string]regValue // keyed by lower case value name, "" is the default value
+}
+
+// regFile holds the keys of a registry export (.reg file)
+type regFile struct {
+	Keys  map[string]*regKey // keyed by lower case path
+	Order []string           // lower case paths in the order of the file
+}
+
+// GetStringValue returns a REG_SZ or REG_EXPAND_SZ value
+func (k *regKey) GetStringValue(name string) (string, uint32, error) {
+	value, ok := k.Values[strings.ToLower(name)]
+	if !ok {
+		return "", 0, errRegValueNotFound
+	}
+	return value.stringValue()
+}
+
+// GetIntegerValue returns a REG_DWORD or REG_QWORD value
+func (k *regKey) GetIntegerValue(name string) (uint64, uint32, error) {
+	value, ok := k.Values[strings.ToLower(name)]
+	if !ok {
+		return 0, 0, errRegValueNotFound
+	}
+	return value.integerValue()
+}
+
+// stringValue returns the string of a REG_SZ or REG_EXPAND_SZ value
+func (value regValue) stringValue() (string, uint32, error) {
+	if value.Type != regSZ && value.Type != regExpandSZ {
+		return "", value.Type, errRegUnexpectedType
+	}
+	return decodeUTF16String(value.Data), value.Type, nil
+}
+
+// integerValue returns the number of a REG_DWORD or REG_QWORD value
+func (value regValue) integerValue() (uint64, uint32, error) {
+	switch {
+	case value.Type == regDWord && len(value.Data) == 4:
+		return uint64(binary.LittleEndian.Uint32(value.Data)), value.Type, nil
+	case value.Type == regQWord && len(value.Data) == 8:
+		return binary.LittleEndian.Uint64(value.Data), value.Type, nil
+	}
+	return 0, value.Type, errRegUnexpectedType
+}
+
+// key returns the key with the given path (case insensitive)
+func (f *regFile) key(path string) (*regKey, bool) {
+	k, ok := f.Keys[strings.ToLower(path)]
+	return k, ok
+}
+
+// parseRegFile parses a registry export as written by regedit or "reg export"
+// (UTF-16LE with BOM for "Windows Registry Editor Version 5.00", UTF-8 or
+// ANSI for REGEDIT4). Deletions ("[-key]" and "value"=-) remove the key
+// with its sub keys or the value if they were defined before in the file.
+func parseRegFile(content []byte) (*regFile, error) {
+	text, err := decodeRegFileText(content)
+	if err != nil {
+		return nil, err
+	}
+
+	lines := strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+	header := ""
+	firstLine := 0
+	for firstLine < len(lines) && header == "" {
+		header = strings.TrimSpace(lines[firstLine])
+		firstLine++
+	}
+	unicode := header == "Windows Registry Editor Version 5.00"
+	if !unicode && header != "REGEDIT4" {
+		return nil, errRegFileUnsupported
+	}
+
+	file := &regFile{Keys: map[string]*regKey{}}
+	var current *regKey
+	for lineNumber := firstLine; lineNumber < len(lines); lineNumber++ {
+		line := strings.TrimSpace(lines[lineNumber])
+		startLine := lineNumber + 1
+
+		// hex values are continued with a trailing backslash
+		for strings.HasSuffix(line, "\\") && !strings.HasPrefix(line, "[") && lineNumber+1 < len(lines) && isHexValueLine(line) {
+			lineNumber++
+			line = strings.TrimSuffix(line, "\\") + strings.TrimSpace(lines[lineNumber])
+		}
+
+		switch {
+		case line == "" || strings.HasPrefix(line, ";"):
+			continue
+		case strings.HasPrefix(line, "[-"):
+			// deleted key, its values are ignored
+			current = nil
+			file.deleteKey(strings.TrimSuffix(line[2:], "]"))
+		case strings.HasPrefix(line, "["):
+			if !strings.HasSuffix(line, "]") {
+				return nil, fmt.Errorf("line %d: invalid key %s", startLine, line)
+			}
+			path := line[1 : len(line)-1]
+			lowerPath := strings.ToLower(path)
+			if existing, ok := file.Keys[lowerPath]; ok {
+				current = existing
+				continue
+			}
+			current = &regKey{Path: path, Values: map[string]regValue{}}
+			file.Keys[lowerPath] = current
+			file.Order = append(file.Order, lowerPath)
+		default:
+			if current == nil {
+				// value of a deleted key or before the first key
+				continue
+			}
+			name, value, deleted, err := parseRegValueLine(line, unicode)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", startLine, err)
+			}
+			if deleted {
+				delete(current.Values, strings.ToLower(name))
+			} else {
+				current.Values[strings.ToLower(name)] = value
+			}
+		}
+	}
+
+	return file, nil
+}
+
+// deleteKey removes the key and its sub keys
+func (f *regFile) deleteKey(path string) {
+	lowerPath := strings.ToLower(path)
+	order := f.Order[:0]
+	for _, keyPath := range f.Order {
+		if keyPath == lowerPath || strings.HasPrefix(keyPath, lowerPath+"\\") {
+			delete(f.Keys, keyPath)
+			continue
+		}
+		order = append(order, keyPath)
+	}
+	f.Order = order
+}
+
+// decodeRegFileText returns the text of a registry export, detecting
+// UTF-16LE/BE and UTF-8 by the byte order mark
+func decodeRegFileText(content []byte) (string, error) {
+	switch {
+	case bytes.HasPrefix(content, []byte{0xff, 0xfe}):
+		return decodeUTF16(content[2:], binary.LittleEndian)
+	case bytes.HasPrefix(content, []byte{0xfe, 0xff}):
+		return decodeUTF16(content[2:], binary.BigEndian)
+	case bytes.HasPrefix(content, []byte{0xef, 0xbb, 0xbf}):
+		return string(content[3:]), nil
+	case len(content) >= 2 && content[0] != 0 && content[1] == 0:
+		// UTF-16LE without byte order mark
+		return decodeUTF16(content, binary.LittleEndian)
+	}
+	return string(content), nil
+}
+
+// decodeUTF16 decodes UTF-16 text with the given byte order
+func decodeUTF16(content []byte, order binary.ByteOrder) (string, error) {
+	if len(content)%2 != 0 {
+		return "", errors.New("invalid UTF-16 registry export (odd length)")
+	}
+	units := make([]uint16, len(content)/2)
+	for i := range units {
+		units[i] = order.Uint16(content[2*i:])
+	}
+	return string(utf16.Decode(units)), nil
+}
+
+// decodeUTF16String decodes a UTF-16LE registry string without its
+// terminating zeros
+func decodeUTF16String(data []byte) string {
+	units := make([]uint16, len(data)/2)
+	for i := range units {
+		units[i] = binary.LittleEndian.Uint16(data[2*i:])
+	}
+	return strings.TrimRight(string(utf16.Decode(units)), "\x00")
+}
+
+// encodeUTF16String encodes a string as zero terminated UTF-16LE
+func encodeUTF16String(s string) []byte {
+	units := utf16.Encode([]rune(s))
+	data := make([]byte, 2*len(units)+2)
+	for i, unit := range units {
+		binary.LittleEndian.PutUint16(data[2*i:], unit)
+	}
+	return data
+}
+
+// isHexValueLine checks if the line is (the start of) a hex value, which
+// can be continued on the next line
+func isHexValueLine(line string) bool {
+	_, data, err := splitRegValueLine(line)
+	return err == nil && strings.HasPrefix(strings.ToLower(data), "hex")
+}
+
+// splitRegValueLine splits "name"=data (or @=data) into the unescaped name
+// and the data
+func splitRegValueLine(line string) (name string, data string, err error) {
+	if strings.HasPrefix(line, "@=") {
+		return "", line[2:], nil
+	}
+	if !strings.HasPrefix(line, "\"") {
+		return "", "", fmt.Errorf("invalid value %s", line)
+	}
+	name, rest, err := parseRegString(line)
+	if err != nil {
+		return "", "", err
+	}
+	if !strings.HasPrefix(rest, "=") {
+		return "", "", fmt.Errorf("missing = after value name %s", name)
+	}
+	return name, rest[1:], nil
+}
+
+// parseRegString parses a quoted string with \\ and \" escapes at the start
+// of s and returns the rest of s
+func parseRegString(s string) (value string, rest string, err error) {
+	var sb strings.Builder
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			if i+1 < len(s) {
+				i++
+			}
+			sb.WriteByte(s[i])
+		case '"':
+			return sb.String(), s[i+1:], nil
+		default:
+			sb.WriteByte(s[i])
+		}
+	}
+	return "", "", fmt.Errorf("unterminated string %s", s)
+}
+
+// parseRegValueLine parses one (joined) value line of a registry export
+func parseRegValueLine(line string, unicode bool) (name string, value regValue, deleted bool, err error) {
+	name, data, err := splitRegValueLine(line)
+	if err != nil {
+		return "", value, false, err
+	}
+	data = strings.TrimSpace(data)
+	lowerData := strings.ToLower(data)
+
+	switch {
+	case data == "-":
+		return name, value, true, nil
+
+	case strings.HasPrefix(data, "\""):
+		s, rest, err := parseRegString(data)
+		if err != nil {
+			return "", value, false, err
+		}
+		if strings.TrimSpace(rest) != "" && !strings.HasPrefix(strings.TrimSpace(rest), ";") {
+			return "", value, false, fmt.Errorf("unexpected data after string value %s", name)
+		}
+		return name, regValue{Type: regSZ, Data: encodeUTF16String(s)}, false, nil
+
+	case strings.HasPrefix(lowerData, "dword:"):
+		n, err := strconv.ParseUint(strings.TrimSpace(data[len("dword:"):]), 16, 32)
+		if err != nil {
+			return "", value, false, fmt.Errorf("invalid dword value %s: %w", name, err)
+		}
+		value = regValue{Type: regDWord, Data: make([]byte, 4)}
+		binary.LittleEndian.PutUint32(value.Data, uint32(n))
+		return name, value, false, nil
+
+	case strings.HasPrefix(lowerData, "hex"):
+		valueType := uint64(regBinary)
+		rest := data[len("hex"):]
+		if strings.HasPrefix(rest, "(") {
+			end := strings.Index(rest, ")")
+			if end < 0 {
+				return "", value, false, fmt.Errorf("invalid hex value type of %s", name)
+			}
+			valueType, err = strconv.ParseUint(rest[1:end], 16, 32)
+			if err != nil {
+				return "", value, false, fmt.Errorf("invalid hex value type of %s: %w", name, err)
+			}
+			rest = rest[end+1:]
+		}
+		if !strings.HasPrefix(rest, ":") {
+			return "", value, false, fmt.Errorf("invalid hex value %s", name)
+		}
+		raw, err := parseRegHexBytes(rest[1:])
+		if err != nil {
+			return "", value, false, fmt.Errorf("invalid hex value %s: %w", name, err)
+		}
+		value = regValue{Type: uint32(valueType), Data: raw}
+		if !unicode && (value.Type == regSZ || value.Type == regExpandSZ || value.Type == regMultiSZ) {
+			// REGEDIT4 stores strings as 8 bit characters
+			value.Data = encodeUTF16String(strings.TrimRight(string(raw), "\x00"))
+		}
+		return name, value, false, nil
+	}
+
+	return "", value, false, fmt.Errorf("unsupported data of value %s", name)
+}
+
+// parseRegHexBytes parses comma separated hex bytes ("01,ff,00")
+func parseRegHexBytes(s string) ([]byte, error) {
+	s = strings.Map(func(r rune) rune {
+		if r == ' ' || r == '\t' || r == ',' {
+			return -1
+		}
+		return r
+	}, s)
+	return hex.DecodeString(s)
+}
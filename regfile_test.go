@@ -0,0 +1,141 @@
+// Update Checker
+// Copyright (C) 2020-22  Florian Probst
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"testing"
+)
+
+const testUninstallKey = "HKEY_LOCAL_MACHINE\\" + uninstallKeyPath
+
+func readTestRegFile(t *testing.T, path string) *regFile {
+	t.Helper()
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file, err := parseRegFile(content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+// testRegKey returns the key of the export, failing the test if it is missing
+func testRegKey(t *testing.T, file *regFile, path string) *regKey {
+	t.Helper()
+	k, ok := file.key(path)
+	if !ok {
+		t.Fatalf("key %s not found", path)
+	}
+	return k
+}
+
+// checkRegString checks a string value and its type
+func checkRegString(t *testing.T, k *regKey, name string, want string, wantType uint32) {
+	t.Helper()
+	value, valueType, err := k.GetStringValue(name)
+	if err != nil || value != want || valueType != wantType {
+		t.Errorf("%s: %q (type %d, error %v), want %q (type %d)", name, value, valueType, err, want, wantType)
+	}
+}
+
+func TestParseRegFileUTF16(t *testing.T) {
+	file := readTestRegFile(t, "testdata/uninstall_utf16.reg")
+	if len(file.Order) != 7 {
+		t.Errorf("%d keys, want 7: %v", len(file.Order), file.Order)
+	}
+
+	firefox := testRegKey(t, file, testUninstallKey+"\\Mozilla Firefox 96.0.3 (x64 en-US)")
+	checkRegString(t, firefox, "DisplayName", "Mozilla Firefox (x64 en-US)", regSZ)
+	checkRegString(t, firefox, "installlocation", `C:\Program Files\Mozilla Firefox`, regSZ)
+	// hex(2) continued on three lines
+	checkRegString(t, firefox, "DisplayIcon", `%ProgramFiles%\Mozilla Firefox\firefox.exe,0`, regExpandSZ)
+	if size, valueType, err := firefox.GetIntegerValue("EstimatedSize"); size != 0x3a000 || valueType != regDWord || err != nil {
+		t.Errorf("EstimatedSize: %#x (type %d, error %v)", size, valueType, err)
+	}
+	if installTime, valueType, err := firefox.GetIntegerValue("InstallTime"); installTime != 0x019db1ded53e8000 || valueType != regQWord || err != nil {
+		t.Errorf("InstallTime: %#x (type %d, error %v)", installTime, valueType, err)
+	}
+	if _, _, err := firefox.GetIntegerValue("DisplayName"); !errors.Is(err, errRegUnexpectedType) {
+		t.Errorf("DisplayName as integer: error %v", err)
+	}
+	if _, _, err := firefox.GetStringValue("UninstallString"); !errors.Is(err, errRegValueNotFound) {
+		t.Errorf("UninstallString: error %v", err)
+	}
+
+	sevenZip := testRegKey(t, file, "HKEY_LOCAL_MACHINE\\SOFTWARE\\Wow6432Node\\Microsoft\\Windows\\CurrentVersion\\Uninstall\\7-Zip")
+	checkRegString(t, sevenZip, "DisplayVersion", "21.07", regSZ)
+	checkRegString(t, sevenZip, "Publisher", `Igor "Pavlov"`, regSZ)
+	if _, _, err := sevenZip.GetStringValue("Comments"); !errors.Is(err, errRegValueNotFound) {
+		t.Errorf("deleted value Comments: error %v", err)
+	}
+
+	teams := testRegKey(t, file, "HKEY_USERS\\S-1-5-21-1004336348-1177238915-682003330-1001\\Software\\Microsoft\\Windows\\CurrentVersion\\Uninstall\\Teams")
+	checkRegString(t, teams, "", "default", regSZ)
+	// the values of the deleted key that follows must not end up here
+	checkRegString(t, teams, "DisplayName", "Microsoft Teams", regSZ)
+	if multi := teams.Values["multi"]; multi.Type != regMultiSZ || len(multi.Data) != 10 {
+		t.Errorf("Multi: type %d, %d bytes", multi.Type, len(multi.Data))
+	}
+
+	if _, ok := file.key(testUninstallKey + "\\Deleted"); ok {
+		t.Error("deleted key is in the export")
+	}
+}
+
+func TestParseRegFileRegedit4(t *testing.T) {
+	file := readTestRegFile(t, "testdata/uninstall_regedit4.reg")
+	if len(file.Order) != 2 {
+		t.Errorf("%d keys, want 2: %v", len(file.Order), file.Order)
+	}
+
+	notepad := testRegKey(t, file, testUninstallKey+"\\Notepad++")
+	checkRegString(t, notepad, "DisplayName", "Notepad++ (64-bit x64)", regSZ)
+	// 8 bit characters in REGEDIT4, continued on the next line
+	checkRegString(t, notepad, "DisplayIcon", `%ProgramFiles%\Notepad++\notepad++.exe`, regExpandSZ)
+
+	if _, ok := file.key("HKEY_CURRENT_USER\\Software\\Microsoft\\Windows\\CurrentVersion\\Uninstall\\Zoom"); ok {
+		t.Error("deleted key is in the export")
+	}
+	tool := testRegKey(t, file, "hkey_current_user\\software\\microsoft\\windows\\currentversion\\uninstall\\müller tool")
+	checkRegString(t, tool, "DisplayName", "Müller Tool", regSZ)
+}
+
+func TestParseRegFileInvalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{"no header", "[HKEY_LOCAL_MACHINE\\SOFTWARE]\r\n"},
+		{"unterminated key", "REGEDIT4\r\n[HKEY_LOCAL_MACHINE\\SOFTWARE\r\n"},
+		{"invalid dword", "REGEDIT4\r\n[HKEY_LOCAL_MACHINE\\SOFTWARE]\r\n\"Size\"=dword:xyz\r\n"},
+		{"invalid hex", "REGEDIT4\r\n[HKEY_LOCAL_MACHINE\\SOFTWARE]\r\n\"Data\"=hex:0g\r\n"},
+		{"unterminated string", "REGEDIT4\r\n[HKEY_LOCAL_MACHINE\\SOFTWARE]\r\n\"Name\"=\"value\r\n"},
+		{"UTF-16 odd length", "\xff\xfeR\x00E\x00G"},
+	}
+	for _, test := range tests {
+		if _, err := parseRegFile([]byte(test.content)); err == nil {
+			t.Errorf("%s: no error", test.name)
+		}
+	}
+	if _, err := parseRegFile([]byte("Some text")); !errors.Is(err, errRegFileUnsupported) {
+		t.Errorf("text file: error %v, want errRegFileUnsupported", err)
+	}
+}
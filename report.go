@@ -0,0 +1,225 @@
+// Update Checker
+// Copyright (C) 2020-22  Florian Probst
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// reportFormatVersion has to be increased on incompatible changes of the
+// JSON report format. New optional fields and new values of reason, status
+// or endOfLife are compatible (readers ignore what they do not know), removed
+// or renamed fields and changed meanings are not.
+const reportFormatVersion = 1
+
+// jsonReport is the machine-readable representation of a scanResult
+type jsonReport struct {
+	FormatVersion  int               `json:"formatVersion"`
+	Tool           string            `json:"tool"`
+	ToolVersion    string            `json:"toolVersion"`
+	Host           string            `json:"host"`
+	ScanTime       time.Time         `json:"scanTime"`
+	AsOf           string            `json:"asOf,omitempty"`
+	CatalogUpdated string            `json:"catalogUpdated,omitempty"`
+	CatalogWarning string            `json:"catalogWarning,omitempty"`
+	Results        []jsonReportEntry `json:"results"`
+}
+
+// jsonReportEntry represents one installedSoftwareMapping
+type jsonReportEntry struct {
+	Name            string                 `json:"name"`
+	Status          string                 `json:"status"`
+	Reason          string                 `json:"reason"`
+	Explanation     string                 `json:"explanation,omitempty"`
+	Detail          string                 `json:"detail,omitempty"`
+	MatchConfidence int                    `json:"matchConfidence,omitempty"`
+	EndOfLife       endOfLifeStatus        `json:"endOfLife,omitempty"`
+	Installed       jsonReportInstalled    `json:"installed"`
+	Catalog         *jsonReportCatalogItem `json:"catalog,omitempty"`
+}
+
+type jsonReportInstalled struct {
+	DisplayName    string `json:"displayName"`
+	DisplayVersion string `json:"displayVersion"`
+	Publisher      string `json:"publisher"`
+	Scope          string `json:"scope,omitempty"`
+	Architecture   string `json:"architecture,omitempty"`
+
+	InstallDate      string `json:"installDate,omitempty"`
+	InstallLocation  string `json:"installLocation,omitempty"`
+	DisplayIcon      string `json:"displayIcon,omitempty"`
+	UninstallString  string `json:"uninstallString,omitempty"`
+	EstimatedSize    uint64 `json:"estimatedSize,omitempty"`
+	SystemComponent  bool   `json:"systemComponent,omitempty"`
+	ParentKeyName    string `json:"parentKeyName,omitempty"`
+	ReleaseType      string `json:"releaseType,omitempty"`
+	WindowsInstaller bool   `json:"windowsInstaller,omitempty"`
+	RegistryKey      string `json:"registryKey,omitempty"`
+	FilePath         string `json:"filePath,omitempty"`
+	VersionSource    string `json:"versionSource,omitempty"`
+	RegistryVersion  string `json:"registryVersion,omitempty"`
+	Channel          string `json:"channel,omitempty"`
+	Hidden           bool   `json:"hidden,omitempty"`
+}
+
+type jsonReportCatalogItem struct {
+	Name         string `json:"name"`
+	MajorRelease string `json:"majorRelease"`
+	Category     string `json:"category,omitempty"`
+	Version      string `json:"version"`
+	Released     string `json:"released,omitempty"`
+	Ends         string `json:"ends,omitempty"`
+	Stable       bool   `json:"stable"`
+	Latest       bool   `json:"latest"`
+	Edition      string `json:"edition,omitempty"`
+	Product      string `json:"product,omitempty"`
+}
+
+// newJSONReport builds the report for a scan result. Entries are sorted by
+// name, version and installation (see sortKey) so that reports of different
+// runs can be diffed.
+func newJSONReport(result scanResult) jsonReport {
+	report := jsonReport{
+		FormatVersion:  reportFormatVersion,
+		Tool:           "UpdateChecker",
+		ToolVersion:    strings.TrimSpace(version),
+		Host:           result.Host,
+		ScanTime:       result.ScanTime,
+		CatalogWarning: result.CatalogWarning,
+		Results:        make([]jsonReportEntry, 0, len(result.Mappings)),
+	}
+	if !result.AsOf.IsZero() {
+		report.AsOf = result.AsOf.Format("2006-01-02")
+	}
+	if !result.CatalogUpdated.IsZero() {
+		report.CatalogUpdated = result.CatalogUpdated.Format("2006-01-02")
+	}
+
+	for _, mapping := range result.Mappings {
+		entry := jsonReportEntry{
+			Name:            mapping.Name,
+			Status:          reportStatusString(mapping.Status),
+			Reason:          string(mapping.Reason),
+			Explanation:     mapping.explanation(),
+			Detail:          mapping.Detail,
+			MatchConfidence: mapping.MatchConfidence,
+			EndOfLife:       mapping.EndOfLife,
+			Installed: jsonReportInstalled{
+				DisplayName:    mapping.InstalledSoftware.DisplayName,
+				DisplayVersion: mapping.InstalledSoftware.DisplayVersion,
+				Publisher:      mapping.InstalledSoftware.Publisher,
+				Scope:          mapping.InstalledSoftware.Scope,
+				Architecture:   mapping.InstalledSoftware.Architecture,
+
+				InstallDate:      mapping.InstalledSoftware.InstallDate,
+				InstallLocation:  mapping.InstalledSoftware.InstallLocation,
+				DisplayIcon:      mapping.InstalledSoftware.DisplayIcon,
+				UninstallString:  mapping.InstalledSoftware.UninstallString,
+				EstimatedSize:    mapping.InstalledSoftware.EstimatedSize,
+				SystemComponent:  mapping.InstalledSoftware.SystemComponent,
+				ParentKeyName:    mapping.InstalledSoftware.ParentKeyName,
+				ReleaseType:      mapping.InstalledSoftware.ReleaseType,
+				WindowsInstaller: mapping.InstalledSoftware.WindowsInstaller,
+				RegistryKey:      mapping.InstalledSoftware.RegistryKey,
+				FilePath:         mapping.InstalledSoftware.FilePath,
+				VersionSource:    mapping.InstalledSoftware.VersionSource,
+				RegistryVersion:  mapping.InstalledSoftware.RegistryVersion,
+				Channel:          mapping.InstalledSoftware.Channel,
+				Hidden:           mapping.InstalledSoftware.isHidden(),
+			},
+		}
+		if mapping.MappedStatus != (softwareReleaseStatus{}) {
+			entry.Catalog = &jsonReportCatalogItem{
+				Name:         mapping.MappedStatus.Name,
+				MajorRelease: mapping.MappedStatus.MajorRelease,
+				Category:     mapping.MappedStatus.Category,
+				Version:      mapping.MappedStatus.Version,
+				Released:     mapping.MappedStatus.Released,
+				Ends:         mapping.MappedStatus.Ends,
+				Stable:       mapping.MappedStatus.Stable,
+				Latest:       mapping.MappedStatus.Latest,
+				Edition:      mapping.MappedStatus.Edition,
+				Product:      mapping.MappedStatus.Product,
+			}
+		}
+		report.Results = append(report.Results, entry)
+	}
+
+	sort.Slice(report.Results, func(i, j int) bool {
+		keyI, keyJ := report.Results[i].sortKey(), report.Results[j].sortKey()
+		for k := range keyI {
+			if keyI[k] != keyJ[k] {
+				return keyI[k] < keyJ[k]
+			}
+		}
+		return false
+	})
+
+	return report
+}
+
+// sortKey returns the values the report entries are sorted by: name and
+// version, then scope, architecture, registry key and file path, which differ
+// between installations of the same software (the mappings come from a map,
+// so their order differs from run to run)
+func (entry jsonReportEntry) sortKey() [6]string {
+	return [6]string{
+		strings.ToUpper(entry.Name),
+		entry.Installed.DisplayVersion,
+		entry.Installed.Scope,
+		entry.Installed.Architecture,
+		entry.Installed.RegistryKey,
+		entry.Installed.FilePath,
+	}
+}
+
+// reportStatusString returns the status as used in the JSON report
+func reportStatusString(status softwareStatus) string {
+	switch status {
+	case StatusOutdated:
+		return "outdated"
+	case StatusUpToDate:
+		return "up-to-date"
+	default:
+		return "unknown"
+	}
+}
+
+// writeJSONReport writes the JSON report of a scan result to w
+func writeJSONReport(w io.Writer, result scanResult) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(newJSONReport(result))
+}
+
+// writeJSONReportFile writes the JSON report of a scan result to a file
+func writeJSONReportFile(path string, result scanResult) error {
+	reportFile, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := writeJSONReport(reportFile, result); err != nil {
+		reportFile.Close()
+		return err
+	}
+	return reportFile.Close()
+}
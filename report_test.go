@@ -0,0 +1,214 @@
+// Update Checker
+// Copyright (C) 2020-22  Florian Probst
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testScanResult is a small scan result with mapped, unmapped and duplicate
+// software
+func testScanResult() scanResult {
+	return scanResult{
+		Host:           "PC-0815",
+		ScanTime:       time.Date(2022, 1, 31, 9, 30, 0, 0, time.UTC),
+		AsOf:           time.Date(2022, 1, 31, 0, 0, 0, 0, time.UTC),
+		CatalogUpdated: time.Date(2022, 1, 30, 0, 0, 0, 0, time.UTC),
+		Mappings: []installedSoftwareMapping{
+			{
+				Name:              "Notepad++ (64-bit x64)",
+				Status:            StatusUnknown,
+				Reason:            ReasonNotTracked,
+				InstalledSoftware: installedSoftwareComponent{DisplayName: "Notepad++ (64-bit x64)", DisplayVersion: "8.1.9", Publisher: "Notepad++ Team"},
+			},
+			{
+				Name:   "Mozilla Firefox (x64 en-US)",
+				Status: StatusOutdated,
+				Reason: ReasonUpdateAvailable,
+				Detail: "release channel",
+				InstalledSoftware: installedSoftwareComponent{
+					DisplayName: "Mozilla Firefox (x64 en-US)", DisplayVersion: "96.0.1", Publisher: "Mozilla",
+					Scope: ScopeMachine, Architecture: ArchitectureX64, Channel: "release",
+					RegistryKey: "HKLM\\SOFTWARE\\Microsoft\\Windows\\CurrentVersion\\Uninstall\\Mozilla Firefox 96.0.1 (x64 en-US)",
+				},
+				MappedStatus: softwareReleaseStatus{Name: "Mozilla Firefox", MajorRelease: "96.0", Version: "96.0.3", Released: "2022-01-27", Stable: true, Latest: true},
+			},
+			{
+				Name:              "Java 8 Update 321",
+				Status:            StatusUpToDate,
+				Reason:            ReasonCurrent,
+				EndOfLife:         EndOfLifeSupported,
+				InstalledSoftware: installedSoftwareComponent{DisplayName: "Java 8 Update 321", DisplayVersion: "8.0.3210.7", Publisher: "Oracle Corporation", Architecture: ArchitectureX86},
+				MappedStatus:      softwareReleaseStatus{Name: "Java", MajorRelease: "8", Version: "1.8.0_321", Ends: "2030-12-31", Stable: true},
+			},
+			{
+				Name:              "Java 8 Update 321",
+				Status:            StatusUpToDate,
+				Reason:            ReasonCurrent,
+				EndOfLife:         EndOfLifeSupported,
+				InstalledSoftware: installedSoftwareComponent{DisplayName: "Java 8 Update 321", DisplayVersion: "8.0.3210.7", Publisher: "Oracle Corporation", Architecture: ArchitectureX64},
+				MappedStatus:      softwareReleaseStatus{Name: "Java", MajorRelease: "8", Version: "1.8.0_321", Ends: "2030-12-31", Stable: true},
+			},
+		},
+	}
+}
+
+func TestJSONReportRoundTrip(t *testing.T) {
+	result := testScanResult()
+	var buffer bytes.Buffer
+	if err := writeJSONReport(&buffer, result); err != nil {
+		t.Fatal(err)
+	}
+
+	var report jsonReport
+	if err := json.Unmarshal(buffer.Bytes(), &report); err != nil {
+		t.Fatal(err)
+	}
+	if want := newJSONReport(result); !reflect.DeepEqual(report, want) {
+		t.Errorf("read report\n%+v\nwant\n%+v", report, want)
+	}
+
+	if report.FormatVersion != reportFormatVersion || report.Host != "PC-0815" || report.AsOf != "2022-01-31" || report.CatalogUpdated != "2022-01-30" {
+		t.Errorf("metadata %d %q %q %q", report.FormatVersion, report.Host, report.AsOf, report.CatalogUpdated)
+	}
+	var names []string
+	for _, entry := range report.Results {
+		names = append(names, entry.Name)
+	}
+	if want := []string{"Java 8 Update 321", "Java 8 Update 321", "Mozilla Firefox (x64 en-US)", "Notepad++ (64-bit x64)"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("results %q, want %q", names, want)
+	}
+
+	firefox := report.Results[2]
+	if firefox.Status != "outdated" || firefox.Reason != "update-available" || firefox.Installed.Channel != "release" || firefox.Catalog == nil || firefox.Catalog.Version != "96.0.3" {
+		t.Errorf("Firefox %+v", firefox)
+	}
+	notepad := report.Results[3]
+	if notepad.Status != "unknown" || notepad.Reason != "not-tracked" || notepad.Catalog != nil || notepad.EndOfLife != EndOfLifeUnknown {
+		t.Errorf("Notepad++ %+v", notepad)
+	}
+	if report.Results[0].EndOfLife != EndOfLifeSupported {
+		t.Errorf("Java end of life %v", report.Results[0].EndOfLife)
+	}
+}
+
+// the field names of the report are its interface, unset optional fields are
+// omitted
+func TestJSONReportFields(t *testing.T) {
+	var buffer bytes.Buffer
+	if err := writeJSONReport(&buffer, testScanResult()); err != nil {
+		t.Fatal(err)
+	}
+	var report struct {
+		Fields  map[string]interface{}   `json:"-"`
+		Results []map[string]interface{} `json:"results"`
+	}
+	if err := json.Unmarshal(buffer.Bytes(), &report.Fields); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(buffer.Bytes(), &report); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, field := range []string{"formatVersion", "tool", "toolVersion", "host", "scanTime", "asOf", "catalogUpdated", "results"} {
+		if _, found := report.Fields[field]; !found {
+			t.Errorf("no field %s", field)
+		}
+	}
+	if _, found := report.Fields["catalogWarning"]; found {
+		t.Error("empty catalogWarning written")
+	}
+	if report.Fields["formatVersion"] != float64(1) {
+		t.Errorf("formatVersion %v", report.Fields["formatVersion"])
+	}
+
+	notepad := report.Results[3]
+	for _, field := range []string{"catalog", "detail", "endOfLife", "matchConfidence"} {
+		if _, found := notepad[field]; found {
+			t.Errorf("empty %s written", field)
+		}
+	}
+	java := report.Results[0]
+	if java["endOfLife"] != "supported" || java["reason"] != "current" || java["status"] != "up-to-date" {
+		t.Errorf("Java %v", java)
+	}
+}
+
+func TestJSONReportOrder(t *testing.T) {
+	result := testScanResult()
+	// installations of the same software that differ only in scope, registry
+	// key or file path
+	java := result.Mappings[2]
+	java.InstalledSoftware.Scope = ScopeUser
+	result.Mappings = append(result.Mappings, java)
+	java.InstalledSoftware.Scope = ScopeMachine
+	java.InstalledSoftware.RegistryKey = "HKLM\\SOFTWARE\\WOW6432Node\\Microsoft\\Windows\\CurrentVersion\\Uninstall\\{26A24AE4-039D-4CA4-87B4-2F32180321F0}"
+	result.Mappings = append(result.Mappings, java)
+	java.InstalledSoftware.RegistryKey = ""
+	java.InstalledSoftware.FilePath = "D:\\Tools\\jre\\bin\\java.exe"
+	result.Mappings = append(result.Mappings, java)
+	want := newJSONReport(result)
+
+	// every rotation of the mappings gives the same report
+	for i := 1; i < len(result.Mappings); i++ {
+		rotated := result
+		rotated.Mappings = append(append([]installedSoftwareMapping(nil), result.Mappings[i:]...), result.Mappings[:i]...)
+		if report := newJSONReport(rotated); !reflect.DeepEqual(report, want) {
+			t.Errorf("rotation %d: results\n%+v\nwant\n%+v", i, report.Results, want.Results)
+		}
+	}
+
+	var installations []string
+	for _, entry := range want.Results[:5] {
+		installations = append(installations, strings.Join([]string{entry.Installed.Scope, entry.Installed.Architecture, entry.Installed.RegistryKey, entry.Installed.FilePath}, "|"))
+	}
+	wantInstallations := []string{
+		"|x64||",
+		"|x86||",
+		"machine|x86||" + java.InstalledSoftware.FilePath,
+		"machine|x86|" + result.Mappings[5].InstalledSoftware.RegistryKey + "|",
+		"user|x86||",
+	}
+	if !reflect.DeepEqual(installations, wantInstallations) {
+		t.Errorf("Java installations %q, want %q", installations, wantInstallations)
+	}
+}
+
+func TestWriteJSONReportFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "report.json")
+	if err := writeJSONReportFile(path, testScanResult()); err != nil {
+		t.Fatal(err)
+	}
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(content), "{\n  \"formatVersion\": 1,\n") {
+		t.Errorf("report starts with %.40q", content)
+	}
+
+	if err := writeJSONReportFile(filepath.Join(t.TempDir(), "missing", "report.json"), testScanResult()); err == nil {
+		t.Error("no error for missing directory")
+	}
+}
@@ -0,0 +1,539 @@
+// Update Checker
+// Copyright (C) 2020-22  Florian Probst
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// rulesFormatVersion has to be increased on incompatible changes of the
+// rules file format
+const rulesFormatVersion = 1
+
+// localRulesFile is read (if it exists) in addition to the embedded rules
+const localRulesFile = "UpdateChecker.rules.json"
+
+//go:embed rules.json
+var embeddedRules []byte
+
+// strategies for selecting the catalog entry (branch) for an installed version
+const (
+	// catalog entry of the installed major.minor branch, else the newest entry
+	strategyMinorElseNewest = "minor-else-newest"
+	// catalog entry of the installed major.minor branch, else the one of the
+	// major branch, else the newest entry (unknown if installed is newer)
+	strategyMinorMajorName = "minor-major-name"
+	// newest catalog entry whose key starts with the catalog name (at a word
+	// or version boundary)
+	strategyNewest = "newest"
+	// catalog entry of the longest branch that is a prefix of the installed
+	// version (e.g. 1.1.1 for 1.1.1k), else the newest entry
+	strategyCatalogBranch = "catalog-branch"
+)
+
+// comparison modes of installed and catalog version
+const (
+	compareEqual  = "equal"  // versions have to be equal
+	comparePrefix = "prefix" // installed version has to start with the catalog version (or be newer)
+)
+
+// productRulesFile is the format of the rules files
+type productRulesFile struct {
+	FormatVersion    int               `json:"formatVersion"`
+	Rules            []productRule     `json:"rules"`
+	CatalogOverrides []catalogOverride `json:"catalogOverrides,omitempty"`
+}
+
+// productRule maps installed software to the Vergrabber catalog
+type productRule struct {
+	Name         string           `json:"name"`                   // unique name, local rules replace embedded rules of the same name
+	DisplayName  string           `json:"displayName"`            // regexp matched against the DisplayName
+	Publisher    string           `json:"publisher,omitempty"`    // regexp matched against the Publisher (optional)
+	Catalog      string           `json:"catalog,omitempty"`      // catalog software name, may contain submatches of DisplayName ($1)
+	Strategy     string           `json:"strategy,omitempty"`     // branch selection strategy (see strategy constants)
+	VersionParts int              `json:"versionParts,omitempty"` // only compare the first n parts of the installed version (0 = all)
+	Compare      string           `json:"compare,omitempty"`      // comparison mode (see compare constants)
+	Ignore       bool             `json:"ignore,omitempty"`       // matching software is not verified, only listed as other software (ReasonIgnored)
+	EndOfLife    *ruleEndOfLife   `json:"endOfLife,omitempty"`    // end of life of the product (overrides the catalog)
+	Channels     []releaseChannel `json:"channels,omitempty"`     // release channels, select the catalog branch instead of the strategy
+
+	displayNameRegexp *regexp.Regexp
+	publisherRegexp   *regexp.Regexp
+}
+
+// ruleEndOfLife overrides the end of life date of a product
+type ruleEndOfLife struct {
+	Date    string `json:"date"`              // YYYY-MM-DD
+	Message string `json:"message,omitempty"` // shown instead of the recent version
+}
+
+// loadProductRules returns the rules and catalog overrides from the local
+// rules file (if it exists) followed by the embedded ones. If path is empty
+// the default local rules file is used.
+func loadProductRules(path string) ([]productRule, []catalogOverride, error) {
+	rules, overrides, err := parseProductRules(embeddedRules)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Embedded rules: %w", err)
+	}
+
+	explicitPath := path != ""
+	if !explicitPath {
+		path = localRulesFile
+	}
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		if !explicitPath && errors.Is(err, os.ErrNotExist) {
+			return rules, overrides, nil
+		}
+		return nil, nil, err
+	}
+	localRules, localOverrides, err := parseProductRules(content)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", path, err)
+	}
+	Info.Printf("Using %d local rules and %d catalog overrides from %s", len(localRules), len(localOverrides), path)
+
+	return mergeProductRules(localRules, rules), mergeCatalogOverrides(localOverrides, overrides), nil
+}
+
+// parseProductRules parses a rules file and compiles the regular expressions
+// of its rules and catalog overrides
+func parseProductRules(content []byte) ([]productRule, []catalogOverride, error) {
+	var file productRulesFile
+	if err := json.Unmarshal(content, &file); err != nil {
+		return nil, nil, err
+	}
+	if file.FormatVersion != rulesFormatVersion {
+		return nil, nil, fmt.Errorf("unsupported format version %d", file.FormatVersion)
+	}
+
+	for i := range file.Rules {
+		rule := &file.Rules[i]
+		if rule.Name == "" || rule.DisplayName == "" {
+			return nil, nil, fmt.Errorf("rule %d: name and displayName are mandatory", i)
+		}
+
+		var err error
+		rule.displayNameRegexp, err = regexp.Compile(rule.DisplayName)
+		if err != nil {
+			return nil, nil, fmt.Errorf("rule %s: %w", rule.Name, err)
+		}
+		if rule.Publisher != "" {
+			rule.publisherRegexp, err = regexp.Compile(rule.Publisher)
+			if err != nil {
+				return nil, nil, fmt.Errorf("rule %s: %w", rule.Name, err)
+			}
+		}
+
+		if rule.EndOfLife != nil {
+			if _, err := time.Parse("2006-01-02", rule.EndOfLife.Date); err != nil {
+				return nil, nil, fmt.Errorf("rule %s: endOfLife.date %q is not a date (YYYY-MM-DD)", rule.Name, rule.EndOfLife.Date)
+			}
+		}
+		if !rule.Ignore && (rule.EndOfLife == nil || rule.Catalog != "") {
+			if err := checkStrategy(rule.Strategy, rule.Compare); err != nil {
+				return nil, nil, fmt.Errorf("rule %s: %w", rule.Name, err)
+			}
+		}
+		for j := range rule.Channels {
+			if err := rule.Channels[j].compile(); err != nil {
+				return nil, nil, fmt.Errorf("rule %s: %w", rule.Name, err)
+			}
+		}
+	}
+
+	for i := range file.CatalogOverrides {
+		if err := file.CatalogOverrides[i].compile(); err != nil {
+			return nil, nil, fmt.Errorf("catalog override %d: %w", i, err)
+		}
+	}
+
+	return file.Rules, file.CatalogOverrides, nil
+}
+
+// checkStrategy checks the strategy and comparison mode of a rule
+func checkStrategy(strategy string, compare string) error {
+	switch strategy {
+	case strategyMinorElseNewest, strategyMinorMajorName, strategyNewest, strategyCatalogBranch, strategyJava, strategyAcrobat:
+	default:
+		return fmt.Errorf("unknown strategy %q", strategy)
+	}
+	switch compare {
+	case compareEqual, comparePrefix:
+	default:
+		return fmt.Errorf("unknown compare mode %q", compare)
+	}
+	return nil
+}
+
+// mergeProductRules puts the local rules in front of the embedded rules.
+// Embedded rules with the same name as a local rule are dropped.
+func mergeProductRules(localRules, embedded []productRule) []productRule {
+	localNames := make(map[string]bool)
+	for _, rule := range localRules {
+		localNames[rule.Name] = true
+	}
+
+	merged := append([]productRule{}, localRules...)
+	for _, rule := range embedded {
+		if !localNames[rule.Name] {
+			merged = append(merged, rule)
+		}
+	}
+	return merged
+}
+
+// findProductRule returns the first rule matching the installed component
+func findProductRule(rules []productRule, installedComponent installedSoftwareComponent) (productRule, bool) {
+	for _, rule := range rules {
+		if rule.matches(installedComponent) {
+			return rule, true
+		}
+	}
+	return productRule{}, false
+}
+
+// matches checks DisplayName and Publisher of the installed component
+func (rule productRule) matches(installedComponent installedSoftwareComponent) bool {
+	if !rule.displayNameRegexp.MatchString(installedComponent.DisplayName) {
+		return false
+	}
+	if rule.publisherRegexp != nil && !rule.publisherRegexp.MatchString(installedComponent.Publisher) {
+		return false
+	}
+	return true
+}
+
+// catalogName returns the catalog software name for the installed component
+// (with submatches of the DisplayName regexp expanded)
+func (rule productRule) catalogName(installedComponent installedSoftwareComponent) string {
+	if rule.displayNameRegexp == nil {
+		// rule of an automatic catalog match
+		return rule.Catalog
+	}
+	submatches := rule.displayNameRegexp.FindStringSubmatchIndex(installedComponent.DisplayName)
+	if submatches == nil {
+		return rule.Catalog
+	}
+	return string(rule.displayNameRegexp.ExpandString(nil, rule.Catalog, installedComponent.DisplayName, submatches))
+}
+
+// evaluate maps the installed component to a catalog entry and returns the
+// status of the installed version together with the reason for it
+func (rule productRule) evaluate(installedComponent installedSoftwareComponent, softwareReleaseStatii map[string]softwareReleaseStatus, asOf time.Time) (mappedStatValue softwareReleaseStatus, status softwareStatus, reason statusReason) {
+	if rule.EndOfLife == nil {
+		return rule.evaluateCatalog(installedComponent, softwareReleaseStatii)
+	}
+
+	// the end of life of the rule replaces the one of the catalog (the date
+	// is checked when the rules are loaded)
+	ends, _ := time.Parse("2006-01-02", rule.EndOfLife.Date)
+	if !ends.After(asOf) {
+		return softwareReleaseStatus{
+			Name:     rule.Name,
+			Version:  rule.EndOfLife.Message,
+			Released: rule.EndOfLife.Date,
+			Ends:     rule.EndOfLife.Date,
+		}, StatusOutdated, ReasonEndOfLife
+	}
+	if rule.Catalog == "" {
+		return softwareReleaseStatus{
+			Name:    rule.Name,
+			Version: rule.EndOfLife.Message,
+			Ends:    rule.EndOfLife.Date,
+		}, StatusUpToDate, ReasonSupported
+	}
+	mappedStatValue, status, reason = rule.evaluateCatalog(installedComponent, softwareReleaseStatii)
+	mappedStatValue.Ends = rule.EndOfLife.Date
+	return mappedStatValue, status, reason
+}
+
+// evaluateCatalog compares the installed version with the catalog entry
+// selected by the channel or the strategy of the rule
+func (rule productRule) evaluateCatalog(installedComponent installedSoftwareComponent, softwareReleaseStatii map[string]softwareReleaseStatus) (softwareReleaseStatus, softwareStatus, statusReason) {
+	catalog := rule.catalogName(installedComponent)
+	version := installedComponent.DisplayVersion
+	if rule.VersionParts > 0 {
+		version = versionPrefix(version, rule.VersionParts)
+	}
+
+	if channel, found := rule.channel(installedComponent.Channel); found {
+		return rule.evaluateChannel(channel, version, softwareReleaseStatii, catalog)
+	}
+
+	switch rule.Strategy {
+	case strategyMinorElseNewest:
+		if currentRelease, inStatii := catalogBranch(softwareReleaseStatii, catalog, versionPrefix(version, 2)); inStatii {
+			status, reason := rule.compareWithCatalog(version, currentRelease)
+			return currentRelease, status, reason
+		}
+		// go through all versions and select newest
+		newest, found := newestCatalogEntry(softwareReleaseStatii, func(statName string, statValue softwareReleaseStatus) bool {
+			return statValue.Name == catalog
+		})
+		if !found {
+			return newest, StatusUnknown, ReasonNoCatalogEntry
+		}
+		status, reason := rule.compareWithNewest(version, newest)
+		return newest, status, reason
+
+	case strategyMinorMajorName:
+		for _, branch := range []string{versionPrefix(version, 2), versionPrefix(version, 1)} {
+			if branch == "" {
+				continue
+			}
+			if currentRelease, found := catalogBranch(softwareReleaseStatii, catalog, branch); found {
+				Trace.Printf("Branch %s mapping found for %s", branch, catalog)
+				status, reason := rule.compareWithCatalog(version, currentRelease)
+				return currentRelease, status, reason
+			}
+		}
+		newest, found := newestCatalogEntry(softwareReleaseStatii, func(statName string, statValue softwareReleaseStatus) bool {
+			return statValue.Name == catalog
+		})
+		if !found {
+			return newest, StatusUnknown, ReasonNoCatalogEntry
+		}
+		Trace.Printf("Name only mapping found for %s", newest.Name)
+		status, reason := rule.compareWithNewest(version, newest)
+		return newest, status, reason
+
+	case strategyCatalogBranch:
+		if currentRelease, found := longestCatalogBranch(softwareReleaseStatii, catalog, version); found {
+			Trace.Printf("Branch %s mapping found for %s", currentRelease.MajorRelease, catalog)
+			status, reason := rule.compareWithCatalog(version, currentRelease)
+			return currentRelease, status, reason
+		}
+		newest, found := newestCatalogEntry(softwareReleaseStatii, func(statName string, statValue softwareReleaseStatus) bool {
+			return statValue.Name == catalog
+		})
+		if !found {
+			return newest, StatusUnknown, ReasonNoCatalogEntry
+		}
+		status, reason := rule.compareWithNewest(version, newest)
+		return newest, status, reason
+
+	case strategyJava:
+		return rule.evaluateJava(installedComponent, softwareReleaseStatii, catalog)
+
+	case strategyAcrobat:
+		return rule.evaluateAcrobat(installedComponent, softwareReleaseStatii, catalog)
+
+	case strategyNewest:
+		newest, found := newestCatalogEntry(softwareReleaseStatii, func(statName string, statValue softwareReleaseStatus) bool {
+			return hasCatalogKeyPrefix(statName, catalog)
+		})
+		if !found {
+			return newest, StatusUnknown, ReasonNoCatalogEntry
+		}
+		Trace.Printf("%s mapping found for %s", rule.Name, newest.Name+" "+newest.MajorRelease)
+		status, reason := rule.compareWithCatalog(version, newest)
+		return newest, status, reason
+	}
+
+	return softwareReleaseStatus{}, StatusUnknown, ReasonNoCatalogEntry
+}
+
+// detail returns information on the installed version for strategies that
+// translate it (e.g. vendor and update number of Java)
+func (rule productRule) detail(installedComponent installedSoftwareComponent, mapping installedSoftwareMapping) string {
+	switch rule.Strategy {
+	case strategyJava:
+		return javaDetail(installedComponent, mapping)
+	case strategyAcrobat:
+		return acrobatDetail(installedComponent, mapping)
+	}
+	return ""
+}
+
+// compareWithCatalog compares the installed version with the catalog entry
+// of its branch. An installed version that cannot be parsed is unknown.
+func (rule productRule) compareWithCatalog(version string, currentRelease softwareReleaseStatus) (softwareStatus, statusReason) {
+	installed, current, err := rule.parseVersions(version, currentRelease)
+	if err != nil {
+		return StatusUnknown, ReasonVersionUnparseable
+	}
+
+	if rule.Compare == comparePrefix && installed.hasPrefix(current) {
+		// further parts of the installed version (e.g. the build number of
+		// 23.01.00.0) are not in the catalog
+		return StatusUpToDate, ReasonCurrent
+	}
+	switch c := installed.compare(current); {
+	case c == 0:
+		return StatusUpToDate, ReasonCurrent
+	case c > 0:
+		return StatusUpToDate, ReasonNewerThanCatalog
+	default:
+		return StatusOutdated, ReasonUpdateAvailable
+	}
+}
+
+// compareWithNewest compares the installed version with the newest catalog
+// entry if the branch of the installed version is not in the catalog
+func (rule productRule) compareWithNewest(version string, newest softwareReleaseStatus) (softwareStatus, statusReason) {
+	installed, current, err := rule.parseVersions(version, newest)
+	if err != nil {
+		return StatusUnknown, ReasonVersionUnparseable
+	}
+
+	switch c := installed.compare(current); {
+	case c == 0:
+		return StatusUpToDate, ReasonCurrent
+	case c > 0:
+		// perhaps newer version as we know of (e.g. for Java)
+		return StatusUpToDate, ReasonNewerThanCatalog
+	default:
+		return StatusOutdated, ReasonNoCatalogBranch
+	}
+}
+
+// parseVersions parses the installed version and the version of the catalog entry
+func (rule productRule) parseVersions(version string, currentRelease softwareReleaseStatus) (installed softwareVersion, current softwareVersion, err error) {
+	installed, err = parseVersion(version)
+	if err != nil {
+		Trace.Printf("%s: %s", rule.Name, err)
+		return installed, current, err
+	}
+	current, err = parseVersion(currentRelease.Version)
+	if err != nil {
+		Trace.Printf("%s: catalog %s", rule.Name, err)
+	}
+	return installed, current, err
+}
+
+// catalogBranch returns the catalog entry of a software branch (major release),
+// branches are compared as versions ("23.01" is the same branch as "23.1")
+func catalogBranch(softwareReleaseStatii map[string]softwareReleaseStatus, catalog string, branch string) (softwareReleaseStatus, bool) {
+	if currentRelease, inStatii := softwareReleaseStatii[catalog+" "+branch]; inStatii {
+		return currentRelease, true
+	}
+
+	branchVersion, err := parseVersion(branch)
+	if err != nil {
+		return softwareReleaseStatus{}, false
+	}
+	var keys []string
+	for statName, statValue := range softwareReleaseStatii {
+		if statValue.Name != catalog {
+			continue
+		}
+		if majorRelease, err := parseVersion(statValue.MajorRelease); err == nil && majorRelease.compare(branchVersion) == 0 {
+			keys = append(keys, statName)
+		}
+	}
+	if len(keys) == 0 {
+		return softwareReleaseStatus{}, false
+	}
+	sort.Strings(keys)
+	return softwareReleaseStatii[keys[0]], true
+}
+
+// longestCatalogBranch returns the catalog entry of the branch (major
+// release) with the most parts that is a prefix of the installed version
+func longestCatalogBranch(softwareReleaseStatii map[string]softwareReleaseStatus, catalog string, version string) (softwareReleaseStatus, bool) {
+	installed, err := parseVersion(version)
+	if err != nil {
+		return softwareReleaseStatus{}, false
+	}
+
+	var keys []string
+	for statName, statValue := range softwareReleaseStatii {
+		if statValue.Name == catalog {
+			keys = append(keys, statName)
+		}
+	}
+	// sorted for deterministic results on equal branches
+	sort.Strings(keys)
+
+	var longest softwareReleaseStatus
+	longestParts := 0
+	for _, statName := range keys {
+		statValue := softwareReleaseStatii[statName]
+		branch, err := parseVersion(statValue.MajorRelease)
+		if err != nil || branch.Suffix != "" || !installed.hasPrefix(branch) {
+			continue
+		}
+		if len(branch.Parts) > longestParts {
+			longest = statValue
+			longestParts = len(branch.Parts)
+		}
+	}
+	return longest, longestParts > 0
+}
+
+// newestCatalogEntry returns the catalog entry with the highest version of
+// all entries accepted by the filter
+func newestCatalogEntry(softwareReleaseStatii map[string]softwareReleaseStatus, filter func(statName string, statValue softwareReleaseStatus) bool) (softwareReleaseStatus, bool) {
+	var keys []string
+	for statName, statValue := range softwareReleaseStatii {
+		if filter(statName, statValue) {
+			keys = append(keys, statName)
+		}
+	}
+	// sorted for deterministic results on equal versions
+	sort.Strings(keys)
+
+	var newest softwareReleaseStatus
+	var newestVersion softwareVersion
+	found := false
+	for _, statName := range keys {
+		statValue := softwareReleaseStatii[statName]
+		statVersion, err := parseVersion(statValue.Version)
+		if err != nil {
+			Trace.Printf("Ignoring catalog entry %s: %s", statName, err)
+			continue
+		}
+		if !found || newestVersion.compare(statVersion) < 0 {
+			newest = statValue
+			newestVersion = statVersion
+			found = true
+		}
+	}
+	return newest, found
+}
+
+// hasCatalogKeyPrefix checks if the catalog key starts with prefix at a word
+// or version boundary ("Foo 1" is a prefix of "Foo 1" and "Foo 1.5", but not
+// of "Foo 10")
+func hasCatalogKeyPrefix(key string, prefix string) bool {
+	if !strings.HasPrefix(key, prefix) {
+		return false
+	}
+	if len(key) == len(prefix) || prefix == "" {
+		return true
+	}
+	return key[len(prefix)] == ' ' || isVersionSeparator(key[len(prefix)])
+}
+
+// versionPrefix returns the first n dot separated parts of a version
+func versionPrefix(version string, n int) string {
+	versionSplit := strings.Split(version, ".")
+	if len(versionSplit) > n {
+		versionSplit = versionSplit[:n]
+	}
+	return strings.Join(versionSplit, ".")
+}
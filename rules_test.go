@@ -0,0 +1,279 @@
+// Update Checker
+// Copyright (C) 2020-22  Florian Probst
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// testCatalogStatii returns the software release statii of testdata/vergrabber.json
+func testCatalogStatii(t *testing.T) map[string]softwareReleaseStatus {
+	t.Helper()
+	softwareReleaseStatii, err := parseVergrabberJSON(readTestCatalog(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return softwareReleaseStatii
+}
+
+// ruleTest is an installed version evaluated with an embedded rule
+type ruleTest struct {
+	rule        string
+	displayName string
+	version     string
+	status      softwareStatus
+	reason      statusReason
+}
+
+func checkRuleTests(t *testing.T, tests []ruleTest) {
+	t.Helper()
+	softwareReleaseStatii := testCatalogStatii(t)
+	asOf := time.Date(2022, 1, 31, 0, 0, 0, 0, time.UTC)
+	for _, test := range tests {
+		component := installedSoftwareComponent{DisplayName: test.displayName, DisplayVersion: test.version}
+		_, status, reason := embeddedRule(t, test.rule).evaluate(component, softwareReleaseStatii, asOf)
+		if status != test.status || reason != test.reason {
+			t.Errorf("%s %s: %v (%s), want %v (%s)", test.displayName, test.version, status, reason, test.status, test.reason)
+		}
+	}
+}
+
+func TestEvaluateCompareModes(t *testing.T) {
+	checkRuleTests(t, []ruleTest{
+		{"Google Chrome", "Google Chrome", "97.0.4692.99", StatusUpToDate, ReasonCurrent},
+		{"Google Chrome", "Google Chrome", "97.0.4692.100", StatusUpToDate, ReasonNewerThanCatalog},
+		{"Google Chrome", "Google Chrome", "97.0.4692.71", StatusOutdated, ReasonUpdateAvailable},
+		{"7-Zip", "7-Zip 21.07 (x64)", "21.07.00.0", StatusUpToDate, ReasonCurrent},
+		{"7-Zip", "7-Zip 21.07 (x64)", "21.07.1", StatusUpToDate, ReasonCurrent},
+		{"VeraCrypt", "VeraCrypt", "1.24-Update8", StatusUpToDate, ReasonNewerThanCatalog},
+		{"PuTTY", "PuTTY release 0.76 (64-bit)", "0.76.0.0", StatusUpToDate, ReasonCurrent},
+		{"Mozilla Thunderbird", "Mozilla Thunderbird (x64 de)", "91.5.2", StatusUpToDate, ReasonNewerThanCatalog},
+		{"Mozilla Firefox", "Mozilla Firefox (x64 en-US)", "96.0.4", StatusUpToDate, ReasonNewerThanCatalog},
+		{"Mozilla Firefox", "Mozilla Firefox (x64 en-US)", "96.0.2", StatusOutdated, ReasonUpdateAvailable},
+		{"PostgreSQL", "PostgreSQL 14", "14.1", StatusUpToDate, ReasonCurrent},
+		{"PostgreSQL", "PostgreSQL 14", "14.2", StatusUpToDate, ReasonNewerThanCatalog},
+		{"PostgreSQL", "PostgreSQL 14", "14.0", StatusOutdated, ReasonUpdateAvailable},
+		{"PostgreSQL", "PostgreSQL 13", "13.5", StatusUpToDate, ReasonCurrent},
+	})
+}
+
+// testLocalRules replaces the embedded Firefox rule, adds two rules with an
+// end of life and replaces the MySQL catalog override
+const testLocalRules = `{
+  "formatVersion": 1,
+  "rules": [
+    {"name": "Mozilla Firefox", "displayName": "^Firefox Portable", "catalog": "Mozilla Firefox", "strategy": "minor-else-newest", "compare": "equal"},
+    {"name": "Intranet Client", "displayName": "^Intranet Client", "endOfLife": {"date": "2022-03-31", "message": "replaced by the web client"}},
+    {"name": "Legacy PHP", "displayName": "^Legacy PHP", "catalog": "PHP", "strategy": "catalog-branch", "compare": "equal", "endOfLife": {"date": "2022-12-31"}}
+  ],
+  "catalogOverrides": [
+    {"catalog": "MySQL", "exclude": ["^MySQL Utilities"]},
+    {"catalog": "PuTTY", "disabled": true}
+  ]
+}`
+
+func TestLoadProductRules(t *testing.T) {
+	chdirTemp(t)
+
+	// without local rules file
+	embedded, embeddedOverrides, err := loadProductRules("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(embedded) == 0 || embedded[0].Name != "Java Auto Updater" || len(embeddedOverrides) != 3 {
+		t.Fatalf("%d embedded rules, %d overrides", len(embedded), len(embeddedOverrides))
+	}
+	if _, _, err := loadProductRules("missing.json"); err == nil {
+		t.Error("no error for a missing explicit rules file")
+	}
+
+	// the local rules file of the working directory is used by default
+	if err := ioutil.WriteFile(localRulesFile, []byte(testLocalRules), 0644); err != nil {
+		t.Fatal(err)
+	}
+	rules, overrides, err := loadProductRules("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rules) != len(embedded)+2 {
+		t.Errorf("%d rules, want %d", len(rules), len(embedded)+2)
+	}
+	for i, name := range []string{"Mozilla Firefox", "Intranet Client", "Legacy PHP", "Java Auto Updater"} {
+		if rules[i].Name != name {
+			t.Errorf("rule %d: %s, want %s", i, rules[i].Name, name)
+		}
+	}
+
+	// the local Firefox rule replaces the embedded one
+	tests := map[string]string{
+		"Firefox Portable 96.0":       "Mozilla Firefox",
+		"Mozilla Firefox (x64 en-US)": "",
+		"Intranet Client 4.2":         "Intranet Client",
+		"Google Chrome":               "Google Chrome",
+	}
+	for displayName, name := range tests {
+		rule, found := findProductRule(rules, installedSoftwareComponent{DisplayName: displayName})
+		if rule.Name != name || found != (name != "") {
+			t.Errorf("%s: rule %q, want %q", displayName, rule.Name, name)
+		}
+	}
+
+	if len(overrides) != 4 || overrides[0].Catalog != "MySQL" || overrides[1].Catalog != "PuTTY" || overrides[2].Catalog != "Python" {
+		t.Errorf("overrides %+v", overrides)
+	}
+	if overrides[0].excludeRegexps == nil || !overrides[0].excludeRegexps[0].MatchString("MySQL Utilities 1.6") {
+		t.Error("local MySQL override not compiled")
+	}
+}
+
+func TestLoadProductRulesInvalid(t *testing.T) {
+	tests := map[string]string{
+		"syntax":         `{"formatVersion": 1, "rules": [}`,
+		"format version": `{"formatVersion": 2, "rules": []}`,
+		"no name":        `{"formatVersion": 1, "rules": [{"displayName": "^Foo"}]}`,
+		"regexp":         `{"formatVersion": 1, "rules": [{"name": "Foo", "displayName": "^Foo(", "catalog": "Foo", "strategy": "newest", "compare": "equal"}]}`,
+		"strategy":       `{"formatVersion": 1, "rules": [{"name": "Foo", "displayName": "^Foo", "catalog": "Foo", "strategy": "oldest", "compare": "equal"}]}`,
+		"date":           `{"formatVersion": 1, "rules": [{"name": "Foo", "displayName": "^Foo", "endOfLife": {"date": "31.12.2022"}}]}`,
+		"catalog eol":    `{"formatVersion": 1, "rules": [{"name": "Foo", "displayName": "^Foo", "catalog": "Foo", "endOfLife": {"date": "2022-12-31"}}]}`,
+		"channel":        `{"formatVersion": 1, "rules": [{"name": "Foo", "displayName": "^Foo", "catalog": "Foo", "strategy": "newest", "compare": "equal", "channels": [{"name": "beta", "branch": "newest"}]}]}`,
+		"override":       `{"formatVersion": 1, "rules": [], "catalogOverrides": [{"exclude": ["^Foo"]}]}`,
+	}
+	dir := t.TempDir()
+	for name, content := range tests {
+		path := filepath.Join(dir, name+".json")
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, _, err := loadProductRules(path); err == nil {
+			t.Errorf("%s: no error", name)
+		}
+	}
+}
+
+func TestMergeProductRules(t *testing.T) {
+	local := []productRule{{Name: "B", Catalog: "local"}, {Name: "D"}}
+	embedded := []productRule{{Name: "A"}, {Name: "B", Catalog: "embedded"}, {Name: "C"}}
+	merged := mergeProductRules(local, embedded)
+	var names []string
+	for _, rule := range merged {
+		names = append(names, rule.Name+rule.Catalog)
+	}
+	if want := []string{"Blocal", "D", "A", "C"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("merged %q, want %q", names, want)
+	}
+
+	overrides := mergeCatalogOverrides([]catalogOverride{{Catalog: "MySQL", Disabled: true}}, []catalogOverride{{Catalog: "PHP"}, {Catalog: "MySQL"}})
+	if len(overrides) != 2 || overrides[0].Catalog != "MySQL" || !overrides[0].Disabled || overrides[1].Catalog != "PHP" {
+		t.Errorf("merged overrides %+v", overrides)
+	}
+}
+
+func TestEvaluateEndOfLifeOverride(t *testing.T) {
+	rules, _, err := parseProductRules([]byte(testLocalRules))
+	if err != nil {
+		t.Fatal(err)
+	}
+	softwareReleaseStatii := testCatalogStatii(t)
+
+	tests := []struct {
+		displayName string
+		version     string
+		asOf        time.Time
+		status      softwareStatus
+		reason      statusReason
+		ends        string
+		endOfLife   endOfLifeStatus
+	}{
+		// without catalog product
+		{"Intranet Client", "4.2", time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC), StatusUpToDate, ReasonSupported, "2022-03-31", EndOfLifeSupported},
+		{"Intranet Client", "4.2", time.Date(2022, 1, 31, 0, 0, 0, 0, time.UTC), StatusUpToDate, ReasonSupported, "2022-03-31", EndOfLifeSoon},
+		{"Intranet Client", "4.2", time.Date(2022, 3, 31, 0, 0, 0, 0, time.UTC), StatusOutdated, ReasonEndOfLife, "2022-03-31", EndOfLifeReached},
+		// the date of the rule replaces the one of the catalog (2022-11-28)
+		{"Legacy PHP 7.4", "7.4.27", time.Date(2022, 1, 31, 0, 0, 0, 0, time.UTC), StatusUpToDate, ReasonCurrent, "2022-12-31", EndOfLifeSupported},
+		{"Legacy PHP 7.4", "7.4.26", time.Date(2022, 12, 1, 0, 0, 0, 0, time.UTC), StatusOutdated, ReasonUpdateAvailable, "2022-12-31", EndOfLifeSoon},
+		{"Legacy PHP 7.4", "7.4.27", time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC), StatusOutdated, ReasonEndOfLife, "2022-12-31", EndOfLifeReached},
+	}
+	for _, test := range tests {
+		component := installedSoftwareComponent{DisplayName: test.displayName, DisplayVersion: test.version}
+		rule, found := findProductRule(rules, component)
+		if !found {
+			t.Fatalf("%s: no rule", test.displayName)
+		}
+		mapping := installedSoftwareMapping{Name: test.displayName, InstalledSoftware: component}
+		mapping.MappedStatus, mapping.Status, mapping.Reason = rule.evaluate(component, softwareReleaseStatii, test.asOf)
+		if mapping.Status != test.status || mapping.Reason != test.reason || mapping.MappedStatus.Ends != test.ends {
+			t.Errorf("%s %s as of %s: %v (%s), ends %q, want %v (%s), ends %q", test.displayName, test.version, test.asOf.Format("2006-01-02"),
+				mapping.Status, mapping.Reason, mapping.MappedStatus.Ends, test.status, test.reason, test.ends)
+		}
+		applyEndOfLife(&mapping, test.asOf, 90)
+		if mapping.EndOfLife != test.endOfLife {
+			t.Errorf("%s %s as of %s: end of life %s, want %s", test.displayName, test.version, test.asOf.Format("2006-01-02"), mapping.EndOfLife, test.endOfLife)
+		}
+	}
+}
+
+func TestHasCatalogKeyPrefix(t *testing.T) {
+	tests := []struct {
+		key    string
+		prefix string
+		want   bool
+	}{
+		{"Foo 1", "Foo 1", true},
+		{"Foo 1.5", "Foo 1", true},
+		{"Foo 1-beta", "Foo 1", true},
+		{"Foo 10", "Foo 1", false},
+		{"Foo 10", "Foo", true},
+		{"Foobar 2", "Foo", false},
+		{"Foo", "Foo 1", false},
+		{"Foo 1", "", true},
+	}
+	for _, test := range tests {
+		if got := hasCatalogKeyPrefix(test.key, test.prefix); got != test.want {
+			t.Errorf("hasCatalogKeyPrefix(%q, %q) = %t, want %t", test.key, test.prefix, got, test.want)
+		}
+	}
+}
+
+func TestEvaluateNewest(t *testing.T) {
+	softwareReleaseStatii := map[string]softwareReleaseStatus{
+		"Foo 1.5": {Name: "Foo", MajorRelease: "1.5", Version: "1.5.3"},
+		"Foo 1.4": {Name: "Foo", MajorRelease: "1.4", Version: "1.4.9"},
+		"Foo 10":  {Name: "Foo", MajorRelease: "10", Version: "10.0.2"},
+	}
+	tests := []struct {
+		catalog string
+		version string
+		newest  string
+		status  softwareStatus
+	}{
+		{"Foo 1", "1.5.3", "1.5.3", StatusUpToDate},
+		{"Foo 1", "1.4.9", "1.5.3", StatusOutdated},
+		{"Foo", "1.5.3", "10.0.2", StatusOutdated},
+		{"Foo 10", "10.0.2", "10.0.2", StatusUpToDate},
+	}
+	for _, test := range tests {
+		rule := productRule{Name: "Foo", Catalog: test.catalog, Strategy: strategyNewest, Compare: compareEqual}
+		mapped, status, _ := rule.evaluate(installedSoftwareComponent{DisplayName: "Foo", DisplayVersion: test.version}, softwareReleaseStatii, time.Now())
+		if mapped.Version != test.newest || status != test.status {
+			t.Errorf("%s %s: %s (%v), want %s (%v)", test.catalog, test.version, mapped.Version, status, test.newest, test.status)
+		}
+	}
+}
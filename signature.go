@@ -0,0 +1,171 @@
+// Update Checker
+// Copyright (C) 2020-22  Florian Probst
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/blake2b"
+)
+
+// errCatalogSignature is returned (wrapped) if the signature of vergrabber.json
+// is missing or does not match
+var errCatalogSignature = errors.New("signature verification failed")
+
+// signatureFileExtension is appended to vergrabber.json for its detached signature
+const signatureFileExtension = ".minisig"
+
+// signature verification modes
+const (
+	signatureRequire = "require" // unsigned or badly signed catalogs are rejected
+	signatureWarn    = "warn"    // unsigned or badly signed catalogs are used with a warning
+)
+
+// catalogVerifier checks minisign signatures of vergrabber.json against the
+// configured public keys. A nil verifier accepts everything.
+type catalogVerifier struct {
+	keys     map[[8]byte]ed25519.PublicKey
+	required bool
+}
+
+// newCatalogVerifier returns the verifier for the configured public keys or
+// nil if no keys are configured
+func newCatalogVerifier(cfg catalogConfig) (*catalogVerifier, error) {
+	if len(cfg.PublicKeys) == 0 {
+		return nil, nil
+	}
+
+	verifier := &catalogVerifier{keys: make(map[[8]byte]ed25519.PublicKey)}
+	switch cfg.Signature {
+	case "", signatureRequire:
+		verifier.required = true
+	case signatureWarn:
+	default:
+		return nil, fmt.Errorf("unknown signature mode %q", cfg.Signature)
+	}
+
+	for _, publicKey := range cfg.PublicKeys {
+		keyID, key, err := parseMinisignPublicKey(publicKey)
+		if err != nil {
+			return nil, err
+		}
+		verifier.keys[keyID] = key
+	}
+	return verifier, nil
+}
+
+// enabled checks if signatures are verified at all
+func (v *catalogVerifier) enabled() bool {
+	return v != nil
+}
+
+// check verifies the signature of the catalog content from source. In warn
+// mode a failed verification only results in a warning.
+func (v *catalogVerifier) check(jsonFromVergrabber []byte, signature []byte, source string) (warning string, err error) {
+	if !v.enabled() {
+		return "", nil
+	}
+
+	err = verifyMinisign(v.keys, jsonFromVergrabber, signature)
+	if err == nil {
+		Trace.Println("Signature of vergrabber.json (" + source + ") is valid")
+		return "", nil
+	}
+	err = &catalogError{"verify " + source, fmt.Errorf("%w: %s", errCatalogSignature, err)}
+	Info.Println(err)
+	if v.required {
+		return "", err
+	}
+	return err.Error(), nil
+}
+
+// parseMinisignPublicKey parses a minisign public key, either the content of
+// a minisign.pub file or only its base64 encoded key line
+func parseMinisignPublicKey(publicKey string) (keyID [8]byte, key ed25519.PublicKey, err error) {
+	lines := strings.Split(strings.TrimSpace(publicKey), "\n")
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(lines[len(lines)-1]))
+	if err != nil {
+		return keyID, nil, fmt.Errorf("invalid public key %q: %w", publicKey, err)
+	}
+	if len(raw) != 2+8+ed25519.PublicKeySize || string(raw[:2]) != "Ed" {
+		return keyID, nil, fmt.Errorf("invalid public key %q: not a minisign Ed25519 key", publicKey)
+	}
+	copy(keyID[:], raw[2:10])
+	return keyID, ed25519.PublicKey(raw[10:]), nil
+}
+
+// verifyMinisign verifies a minisign signature file (legacy "Ed" and
+// pre-hashed "ED" signatures), including its trusted comment
+func verifyMinisign(keys map[[8]byte]ed25519.PublicKey, message []byte, signature []byte) error {
+	if len(signature) == 0 {
+		return errors.New("no signature")
+	}
+	lines := strings.Split(strings.ReplaceAll(string(signature), "\r\n", "\n"), "\n")
+	if len(lines) < 4 || !strings.HasPrefix(lines[0], "untrusted comment:") ||
+		!strings.HasPrefix(lines[2], "trusted comment: ") {
+		return errors.New("invalid signature format")
+	}
+
+	sig, err := base64.StdEncoding.DecodeString(strings.TrimSpace(lines[1]))
+	if err != nil || len(sig) != 2+8+ed25519.SignatureSize {
+		return errors.New("invalid signature format")
+	}
+	var keyID [8]byte
+	copy(keyID[:], sig[2:10])
+	key, known := keys[keyID]
+	if !known {
+		return fmt.Errorf("signed with unknown key %s", strings.ToUpper(hex.EncodeToString(reversedBytes(keyID[:]))))
+	}
+
+	signedMessage := message
+	switch string(sig[:2]) {
+	case "Ed":
+	case "ED":
+		hash := blake2b.Sum512(message)
+		signedMessage = hash[:]
+	default:
+		return errors.New("unsupported signature algorithm")
+	}
+	if !ed25519.Verify(key, signedMessage, sig[10:]) {
+		return errors.New("signature does not match")
+	}
+
+	// the global signature covers the signature and the trusted comment
+	trustedComment := strings.TrimPrefix(lines[2], "trusted comment: ")
+	globalSig, err := base64.StdEncoding.DecodeString(strings.TrimSpace(lines[3]))
+	if err != nil || len(globalSig) != ed25519.SignatureSize {
+		return errors.New("invalid signature format")
+	}
+	if !ed25519.Verify(key, append(append([]byte{}, sig[10:]...), trustedComment...), globalSig) {
+		return errors.New("trusted comment signature does not match")
+	}
+	return nil
+}
+
+// reversedBytes returns a reversed copy (minisign shows key ids little endian)
+func reversedBytes(b []byte) []byte {
+	r := make([]byte, len(b))
+	for i := range b {
+		r[len(b)-1-i] = b[i]
+	}
+	return r
+}
@@ -0,0 +1,139 @@
+// Update Checker
+// Copyright (C) 2020-22  Florian Probst
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"crypto/ed25519"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// known answer test: key id 16B847D25E0C913A, Ed25519 seed is the SHA-256 of
+// "Update Checker test key"
+const (
+	testPublicKey = "untrusted comment: minisign public key 16B847D25E0C913A\n" +
+		"RWQ6kQxe0ke4Fghm4o8Qrwt6Zg4aFUd1ZCLQPaysHpvZvyItaAZRhXNB\n"
+	testSignedMessage = "{\"updated\": \"2022-01-30\"}\n"
+
+	// pre-hashed (BLAKE2b-512), the default since minisign 0.10
+	testSignatureHashed = "untrusted comment: signature from minisign secret key\n" +
+		"RUQ6kQxe0ke4FgDGGKV9+/Fkq4zh5SPdzqOzg4Uk4xJ6IX9NWN99ashs6tm7+VFpkF1SIPOxoKLRU/R9tlMY05zTuzIGRzPbWAk=\n" +
+		"trusted comment: timestamp:1643500000\tfile:vergrabber.json\thashed\n" +
+		"O5dy6HRdBlps5QJmD4U5oHY1KL5X19wjFs2tMou4dqZY+jkSH49Tjlvy/QWEaJeK1uQAKD+DZIl+IUEpE5CoBg==\n"
+
+	// legacy, the message itself is signed
+	testSignatureLegacy = "untrusted comment: signature from minisign secret key\n" +
+		"RWQ6kQxe0ke4FlrXfcguVIIUljiflD45BSdQodwuZXzKd8zT9e7o2oV7F36CNlRyxeBf6nsRQoF8toYdayzHIr3MB9w5yboqGAY=\n" +
+		"trusted comment: timestamp:1643500000\tfile:vergrabber.json\n" +
+		"BOtxE3p8Cjg95CuQXlaOfp0/VQEtEW5a73eZbJ/B06aR7qVftdwbg6cmCxLXhBOPYZjJgH7spYQAlcVnofJKDQ==\n"
+
+	// same message, signed with key id 0706050403020177
+	testSignatureOtherKey = "untrusted comment: signature from minisign secret key\n" +
+		"RUR3AQIDBAUGB+LwiokXY3HhLDelQeG4AY2PwCgJNPBeYWS51/0tvaikwUx/eoU6uyfWbLPQh8TpgnXB2gVbW9b78QlKF6DRegs=\n" +
+		"trusted comment: timestamp:1643500000\tfile:vergrabber.json\thashed\n" +
+		"V0M6dYVLuYEnF+4MgYJ8723AEqpZVaSpzYKMjqNUg4IhxQt3atyFZE16AEFLNDxGbLRCy3qZB1/zzMEgqvdlBA==\n"
+)
+
+func testMinisignKeys(t *testing.T) map[[8]byte]ed25519.PublicKey {
+	t.Helper()
+	keyID, key, err := parseMinisignPublicKey(testPublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if keyID != [8]byte{0x3a, 0x91, 0x0c, 0x5e, 0xd2, 0x47, 0xb8, 0x16} {
+		t.Fatalf("key id %X", keyID)
+	}
+	return map[[8]byte]ed25519.PublicKey{keyID: key}
+}
+
+func TestVerifyMinisign(t *testing.T) {
+	keys := testMinisignKeys(t)
+	tests := []struct {
+		name      string
+		message   string
+		signature string
+		err       string // expected error text, empty if valid
+	}{
+		{"pre-hashed", testSignedMessage, testSignatureHashed, ""},
+		{"legacy", testSignedMessage, testSignatureLegacy, ""},
+		{"CRLF line endings", testSignedMessage, strings.ReplaceAll(testSignatureHashed, "\n", "\r\n"), ""},
+		{"tampered body pre-hashed", strings.Replace(testSignedMessage, "30", "31", 1), testSignatureHashed, "signature does not match"},
+		{"tampered body legacy", testSignedMessage + " ", testSignatureLegacy, "signature does not match"},
+		{"pre-hashed signature as legacy", testSignedMessage, strings.Replace(testSignatureHashed, "RUQ6", "RWQ6", 1), "signature does not match"},
+		{"legacy signature as pre-hashed", testSignedMessage, strings.Replace(testSignatureLegacy, "RWQ6", "RUQ6", 1), "signature does not match"},
+		{"unknown algorithm", testSignedMessage, strings.Replace(testSignatureHashed, "RUQ6", "RXQ6", 1), "unsupported signature algorithm"},
+		{"wrong key id", testSignedMessage, testSignatureOtherKey, "signed with unknown key 0706050403020177"},
+		{"tampered trusted comment", testSignedMessage, strings.Replace(testSignatureHashed, "timestamp:1643500000", "timestamp:1743500000", 1), "trusted comment signature does not match"},
+		{"no signature", testSignedMessage, "", "no signature"},
+		{"no minisign file", testSignedMessage, "signature\n", "invalid signature format"},
+		{"truncated signature", testSignedMessage, strings.Replace(testSignatureHashed, "RUQ6kQxe", "RUQ6", 1), "invalid signature format"},
+	}
+	for _, test := range tests {
+		err := verifyMinisign(keys, []byte(test.message), []byte(test.signature))
+		switch {
+		case test.err == "" && err != nil:
+			t.Errorf("%s: %s", test.name, err)
+		case test.err != "" && (err == nil || err.Error() != test.err):
+			t.Errorf("%s: error %v, want %q", test.name, err, test.err)
+		}
+	}
+}
+
+func TestParseMinisignPublicKey(t *testing.T) {
+	// the key line alone is accepted as well
+	keyID, _, err := parseMinisignPublicKey("RWQ6kQxe0ke4Fghm4o8Qrwt6Zg4aFUd1ZCLQPaysHpvZvyItaAZRhXNB")
+	if err != nil || keyID[0] != 0x3a {
+		t.Errorf("key id %X, error %v", keyID, err)
+	}
+	for _, publicKey := range []string{"", "no base64!", "RWQ6kQxe0ke4Fg==", "RUQ6kQxe0ke4Fghm4o8Qrwt6Zg4aFUd1ZCLQPaysHpvZvyItaAZRhXNB"} {
+		if _, _, err := parseMinisignPublicKey(publicKey); err == nil {
+			t.Errorf("no error for public key %q", publicKey)
+		}
+	}
+}
+
+func TestCatalogVerifierModes(t *testing.T) {
+	tampered := []byte(testSignedMessage + " ")
+
+	required, err := newCatalogVerifier(catalogConfig{PublicKeys: []string{testPublicKey}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if warning, err := required.check([]byte(testSignedMessage), []byte(testSignatureHashed), "download"); warning != "" || err != nil {
+		t.Errorf("valid signature: warning %q, error %v", warning, err)
+	}
+	if _, err := required.check(tampered, []byte(testSignatureHashed), "download"); !errors.Is(err, errCatalogSignature) {
+		t.Errorf("tampered catalog: error %v, want errCatalogSignature", err)
+	}
+
+	warn, err := newCatalogVerifier(catalogConfig{PublicKeys: []string{testPublicKey}, Signature: signatureWarn})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if warning, err := warn.check(tampered, nil, "cache"); warning == "" || err != nil {
+		t.Errorf("warn mode: warning %q, error %v", warning, err)
+	}
+
+	if _, err := newCatalogVerifier(catalogConfig{PublicKeys: []string{testPublicKey}, Signature: "ignore"}); err == nil {
+		t.Error("no error for an unknown signature mode")
+	}
+	none, err := newCatalogVerifier(catalogConfig{})
+	if err != nil || none.enabled() {
+		t.Errorf("verifier without public keys: %v, error %v", none, err)
+	}
+}
@@ -0,0 +1,162 @@
+// Update Checker
+// Copyright (C) 2020-21  Florian Probst
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import "strings"
+
+// statusReason tells why a software has its status (the values are used in
+// the JSON report)
+type statusReason string
+
+// ReasonCurrent means that the installed version is the current catalog version
+const ReasonCurrent statusReason = "current"
+
+// ReasonUpdateAvailable means that the catalog has a newer version of the installed branch
+const ReasonUpdateAvailable statusReason = "update-available"
+
+// ReasonNoCatalogBranch means that the installed branch is not in the catalog
+// (anymore) and the newest catalog version is newer
+const ReasonNoCatalogBranch statusReason = "no-catalog-branch"
+
+// ReasonNewerThanCatalog means that the installed version is newer than the catalog version
+const ReasonNewerThanCatalog statusReason = "newer-than-catalog"
+
+// ReasonEndOfLife means that the installed release is not supported anymore
+const ReasonEndOfLife statusReason = "end-of-life"
+
+// ReasonSupported means that the software has no catalog product, but is
+// supported until the end of life date of its product rule
+const ReasonSupported statusReason = "supported"
+
+// ReasonNoCatalogEntry means that the software is tracked, but the catalog has no entry for it
+const ReasonNoCatalogEntry statusReason = "no-catalog-entry"
+
+// ReasonVersionUnparseable means that the installed or the catalog version cannot be compared
+const ReasonVersionUnparseable statusReason = "version-unparseable"
+
+// ReasonIgnored means that the software is ignored by a product rule
+const ReasonIgnored statusReason = "ignored"
+
+// ReasonNotTracked means that neither a product rule nor a catalog product matches the software
+const ReasonNotTracked statusReason = "not-tracked"
+
+// ReasonChannelNotAllowed means that the installed release channel is not allowed by the channel policy
+const ReasonChannelNotAllowed statusReason = "channel-not-allowed"
+
+// explanation returns a human-readable explanation of the reason
+func (reason statusReason) explanation() string {
+	switch reason {
+	case ReasonUpdateAvailable:
+		return "update available"
+	case ReasonNoCatalogBranch:
+		return "installed branch not in catalog, newer release available"
+	case ReasonNewerThanCatalog:
+		return "newer than catalog"
+	case ReasonEndOfLife:
+		return "end of life"
+	case ReasonSupported:
+		return "supported"
+	case ReasonNoCatalogEntry:
+		return "no catalog entry"
+	case ReasonVersionUnparseable:
+		return "version not comparable"
+	case ReasonIgnored:
+		return "ignored by product rule"
+	case ReasonNotTracked:
+		return "not tracked by Update Checker"
+	case ReasonChannelNotAllowed:
+		return "release channel not allowed"
+	default:
+		return ""
+	}
+}
+
+// isVerified checks if the software is verified by Update Checker (shown in
+// the main results, the rest is listed as other software)
+func (mapping installedSoftwareMapping) isVerified() bool {
+	return mapping.Reason != ReasonNotTracked && mapping.Reason != ReasonIgnored
+}
+
+// less reports whether the mapping is listed before other: by status, verified
+// software first, then by name and version, then by scope, architecture,
+// registry key and file path, which differ between installations of the same
+// software (the mappings come from a map, so their order differs from run to
+// run)
+func (mapping installedSoftwareMapping) less(other installedSoftwareMapping) bool {
+	if mapping.Status != other.Status {
+		return mapping.Status < other.Status
+	}
+	if mapping.isVerified() != other.isVerified() {
+		// verified software first (e.g. "no catalog entry" before "not tracked")
+		return mapping.isVerified()
+	}
+	key, otherKey := mapping.sortKey(), other.sortKey()
+	for k := range key {
+		if key[k] != otherKey[k] {
+			return key[k] < otherKey[k]
+		}
+	}
+	return false
+}
+
+// sortKey returns the values mappings of the same status are sorted by (like
+// jsonReportEntry.sortKey)
+func (mapping installedSoftwareMapping) sortKey() [6]string {
+	return [6]string{
+		strings.ToUpper(mapping.Name),
+		mapping.InstalledSoftware.DisplayVersion,
+		mapping.InstalledSoftware.Scope,
+		mapping.InstalledSoftware.Architecture,
+		mapping.InstalledSoftware.RegistryKey,
+		mapping.InstalledSoftware.FilePath,
+	}
+}
+
+// explanation returns why the software has its status, e.g. "update
+// available; 2 cumulative updates behind"
+func (mapping installedSoftwareMapping) explanation() string {
+	var parts []string
+	if explanation := mapping.Reason.explanation(); explanation != "" {
+		parts = append(parts, explanation)
+	}
+	if mapping.Detail != "" {
+		parts = append(parts, mapping.Detail)
+	}
+	return strings.Join(parts, "; ")
+}
+
+// statusText returns the status with its explanation, e.g. "Outdated
+// (update available)"
+func (mapping installedSoftwareMapping) statusText() string {
+	status := statusString(mapping.Status)
+	if explanation := mapping.explanation(); explanation != "" {
+		status += " (" + explanation + ")"
+	}
+	return status
+}
+
+// statusString returns the text shown for a mapping status
+func statusString(status softwareStatus) string {
+	switch status {
+	case StatusOutdated:
+		return "Outdated"
+	case StatusUpToDate:
+		return "Up-to-date"
+	default:
+		return "Unknown"
+	}
+}
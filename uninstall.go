@@ -0,0 +1,143 @@
+// Update Checker
+// Copyright (C) 2020-21  Florian Probst
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// uninstallKeyPath is the registry key (below HKLM or HKCU) with one sub key
+// per installed software
+const uninstallKeyPath = "SOFTWARE\\Microsoft\\Windows\\CurrentVersion\\Uninstall"
+
+// uninstallKeyPathWow64 is the Uninstall key of 32-bit software on 64-bit Windows
+const uninstallKeyPathWow64 = "SOFTWARE\\Wow6432Node\\Microsoft\\Windows\\CurrentVersion\\Uninstall"
+
+// windowsVersionKeyPath is the registry key (below HKLM) with the Windows version
+const windowsVersionKeyPath = "SOFTWARE\\Microsoft\\Windows NT\\CurrentVersion"
+
+// ScopeMachine means that the software is installed for all users (HKLM)
+const ScopeMachine = "machine"
+
+// ScopeUser means that the software is installed for one user (HKCU)
+const ScopeUser = "user"
+
+// ArchitectureX64 means 64-bit software
+const ArchitectureX64 = "x64"
+
+// ArchitectureX86 means 32-bit software
+const ArchitectureX86 = "x86"
+
+// releaseTypesHidden are the ReleaseType values of Uninstall keys of patches,
+// which are not shown as separate software
+var releaseTypesHidden = []string{"Update", "Hotfix", "Security Update", "Service Pack", "Update Rollup"}
+
+// uninstallComponent builds the installed software component from the values
+// of an Uninstall sub key (the sub key name is used if there is no DisplayName).
+// registryKey is the full path of the sub key, used for display only.
+func uninstallComponent(registryKey string, subKeyName string, k registryValueReader) installedSoftwareComponent {
+	displayName, _, _ := k.GetStringValue("DisplayName")
+	if displayName == "" {
+		displayName = subKeyName
+	}
+	displayVersion, _, _ := k.GetStringValue("DisplayVersion")
+	publisher, _, _ := k.GetStringValue("Publisher")
+
+	component := installedSoftwareComponent{
+		DisplayName:    displayName,
+		DisplayVersion: displayVersion,
+		Publisher:      publisher,
+		RegistryKey:    registryKey,
+		VersionSource:  VersionSourceRegistry,
+	}
+	component.InstallDate, _, _ = k.GetStringValue("InstallDate")
+	component.InstallLocation, _, _ = k.GetStringValue("InstallLocation")
+	component.DisplayIcon, _, _ = k.GetStringValue("DisplayIcon")
+	component.UninstallString, _, _ = k.GetStringValue("UninstallString")
+	component.EstimatedSize, _, _ = k.GetIntegerValue("EstimatedSize")
+	systemComponent, _, _ := k.GetIntegerValue("SystemComponent")
+	component.SystemComponent = systemComponent != 0
+	component.ParentKeyName, _, _ = k.GetStringValue("ParentKeyName")
+	component.ReleaseType, _, _ = k.GetStringValue("ReleaseType")
+	windowsInstaller, _, _ := k.GetIntegerValue("WindowsInstaller")
+	component.WindowsInstaller = windowsInstaller != 0
+
+	return component
+}
+
+// isHidden checks if the component is hidden in "Programs and Features"
+// (system components and updates of other software)
+func (c installedSoftwareComponent) isHidden() bool {
+	if c.SystemComponent || c.ParentKeyName != "" {
+		return true
+	}
+	for _, releaseType := range releaseTypesHidden {
+		if strings.EqualFold(c.ReleaseType, releaseType) {
+			return true
+		}
+	}
+	return false
+}
+
+// details returns the installation details of the component, one
+// "label: value" line each (empty values are left out)
+func (c installedSoftwareComponent) details() string {
+	var sb strings.Builder
+	add := func(label string, value string) {
+		if value != "" {
+			fmt.Fprintf(&sb, "%-18s %s\n", label+":", value)
+		}
+	}
+	add("Version", c.DisplayVersion)
+	add("Version source", c.VersionSource)
+	add("Registry version", c.RegistryVersion)
+	add("Channel", c.Channel)
+	add("Publisher", c.Publisher)
+	add("Scope", c.Scope)
+	add("Architecture", c.Architecture)
+	add("Install date", c.InstallDate)
+	add("Install location", c.InstallLocation)
+	add("Display icon", c.DisplayIcon)
+	add("Uninstall string", c.UninstallString)
+	if c.EstimatedSize > 0 {
+		add("Estimated size", strconv.FormatUint(c.EstimatedSize/1024, 10)+" MB")
+	}
+	if c.SystemComponent {
+		add("System component", "yes")
+	}
+	add("Parent key name", c.ParentKeyName)
+	add("Release type", c.ReleaseType)
+	if c.WindowsInstaller {
+		add("Windows Installer", "yes")
+	}
+	add("Registry key", c.RegistryKey)
+	add("File", c.FilePath)
+	return sb.String()
+}
+
+// indentLines puts the prefix in front of every line of the text
+func indentLines(text string, prefix string) string {
+	lines := strings.SplitAfter(text, "\n")
+	for i, line := range lines {
+		if line != "" {
+			lines[i] = prefix + line
+		}
+	}
+	return strings.Join(lines, "")
+}
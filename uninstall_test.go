@@ -0,0 +1,123 @@
+// Update Checker
+// Copyright (C) 2020-22  Florian Probst
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import "testing"
+
+func TestIsHidden(t *testing.T) {
+	tests := []struct {
+		name      string
+		component installedSoftwareComponent
+		hidden    bool
+	}{
+		{"application", installedSoftwareComponent{DisplayName: "7-Zip 21.07 (x64)"}, false},
+		{"system component", installedSoftwareComponent{DisplayName: "Microsoft Visual C++ 2019 X64 Minimum Runtime", SystemComponent: true}, true},
+		{"update of other software", installedSoftwareComponent{DisplayName: "Security Update for Microsoft Office", ParentKeyName: "Office16.PROPLUS"}, true},
+		{"update", installedSoftwareComponent{DisplayName: "KB5009543", ReleaseType: "Update"}, true},
+		{"hotfix", installedSoftwareComponent{DisplayName: "Hotfix for Microsoft .NET Framework", ReleaseType: "Hotfix"}, true},
+		{"security update, other case", installedSoftwareComponent{DisplayName: "KB5009596", ReleaseType: "security update"}, true},
+		{"service pack", installedSoftwareComponent{DisplayName: "Service Pack 1", ReleaseType: "Service Pack"}, true},
+		{"update rollup", installedSoftwareComponent{DisplayName: "Update Rollup 2", ReleaseType: "Update Rollup"}, true},
+		{"other release type", installedSoftwareComponent{DisplayName: "Microsoft Office", ReleaseType: "Product"}, false},
+		{"release type containing update", installedSoftwareComponent{DisplayName: "Tool", ReleaseType: "Updater"}, false},
+	}
+	for _, test := range tests {
+		if hidden := test.component.isHidden(); hidden != test.hidden {
+			t.Errorf("%s: hidden %t, want %t", test.name, hidden, test.hidden)
+		}
+	}
+}
+
+func TestDetails(t *testing.T) {
+	tests := []struct {
+		name      string
+		component installedSoftwareComponent
+		details   string
+	}{
+		{"empty", installedSoftwareComponent{DisplayName: "Tool"}, ""},
+		{
+			"registry",
+			installedSoftwareComponent{
+				DisplayName:      "7-Zip 21.07 (x64)",
+				DisplayVersion:   "21.07",
+				VersionSource:    VersionSourceRegistry,
+				Publisher:        "Igor Pavlov",
+				Scope:            ScopeMachine,
+				Architecture:     ArchitectureX64,
+				InstallDate:      "20220110",
+				InstallLocation:  "C:\\Program Files\\7-Zip\\",
+				DisplayIcon:      "C:\\Program Files\\7-Zip\\7zFM.exe",
+				UninstallString:  "\"C:\\Program Files\\7-Zip\\Uninstall.exe\"",
+				EstimatedSize:    5530,
+				WindowsInstaller: true,
+				RegistryKey:      "HKLM\\SOFTWARE\\Microsoft\\Windows\\CurrentVersion\\Uninstall\\7-Zip",
+			},
+			"Version:           21.07\n" +
+				"Version source:    registry\n" +
+				"Publisher:         Igor Pavlov\n" +
+				"Scope:             machine\n" +
+				"Architecture:      x64\n" +
+				"Install date:      20220110\n" +
+				"Install location:  C:\\Program Files\\7-Zip\\\n" +
+				"Display icon:      C:\\Program Files\\7-Zip\\7zFM.exe\n" +
+				"Uninstall string:  \"C:\\Program Files\\7-Zip\\Uninstall.exe\"\n" +
+				"Estimated size:    5 MB\n" +
+				"Windows Installer: yes\n" +
+				"Registry key:      HKLM\\SOFTWARE\\Microsoft\\Windows\\CurrentVersion\\Uninstall\\7-Zip\n",
+		},
+		{
+			"hidden update",
+			installedSoftwareComponent{DisplayName: "KB5009543", SystemComponent: true, ParentKeyName: "Office16.PROPLUS", ReleaseType: "Update", EstimatedSize: 512},
+			"Estimated size:    0 MB\n" +
+				"System component:  yes\n" +
+				"Parent key name:   Office16.PROPLUS\n" +
+				"Release type:      Update\n",
+		},
+		{
+			"file version",
+			installedSoftwareComponent{DisplayName: "PuTTY", DisplayVersion: "0.76", VersionSource: VersionSourceFile, RegistryVersion: "Release 0.76", Channel: "release", FilePath: "D:\\Tools\\putty.exe"},
+			"Version:           0.76\n" +
+				"Version source:    file\n" +
+				"Registry version:  Release 0.76\n" +
+				"Channel:           release\n" +
+				"File:              D:\\Tools\\putty.exe\n",
+		},
+	}
+	for _, test := range tests {
+		if details := test.component.details(); details != test.details {
+			t.Errorf("%s: details\n%s\nwant\n%s", test.name, details, test.details)
+		}
+	}
+}
+
+func TestIndentLines(t *testing.T) {
+	tests := []struct {
+		text, indented string
+	}{
+		{"", ""},
+		{"Version: 1.0", "    Version: 1.0"},
+		{"Version: 1.0\n", "    Version: 1.0\n"},
+		{"Version: 1.0\nScope:   user\n", "    Version: 1.0\n    Scope:   user\n"},
+		// empty lines are indented, too (only the end of the text is not)
+		{"a\n\nb", "    a\n    \n    b"},
+	}
+	for _, test := range tests {
+		if indented := indentLines(test.text, "    "); indented != test.indented {
+			t.Errorf("indentLines(%q) = %q, want %q", test.text, indented, test.indented)
+		}
+	}
+}
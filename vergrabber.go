@@ -19,128 +19,443 @@ package main
 import (
 	"bufio"
 	"bytes"
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io/ioutil"
+	"net"
 	"net/http"
+	"net/url"
 	"os"
 	"regexp"
 	"time"
-
-	"github.com/sqweek/dialog"
 )
 
 const vergrabberURL = "https://vergrabber.kingu.pl/vergrabber.json"
 const vergrabberFile = "vergrabber.json"
 
+// maxCatalogAge is the age after which vergrabber.json is downloaded again
+const maxCatalogAge = time.Hour * 24 * 2
+
+// errors of the catalog subsystem, wrapped in a catalogError
+var (
+	errCatalogUnavailable = errors.New("not available")
+	errCatalogInvalid     = errors.New("invalid content")
+)
+
+// catalogError describes which step of fetching vergrabber.json failed
+type catalogError struct {
+	Op  string // e.g. "download", "read cache", "parse"
+	Err error
+}
+
+func (e *catalogError) Error() string {
+	return "vergrabber.json " + e.Op + ": " + e.Err.Error()
+}
+
+func (e *catalogError) Unwrap() error {
+	return e.Err
+}
+
+// vergrabberCatalog holds the parsed vergrabber.json
+type vergrabberCatalog struct {
+	Releases map[string]softwareReleaseStatus // keyed by "<software name> <major release>"
+	Updated  time.Time                        // "updated" date of vergrabber.json
+	Source   string                           // "download", "cache" or the file name (offline)
+	Warning  string                           // set if the catalog is outdated (degraded results)
+}
+
 // fetches current versions of common software from
-// https://vergrabber.kingu.pl/vergrabber.json
-func getSoftwareVersionsFromVergrabber() map[string]softwareReleaseStatus {
-	var jsonFromVergrabber []byte
-	softwareReleaseStatii := map[string]softwareReleaseStatus{}
+// https://vergrabber.kingu.pl/vergrabber.json (or the configured mirror). The cached file is used as long
+// as it is up-to-date (as of asOf, usually now). If the download fails the
+// cached file is used even if it is outdated, the returned catalog then
+// contains a warning.
+func getSoftwareVersionsFromVergrabber(cfg catalogConfig, asOf time.Time) (vergrabberCatalog, error) {
+	verifier, err := newCatalogVerifier(cfg)
+	if err != nil {
+		return vergrabberCatalog{}, &catalogError{"verify", err}
+	}
 
 	/// first try to read cached file from filesystem
-	jsonFromVergrabber, err := ioutil.ReadFile(vergrabberFile)
-	if err != nil {
-		Trace.Println("no cached vergrabber.json file available, catching online version")
-		jsonFromVergrabber = downloadAndCacheVergrabberJSON()
-		if !isVergrabberJSONUptodate(jsonFromVergrabber) {
-			Info.Println("Downloaded vergrabber.json is not up-to-date")
-			dialog.Message("%s", "Downloaded vergrabber.json is not up-to-date. Aborting!").Title("Error").Error()
-			panic("Downloaded vergrabber.json is not up-to-date")
+	cached, cacheErr := readVergrabberJSON(vergrabberFile, "cache", verifier)
+	if cacheErr == nil && !isCatalogOutdated(cached.Updated, asOf) {
+		return cached, nil
+	}
+	if cacheErr != nil {
+		Trace.Println("no usable cached vergrabber.json file available, catching online version:", cacheErr)
+	} else {
+		Trace.Println("cached vergrabber.json file is outdated, catching online version")
+	}
+
+	// conditional request if the cached file is known to come from the same source
+	var validators *catalogFetchMetadata
+	if cacheErr == nil {
+		if meta, valid := readCatalogFetchMetadata(cfg.URL); valid {
+			validators = &meta
+		}
+	}
+
+	jsonFromVergrabber, meta, downloadErr := downloadVergrabberJSON(cfg, validators)
+	var downloaded vergrabberCatalog
+	if downloadErr == nil && jsonFromVergrabber == nil {
+		// 304 Not Modified: the cached file is still the most recent one
+		Info.Println("vergrabber.json has not been modified since", validators.FetchedAt.Format(time.RFC3339))
+		downloaded = cached
+		if err := writeCatalogFetchMetadata(meta); err != nil {
+			Info.Println("Could not write " + vergrabberMetaFile + ": " + err.Error())
 		}
 	} else {
-		// checking if cached file is still up-to-date
-		if !isVergrabberJSONUptodate(jsonFromVergrabber) {
-			Trace.Println("cached vergrabber.json file is outdated, catching online version")
-			jsonFromVergrabber = downloadAndCacheVergrabberJSON()
-			jsonUptodate := isVergrabberJSONUptodate(jsonFromVergrabber)
-			if !jsonUptodate {
-				Info.Println("Downloaded vergrabber.json is not up-to-date")
-				dialog.Message("%s", "Downloaded vergrabber.json is not up-to-date. Aborting!").Title("Error").Error()
-				panic("Downloaded vergrabber.json is not up-to-date")
+		var signature []byte
+		if downloadErr == nil {
+			downloaded, downloadErr = parseVergrabberCatalog(jsonFromVergrabber, "download")
+		}
+		if downloadErr == nil && verifier.enabled() {
+			signature, downloadErr = downloadCatalogSignature(cfg)
+			if downloadErr == nil || !verifier.required {
+				var warning string
+				warning, downloadErr = verifier.check(jsonFromVergrabber, signature, "download")
+				downloaded.addWarning(warning)
+			}
+		}
+		if downloadErr != nil {
+			Info.Println(downloadErr)
+			if cacheErr != nil {
+				return vergrabberCatalog{}, downloadErr
 			}
+			// fall back to last good cached file
+			cached.addWarning(fmt.Sprintf("Using cached vergrabber.json, catalog is %d days old (%s)",
+				catalogAgeDays(cached.Updated, asOf), downloadErr))
+			return cached, nil
+		}
+
+		if cacheErr == nil && downloaded.Updated.Before(cached.Updated) {
+			// should not happen, but never replace the cache with an older file
+			Info.Println("Downloaded vergrabber.json is older than cached file")
+			downloaded = cached
+		} else if err := cacheVergrabberJSON(jsonFromVergrabber, meta, signature); err != nil {
+			Info.Println("Could not cache vergrabber.json:", err)
+		}
+	}
+
+	if isCatalogOutdated(downloaded.Updated, asOf) {
+		downloaded.addWarning(fmt.Sprintf("vergrabber.json is not up-to-date, catalog is %d days old",
+			catalogAgeDays(downloaded.Updated, asOf)))
+	}
+	return downloaded, nil
+}
+
+// loadVergrabberFile reads a vergrabber.json snapshot for offline evaluation
+// (no download). An outdated snapshot results in a warning. If public keys
+// are configured, the signature next to the file is verified.
+func loadVergrabberFile(cfg catalogConfig, path string, asOf time.Time) (vergrabberCatalog, error) {
+	verifier, err := newCatalogVerifier(cfg)
+	if err != nil {
+		return vergrabberCatalog{}, &catalogError{"verify", err}
+	}
+
+	catalog, err := readVergrabberJSON(path, path, verifier)
+	if err != nil {
+		return catalog, err
+	}
+	if isCatalogOutdated(catalog.Updated, asOf) {
+		catalog.addWarning(fmt.Sprintf("%s (updated %s) is %d days old as of %s", path,
+			catalog.Updated.Format("2006-01-02"), catalogAgeDays(catalog.Updated, asOf), asOf.Format("2006-01-02")))
+	}
+	return catalog, nil
+}
+
+// readVergrabberJSON reads, verifies and parses a vergrabber.json file
+func readVergrabberJSON(path string, source string, verifier *catalogVerifier) (vergrabberCatalog, error) {
+	jsonFromVergrabber, err := ioutil.ReadFile(path)
+	if err != nil {
+		return vergrabberCatalog{}, &catalogError{"read " + source, fmt.Errorf("%w: %s", errCatalogUnavailable, err)}
+	}
+
+	var warning string
+	if verifier.enabled() {
+		// a missing signature file is reported by check
+		signature, _ := ioutil.ReadFile(path + signatureFileExtension)
+		warning, err = verifier.check(jsonFromVergrabber, signature, source)
+		if err != nil {
+			return vergrabberCatalog{}, err
 		}
 	}
 
-	// parse JSON
-	var f map[string]map[string]map[string]softwareReleaseStatus
-	err = json.Unmarshal(jsonFromVergrabber, &f)
+	catalog, err := parseVergrabberCatalog(jsonFromVergrabber, source)
+	catalog.addWarning(warning)
+	return catalog, err
+}
+
+// addWarning adds a warning about degraded results
+func (catalog *vergrabberCatalog) addWarning(warning string) {
+	if warning == "" {
+		return
+	}
+	Info.Println(warning)
+	if catalog.Warning != "" {
+		catalog.Warning += "; "
+	}
+	catalog.Warning += warning
+}
+
+// parseVergrabberCatalog parses the content of vergrabber.json
+func parseVergrabberCatalog(jsonFromVergrabber []byte, source string) (vergrabberCatalog, error) {
+	updatedDate, err := getVergrabberUpdateDate(jsonFromVergrabber)
+	if err != nil {
+		return vergrabberCatalog{}, &catalogError{"parse " + source, fmt.Errorf("%w: %s", errCatalogInvalid, err)}
+	}
+	softwareReleaseStatii, err := parseVergrabberJSON(jsonFromVergrabber)
+	if err != nil {
+		return vergrabberCatalog{}, &catalogError{"parse " + source, fmt.Errorf("%w: %s", errCatalogInvalid, err)}
+	}
+	return vergrabberCatalog{
+		Releases: softwareReleaseStatii,
+		Updated:  updatedDate,
+		Source:   source,
+	}, nil
+}
+
+// parseVergrabberJSON returns the software releases of the "client" and
+// "server" sections, keyed by "<software name> <major release>"
+func parseVergrabberJSON(jsonFromVergrabber []byte) (map[string]softwareReleaseStatus, error) {
+	softwareReleaseStatii := map[string]softwareReleaseStatus{}
+
+	// parse JSON (only the "client" and "server" sections have the
+	// software/version/details structure)
+	var f map[string]json.RawMessage
+	err := json.Unmarshal(jsonFromVergrabber, &f)
+	if err != nil {
+		return nil, err
+	}
 
-	for softwareType, valueSoftwareType := range f {
-		//fmt.Println("Typ:", softwareType)
-		if softwareType == "client" || softwareType == "server" {
-			for softwareName, softwareDetails := range valueSoftwareType {
-				//fmt.Println("Name:", softwareName)
-				for softwareVersion, softwareVersionDetails := range softwareDetails {
-					softwareVersionDetails.Name = softwareName
-					softwareVersionDetails.MajorRelease = softwareVersion
-					softwareReleaseStatii[softwareName+" "+softwareVersion] = softwareVersionDetails
-				}
+	for _, softwareType := range []string{"client", "server"} {
+		var valueSoftwareType map[string]map[string]softwareReleaseStatus
+		if f[softwareType] == nil {
+			continue
+		}
+		if err := json.Unmarshal(f[softwareType], &valueSoftwareType); err != nil {
+			return nil, err
+		}
+		for softwareName, softwareDetails := range valueSoftwareType {
+			//fmt.Println("Name:", softwareName)
+			for softwareVersion, softwareVersionDetails := range softwareDetails {
+				softwareVersionDetails.Name = softwareName
+				softwareVersionDetails.MajorRelease = softwareVersion
+				softwareVersionDetails.Category = softwareType
+				softwareReleaseStatii[softwareName+" "+softwareVersion] = softwareVersionDetails
 			}
 		}
 	}
 
 	//Trace.Printf(fmt.Sprintf("Software Releases from Vergrabber: %#v\n", softwareReleaseStatii))
 
-	return softwareReleaseStatii
+	return softwareReleaseStatii, nil
 }
 
-func isVergrabberJSONUptodate(jsonFromVergrabber []byte) bool {
-	updatedDate, err := getVergrabberUpdateDate(jsonFromVergrabber)
+// checks if the "updated" date of vergrabber.json is older than two days
+// before asOf
+func isCatalogOutdated(updatedDate time.Time, asOf time.Time) bool {
+	return !updatedDate.After(asOf.Add(-maxCatalogAge))
+}
+
+// catalogAgeDays returns the age of vergrabber.json in days as of asOf
+func catalogAgeDays(updatedDate time.Time, asOf time.Time) int {
+	return int(asOf.Sub(updatedDate).Hours() / 24)
+}
+
+// downloads vergrabber.json, failed requests are retried as configured. If
+// validators of the cached file are given, a conditional request is made and
+// nil content is returned if the file has not been modified (the returned
+// metadata then is the updated metadata of the cached file).
+func downloadVergrabberJSON(cfg catalogConfig, validators *catalogFetchMetadata) (jsonFromVergrabber []byte, meta catalogFetchMetadata, err error) {
+	client, err := newCatalogHTTPClient(cfg)
 	if err != nil {
-		Info.Println("Downloaded vergrabber.json is not up-to-date")
-		dialog.Message("%s", "Downloaded vergrabber.json is not up-to-date. Aborting!").Title("Error").Error()
-		panic("Downloaded vergrabber.json is not up-to-date")
+		return nil, meta, &catalogError{"download", err}
 	}
 
-	// second: verify date
-	if !updatedDate.After(time.Now().Add(-time.Hour * 24 * 2)) {
-		// JSON is outdated
-		return false
+	err = retryCatalogRequest(cfg, func() (retry bool, err error) {
+		jsonFromVergrabber, meta, retry, err = fetchVergrabberJSON(client, cfg.URL, validators)
+		return retry, err
+	})
+	if err != nil {
+		return nil, meta, &catalogError{"download", fmt.Errorf("%w: %s", errCatalogUnavailable, err)}
 	}
-	// JSON is not outdated
-	return true
+	return jsonFromVergrabber, meta, nil
 }
 
-func downloadAndCacheVergrabberJSON() []byte {
+// downloadCatalogSignature downloads the detached signature of vergrabber.json
+func downloadCatalogSignature(cfg catalogConfig) (signature []byte, err error) {
+	client, err := newCatalogHTTPClient(cfg)
+	if err != nil {
+		return nil, &catalogError{"download signature", err}
+	}
+
+	err = retryCatalogRequest(cfg, func() (bool, error) {
+		Info.Println("Downloading signature from " + cfg.signatureLocation())
+		resp, err := client.Get(cfg.signatureLocation())
+		if err != nil {
+			return true, err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests, fmt.Errorf("HTTP status %s", resp.Status)
+		}
+		signature, err = ioutil.ReadAll(resp.Body)
+		return isNetworkError(err), err
+	})
+	if err != nil {
+		return nil, &catalogError{"download signature", fmt.Errorf("%w: %s", errCatalogSignature, err)}
+	}
+	return signature, nil
+}
+
+// retryCatalogRequest calls request until it succeeds, it returns an error
+// that should not be retried or the configured number of retries is reached.
+// The delay between the attempts is doubled every time.
+func retryCatalogRequest(cfg catalogConfig, request func() (retry bool, err error)) error {
+	delay := time.Duration(cfg.RetryDelay)
+	for attempt := 0; ; attempt++ {
+		retry, err := request()
+		if err == nil {
+			return nil
+		}
+		if !retry || attempt >= cfg.Retries {
+			return err
+		}
+		Info.Printf("Request failed (%s), retrying in %s", err, delay)
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+// isNetworkError checks if a failed read of a response body might succeed
+// when retried (timeouts, reset connections). Other errors, e.g. a body that
+// is shorter than its Content-Length, are not retried.
+func isNetworkError(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+// fetchVergrabberJSON does one (conditional) request. retry is set for errors
+// that might be temporary (network errors, server errors).
+func fetchVergrabberJSON(client *http.Client, catalogURL string, validators *catalogFetchMetadata) (jsonFromVergrabber []byte, meta catalogFetchMetadata, retry bool, err error) {
+	req, err := http.NewRequest(http.MethodGet, catalogURL, nil)
+	if err != nil {
+		return nil, meta, false, err
+	}
+	if validators != nil {
+		if validators.ETag != "" {
+			req.Header.Set("If-None-Match", validators.ETag)
+		}
+		if validators.LastModified != "" {
+			req.Header.Set("If-Modified-Since", validators.LastModified)
+		}
+	}
+
 	// get JSON
-	Info.Println("Downloading vergrabber.json")
-	resp, err := http.Get(vergrabberURL)
+	Info.Println("Downloading vergrabber.json from " + catalogURL)
+	resp, err := client.Do(req)
 	if err != nil {
-		Info.Println("Could not catch vergrabber json from " + vergrabberURL)
-		dialog.Message("%s", "Could not catch vergrabber json from "+vergrabberURL).Title("Error").Error()
-		panic(err)
+		return nil, meta, true, err
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode == http.StatusNotModified && validators != nil {
+		meta = *validators
+		meta.FetchedAt = time.Now()
+		if etag := resp.Header.Get("ETag"); etag != "" {
+			meta.ETag = etag
+		}
+		return nil, meta, false, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		retry = resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests
+		return nil, meta, retry, fmt.Errorf("HTTP status %s", resp.Status)
+	}
+
 	// reads json as a slice of bytes
-	jsonFromVergrabber, err := ioutil.ReadAll(resp.Body)
+	jsonFromVergrabber, err = ioutil.ReadAll(resp.Body)
 	if err != nil {
-		Info.Println("Error reading vergrabber json: " + err.Error())
-		dialog.Message("%s", "Error reading vergrabber json: "+err.Error()).Title("Error").Error()
-		panic(err)
+		return nil, meta, isNetworkError(err), err
 	}
 
-	// Write file to disk
-	outputFile, err := os.Create(vergrabberFile)
-	if err != nil {
-		Info.Println(err)
-		dialog.Message("%s", err).Title("Info").Info()
+	meta = newCatalogFetchMetadata(catalogURL, resp.Header.Get("ETag"), resp.Header.Get("Last-Modified"), jsonFromVergrabber)
+	return jsonFromVergrabber, meta, false, nil
+}
+
+// newCatalogHTTPClient returns a HTTP client with the configured proxy,
+// timeout and additional CA certificates
+func newCatalogHTTPClient(cfg catalogConfig) (*http.Client, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+
+	if cfg.Proxy != "" {
+		proxyURL, err := url.Parse(cfg.Proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy URL: %w", err)
+		}
+		transport.Proxy = http.ProxyURL(proxyURL)
 	}
-	defer outputFile.Close()
-	_, err = outputFile.Write(jsonFromVergrabber)
-	if err != nil {
-		Info.Println(err)
-		dialog.Message("%s", err).Title("Info").Info()
+
+	if len(cfg.CAFiles) > 0 {
+		rootCAs, err := x509.SystemCertPool()
+		if err != nil {
+			// e.g. not available on Windows before Go 1.18
+			Info.Println("System certificate pool not available, only trusting configured CAs:", err)
+			rootCAs = x509.NewCertPool()
+		}
+		for _, caFile := range cfg.CAFiles {
+			pem, err := ioutil.ReadFile(caFile)
+			if err != nil {
+				return nil, err
+			}
+			if !rootCAs.AppendCertsFromPEM(pem) {
+				return nil, fmt.Errorf("no PEM certificates found in %s", caFile)
+			}
+		}
+		transport.TLSClientConfig = &tls.Config{RootCAs: rootCAs}
+	}
+
+	return &http.Client{
+		Transport: transport,
+		Timeout:   time.Duration(cfg.Timeout),
+	}, nil
+}
+
+// writes vergrabber.json, its signature (if any, else a stale signature is
+// removed) and its fetch metadata to disk. vergrabber.json is written via a
+// temporary file, so that the last good cached file is never left half
+// written; the signature is written after it, so that it never belongs to
+// another file than vergrabber.json.
+func cacheVergrabberJSON(jsonFromVergrabber []byte, meta catalogFetchMetadata, signature []byte) error {
+	tempFile := vergrabberFile + ".tmp"
+	if err := ioutil.WriteFile(tempFile, jsonFromVergrabber, 0644); err != nil {
+		return &catalogError{"write cache", err}
+	}
+	if err := os.Rename(tempFile, vergrabberFile); err != nil {
+		os.Remove(tempFile)
+		return &catalogError{"write cache", err}
 	}
 
-	return jsonFromVergrabber
+	// the signature of the previous file must not be left next to the new one
+	signatureFile := vergrabberFile + signatureFileExtension
+	if signature != nil {
+		if err := ioutil.WriteFile(signatureFile, signature, 0644); err != nil {
+			return &catalogError{"write cache", err}
+		}
+	} else if err := os.Remove(signatureFile); err != nil && !os.IsNotExist(err) {
+		return &catalogError{"write cache", err}
+	}
+	if err := writeCatalogFetchMetadata(meta); err != nil {
+		return &catalogError{"write cache", err}
+	}
+	return nil
 }
 
 func getVergrabberUpdateDate(jsonFromVergrabber []byte) (time.Time, error) {
 	// regexp to search for "updated:" entry and its date
-	r, _ := regexp.Compile(".*updated\": \"(.*)\".*")
+	r, _ := regexp.Compile("\"updated\":\\s*\"([^\"]*)\"")
 
 	scanner := bufio.NewScanner(bytes.NewReader(jsonFromVergrabber))
 	for scanner.Scan() {
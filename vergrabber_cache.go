@@ -0,0 +1,89 @@
+// Update Checker
+// Copyright (C) 2020-22  Florian Probst
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"time"
+)
+
+// vergrabberMetaFile holds the catalogFetchMetadata of the cached vergrabber.json
+const vergrabberMetaFile = vergrabberFile + ".meta"
+
+// catalogFetchMetadata describes where and when the cached vergrabber.json
+// was fetched, including the HTTP validators for conditional requests
+type catalogFetchMetadata struct {
+	SourceURL    string    `json:"sourceURL"`
+	ETag         string    `json:"etag,omitempty"`
+	LastModified string    `json:"lastModified,omitempty"`
+	FetchedAt    time.Time `json:"fetchedAt"`
+	Size         int       `json:"size"`
+	SHA256       string    `json:"sha256"`
+}
+
+// newCatalogFetchMetadata returns the metadata for freshly downloaded content
+func newCatalogFetchMetadata(sourceURL string, etag string, lastModified string, jsonFromVergrabber []byte) catalogFetchMetadata {
+	return catalogFetchMetadata{
+		SourceURL:    sourceURL,
+		ETag:         etag,
+		LastModified: lastModified,
+		FetchedAt:    time.Now(),
+		Size:         len(jsonFromVergrabber),
+		SHA256:       sha256Hex(jsonFromVergrabber),
+	}
+}
+
+// readCatalogFetchMetadata returns the metadata of the cached vergrabber.json,
+// but only if it was fetched from sourceURL and has not been changed since
+func readCatalogFetchMetadata(sourceURL string) (catalogFetchMetadata, bool) {
+	var meta catalogFetchMetadata
+	content, err := ioutil.ReadFile(vergrabberMetaFile)
+	if err != nil {
+		return meta, false
+	}
+	if err := json.Unmarshal(content, &meta); err != nil {
+		Info.Println("Ignoring invalid " + vergrabberMetaFile + ": " + err.Error())
+		return meta, false
+	}
+	if meta.SourceURL != sourceURL {
+		return meta, false
+	}
+
+	jsonFromVergrabber, err := ioutil.ReadFile(vergrabberFile)
+	if err != nil || sha256Hex(jsonFromVergrabber) != meta.SHA256 {
+		Trace.Println(vergrabberMetaFile + " does not match the cached vergrabber.json")
+		return meta, false
+	}
+	return meta, true
+}
+
+// writeCatalogFetchMetadata stores the metadata next to the cached vergrabber.json
+func writeCatalogFetchMetadata(meta catalogFetchMetadata) error {
+	content, err := json.MarshalIndent(meta, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(vergrabberMetaFile, content, 0644)
+}
+
+func sha256Hex(content []byte) string {
+	hash := sha256.Sum256(content)
+	return hex.EncodeToString(hash[:])
+}
@@ -0,0 +1,171 @@
+// Update Checker
+// Copyright (C) 2020-22  Florian Probst
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+)
+
+// chdirTemp changes into a new temporary directory for the cache files
+func chdirTemp(t *testing.T) {
+	t.Helper()
+	dir := t.TempDir()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+}
+
+func TestCatalogFetchMetadataRoundTrip(t *testing.T) {
+	content := readTestCatalog(t)
+	chdirTemp(t)
+	const sourceURL = "https://mirror.example/vergrabber.json"
+
+	if _, valid := readCatalogFetchMetadata(sourceURL); valid {
+		t.Error("metadata valid without " + vergrabberMetaFile)
+	}
+
+	if err := ioutil.WriteFile(vergrabberFile, content, 0644); err != nil {
+		t.Fatal(err)
+	}
+	meta := newCatalogFetchMetadata(sourceURL, `"abc"`, "Sun, 30 Jan 2022 06:00:00 GMT", content)
+	if err := writeCatalogFetchMetadata(meta); err != nil {
+		t.Fatal(err)
+	}
+	read, valid := readCatalogFetchMetadata(sourceURL)
+	if !valid {
+		t.Fatal("metadata not valid after writing it")
+	}
+	if !read.FetchedAt.Equal(meta.FetchedAt) {
+		t.Errorf("fetched at %s, want %s", read.FetchedAt, meta.FetchedAt)
+	}
+	read.FetchedAt = meta.FetchedAt
+	if read != meta {
+		t.Errorf("metadata %+v, want %+v", read, meta)
+	}
+
+	if _, valid := readCatalogFetchMetadata("https://other.example/vergrabber.json"); valid {
+		t.Error("metadata valid for another source URL")
+	}
+
+	// the cached file was replaced without updating the metadata
+	if err := ioutil.WriteFile(vergrabberFile, append(content, '\n'), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, valid := readCatalogFetchMetadata(sourceURL); valid {
+		t.Error("metadata valid for a modified vergrabber.json")
+	}
+
+	if err := ioutil.WriteFile(vergrabberMetaFile, []byte("{"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, valid := readCatalogFetchMetadata(sourceURL); valid {
+		t.Error("invalid " + vergrabberMetaFile + " accepted")
+	}
+}
+
+func TestGetSoftwareVersionsNotModified(t *testing.T) {
+	content := readTestCatalog(t)
+	chdirTemp(t)
+	const etag = `"v1"`
+	const lastModified = "Sun, 30 Jan 2022 06:00:00 GMT"
+
+	var requests, conditional int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.Header.Get("If-None-Match") == etag || r.Header.Get("If-Modified-Since") == lastModified {
+			conditional++
+			if r.Header.Get("If-None-Match") != etag || r.Header.Get("If-Modified-Since") != lastModified {
+				t.Errorf("validators If-None-Match %q, If-Modified-Since %q", r.Header.Get("If-None-Match"), r.Header.Get("If-Modified-Since"))
+			}
+			w.Header().Set("ETag", `"v2"`)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", etag)
+		w.Header().Set("Last-Modified", lastModified)
+		w.Write(content)
+	}))
+	defer server.Close()
+	cfg := testCatalogConfig(server.URL)
+	// the cached catalog is outdated as of this date
+	asOf := time.Date(2022, 2, 10, 0, 0, 0, 0, time.UTC)
+
+	// first run: no cache, full download
+	catalog, err := getSoftwareVersionsFromVergrabber(cfg, asOf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if catalog.Source != "download" || conditional != 0 {
+		t.Errorf("source %q with %d conditional requests, want download without", catalog.Source, conditional)
+	}
+	cached, err := ioutil.ReadFile(vergrabberFile)
+	if err != nil || string(cached) != string(content) {
+		t.Fatalf("vergrabber.json not cached: %v", err)
+	}
+	first, valid := readCatalogFetchMetadata(server.URL)
+	if !valid || first.ETag != etag || first.LastModified != lastModified {
+		t.Fatalf("metadata %+v (valid %t) after download", first, valid)
+	}
+
+	// second run: conditional request, 304
+	catalog, err = getSoftwareVersionsFromVergrabber(cfg, asOf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if requests != 2 || conditional != 1 {
+		t.Errorf("%d requests, %d conditional, want 2 and 1", requests, conditional)
+	}
+	if catalog.Source != "cache" || len(catalog.Releases) == 0 {
+		t.Errorf("source %q with %d releases, want the cached catalog", catalog.Source, len(catalog.Releases))
+	}
+	if catalog.Warning == "" {
+		t.Error("no warning for the outdated catalog")
+	}
+	second, valid := readCatalogFetchMetadata(server.URL)
+	if !valid {
+		t.Fatal("metadata not valid after 304")
+	}
+	if second.ETag != `"v2"` || second.LastModified != lastModified || second.SHA256 != first.SHA256 {
+		t.Errorf("metadata %+v after 304", second)
+	}
+	if second.FetchedAt.Before(first.FetchedAt) {
+		t.Errorf("fetched at %s, before %s", second.FetchedAt, first.FetchedAt)
+	}
+}
+
+func TestFetchVergrabberJSONNotModifiedWithoutValidators(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotModified)
+	}))
+	defer server.Close()
+
+	// a 304 to an unconditional request is an error, not an empty catalog
+	_, _, retry, err := fetchVergrabberJSON(server.Client(), server.URL, nil)
+	if err == nil || retry {
+		t.Errorf("error %v, retry %t", err, retry)
+	}
+}
@@ -0,0 +1,355 @@
+// Update Checker
+// Copyright (C) 2020-22  Florian Probst
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"encoding/pem"
+	"errors"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// testCatalogConfig returns a catalog configuration for the test server
+// with short retry delays
+func testCatalogConfig(url string) catalogConfig {
+	return catalogConfig{
+		URL:        url,
+		Timeout:    duration(5 * time.Second),
+		Retries:    2,
+		RetryDelay: duration(time.Millisecond),
+	}
+}
+
+func readTestCatalog(t *testing.T) []byte {
+	t.Helper()
+	content, err := ioutil.ReadFile("testdata/vergrabber.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return content
+}
+
+func TestNewCatalogHTTPClientProxy(t *testing.T) {
+	content := readTestCatalog(t)
+	var proxied int32
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// requests through a proxy have the absolute URL of the target
+		if r.URL.Host != "vergrabber.example" {
+			http.Error(w, "unexpected host "+r.URL.Host, http.StatusBadGateway)
+			return
+		}
+		atomic.AddInt32(&proxied, 1)
+		w.Write(content)
+	}))
+	defer proxy.Close()
+
+	cfg := testCatalogConfig("http://vergrabber.example/vergrabber.json")
+	cfg.Proxy = proxy.URL
+	jsonFromVergrabber, _, err := downloadVergrabberJSON(cfg, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(jsonFromVergrabber) != string(content) {
+		t.Error("downloaded content differs")
+	}
+	if proxied != 1 {
+		t.Errorf("%d requests through the proxy, want 1", proxied)
+	}
+
+	cfg.Proxy = "://no proxy"
+	if _, err := newCatalogHTTPClient(cfg); err == nil {
+		t.Error("no error for an invalid proxy URL")
+	}
+}
+
+func TestNewCatalogHTTPClientCAFiles(t *testing.T) {
+	content := readTestCatalog(t)
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(content)
+	}))
+	// the handshake with the untrusted certificate fails on purpose
+	server.Config.ErrorLog = log.New(ioutil.Discard, "", 0)
+	server.StartTLS()
+	defer server.Close()
+
+	dir := t.TempDir()
+	caFile := filepath.Join(dir, "ca.pem")
+	certificate := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	if err := ioutil.WriteFile(caFile, certificate, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := testCatalogConfig(server.URL + "/vergrabber.json")
+	cfg.Retries = 0
+	if _, _, err := downloadVergrabberJSON(cfg, nil); err == nil {
+		t.Error("no error for a server certificate of an unknown CA")
+	}
+
+	cfg.CAFiles = []string{caFile}
+	jsonFromVergrabber, _, err := downloadVergrabberJSON(cfg, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(jsonFromVergrabber) != string(content) {
+		t.Error("downloaded content differs")
+	}
+
+	noPEM := filepath.Join(dir, "empty.pem")
+	if err := ioutil.WriteFile(noPEM, []byte("no certificate"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for _, caFiles := range [][]string{{noPEM}, {filepath.Join(dir, "missing.pem")}} {
+		cfg.CAFiles = caFiles
+		if _, err := newCatalogHTTPClient(cfg); err == nil {
+			t.Errorf("no error for CA files %v", caFiles)
+		}
+	}
+}
+
+func TestDownloadVergrabberJSONRetries(t *testing.T) {
+	content := readTestCatalog(t)
+	tests := []struct {
+		name     string
+		statii   []int // status codes of the attempts, the last one is repeated
+		attempts int32
+		success  bool
+	}{
+		{"ok", []int{http.StatusOK}, 1, true},
+		{"server error", []int{http.StatusServiceUnavailable, http.StatusBadGateway, http.StatusOK}, 3, true},
+		{"too many requests", []int{http.StatusTooManyRequests, http.StatusOK}, 2, true},
+		{"retries exhausted", []int{http.StatusInternalServerError}, 3, false},
+		{"not found", []int{http.StatusNotFound, http.StatusOK}, 1, false},
+		{"forbidden", []int{http.StatusForbidden, http.StatusOK}, 1, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var attempts int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				attempt := int(atomic.AddInt32(&attempts, 1)) - 1
+				if attempt >= len(test.statii) {
+					attempt = len(test.statii) - 1
+				}
+				if status := test.statii[attempt]; status != http.StatusOK {
+					http.Error(w, http.StatusText(status), status)
+					return
+				}
+				w.Header().Set("ETag", `"v1"`)
+				w.Header().Set("Last-Modified", "Mon, 31 Jan 2022 06:00:00 GMT")
+				w.Write(content)
+			}))
+			defer server.Close()
+
+			jsonFromVergrabber, meta, err := downloadVergrabberJSON(testCatalogConfig(server.URL), nil)
+			if attempts != test.attempts {
+				t.Errorf("%d attempts, want %d", attempts, test.attempts)
+			}
+			if !test.success {
+				if !errors.Is(err, errCatalogUnavailable) {
+					t.Errorf("error %v, want errCatalogUnavailable", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(jsonFromVergrabber) != string(content) {
+				t.Error("downloaded content differs")
+			}
+			want := catalogFetchMetadata{
+				SourceURL:    server.URL,
+				ETag:         `"v1"`,
+				LastModified: "Mon, 31 Jan 2022 06:00:00 GMT",
+				FetchedAt:    meta.FetchedAt,
+				Size:         len(content),
+				SHA256:       sha256Hex(content),
+			}
+			if meta != want || meta.FetchedAt.IsZero() {
+				t.Errorf("metadata %+v, want %+v", meta, want)
+			}
+		})
+	}
+}
+
+func TestRetryCatalogRequestBackoff(t *testing.T) {
+	cfg := catalogConfig{Retries: 3, RetryDelay: duration(10 * time.Millisecond)}
+	var attempts []time.Time
+	err := retryCatalogRequest(cfg, func() (bool, error) {
+		attempts = append(attempts, time.Now())
+		return true, errors.New("temporary error")
+	})
+	if err == nil {
+		t.Fatal("no error after the last retry")
+	}
+	if len(attempts) != 4 {
+		t.Fatalf("%d attempts, want 4", len(attempts))
+	}
+	// 10ms, 20ms, 40ms
+	for i := 1; i < len(attempts); i++ {
+		want := time.Duration(cfg.RetryDelay) << (i - 1)
+		if delay := attempts[i].Sub(attempts[i-1]); delay < want {
+			t.Errorf("delay before attempt %d is %s, want at least %s", i+1, delay, want)
+		}
+	}
+
+	attempts = nil
+	retryCatalogRequest(cfg, func() (bool, error) {
+		attempts = append(attempts, time.Now())
+		return false, errors.New("permanent error")
+	})
+	if len(attempts) != 1 {
+		t.Errorf("%d attempts for an error that is not retried, want 1", len(attempts))
+	}
+}
+
+func TestCacheVergrabberJSONSignature(t *testing.T) {
+	content := readTestCatalog(t)
+	chdirTemp(t)
+	signatureFile := vergrabberFile + signatureFileExtension
+	meta := newCatalogFetchMetadata(vergrabberURL, "", "", content)
+
+	if err := cacheVergrabberJSON(content, meta, []byte(testSignatureHashed)); err != nil {
+		t.Fatal(err)
+	}
+	if signature, err := ioutil.ReadFile(signatureFile); err != nil || string(signature) != testSignatureHashed {
+		t.Errorf("signature %q, error %v", signature, err)
+	}
+	if _, err := os.Stat(vergrabberFile + ".tmp"); !os.IsNotExist(err) {
+		t.Error("temporary file left behind")
+	}
+
+	// a catalog without signature must not keep the signature of the previous one
+	if err := cacheVergrabberJSON(content, meta, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(signatureFile); !os.IsNotExist(err) {
+		t.Errorf("stale signature not removed: %v", err)
+	}
+	if _, valid := readCatalogFetchMetadata(vergrabberURL); !valid {
+		t.Error("metadata not valid for the cached file")
+	}
+
+	// the signature is not written if vergrabber.json cannot be replaced
+	if err := os.Remove(vergrabberFile); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(vergrabberFile, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(vergrabberFile, "blocker"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := cacheVergrabberJSON(content, meta, []byte(testSignatureHashed)); err == nil {
+		t.Error("no error if vergrabber.json cannot be replaced")
+	}
+	if _, err := os.Stat(signatureFile); !os.IsNotExist(err) {
+		t.Errorf("signature written for a catalog that was not cached: %v", err)
+	}
+}
+
+func TestGetSoftwareVersionsStaleCacheFallback(t *testing.T) {
+	content := readTestCatalog(t)
+	chdirTemp(t)
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+	}))
+	defer server.Close()
+	cfg := testCatalogConfig(server.URL)
+	// the test catalog was updated on 2022-01-30
+	asOf := time.Date(2022, 2, 14, 0, 0, 0, 0, time.UTC)
+
+	// no cached file: the download error is returned
+	if _, err := getSoftwareVersionsFromVergrabber(cfg, asOf); !errors.Is(err, errCatalogUnavailable) {
+		t.Errorf("error %v without cache, want errCatalogUnavailable", err)
+	}
+
+	if err := ioutil.WriteFile(vergrabberFile, content, 0644); err != nil {
+		t.Fatal(err)
+	}
+	atomic.StoreInt32(&requests, 0)
+	catalog, err := getSoftwareVersionsFromVergrabber(cfg, asOf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if requests != 3 {
+		t.Errorf("%d requests, want 3", requests)
+	}
+	if catalog.Source != "cache" || len(catalog.Releases) == 0 {
+		t.Errorf("source %q with %d releases, want the cached catalog", catalog.Source, len(catalog.Releases))
+	}
+	if !strings.Contains(catalog.Warning, "catalog is 15 days old") {
+		t.Errorf("warning %q, want the age of the cached catalog", catalog.Warning)
+	}
+	if cached, err := ioutil.ReadFile(vergrabberFile); err != nil || string(cached) != string(content) {
+		t.Errorf("cached file changed: %v", err)
+	}
+}
+
+func TestCatalogBodyReadErrors(t *testing.T) {
+	content := readTestCatalog(t)
+	tests := []struct {
+		name     string
+		timeout  bool // the server stops sending, else it sends less than its Content-Length
+		attempts int32
+	}{
+		{"truncated body", false, 1},
+		{"timeout", true, 3},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var attempts int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				atomic.AddInt32(&attempts, 1)
+				w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+				w.Write(content[:len(content)/2])
+				w.(http.Flusher).Flush()
+				if test.timeout {
+					time.Sleep(200 * time.Millisecond)
+				}
+			}))
+			defer server.Close()
+			cfg := testCatalogConfig(server.URL)
+			cfg.Timeout = duration(50 * time.Millisecond)
+
+			if _, _, err := downloadVergrabberJSON(cfg, nil); !errors.Is(err, errCatalogUnavailable) {
+				t.Errorf("vergrabber.json: error %v, want errCatalogUnavailable", err)
+			}
+			if attempts != test.attempts {
+				t.Errorf("vergrabber.json: %d attempts, want %d", attempts, test.attempts)
+			}
+
+			atomic.StoreInt32(&attempts, 0)
+			cfg.SignatureURL = server.URL + "/vergrabber.json.minisig"
+			if _, err := downloadCatalogSignature(cfg); !errors.Is(err, errCatalogSignature) {
+				t.Errorf("signature: error %v, want errCatalogSignature", err)
+			}
+			if attempts != test.attempts {
+				t.Errorf("signature: %d attempts, want %d", attempts, test.attempts)
+			}
+		})
+	}
+}
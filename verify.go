@@ -17,291 +17,169 @@
 package main
 
 import (
+	"fmt"
 	"strconv"
 	"strings"
+	"time"
 )
 
-func compareVersionStrings(version1, version2 string) int {
-	// replace "-" with "." to remediate version strings like 2.4.6-602
-	version1 = strings.Replace(version1, "-", ".", -1)
-	version2 = strings.Replace(version2, "-", ".", -1)
-
-	v1Split := strings.Split(version1, ".")
-	v2Split := strings.Split(version2, ".")
-	lenV1 := len(v1Split)
-	lenV2 := len(v2Split)
-
-	for i, v1 := range v1Split {
-		if i >= lenV2 {
-			return -1
-		}
-
-		v1Int, err1 := strconv.ParseUint(v1, 10, 64)
-		v2Int, err2 := strconv.ParseUint(v2Split[i], 10, 64)
-		if err1 != nil || err2 != nil {
-			// compare as string
-			return strings.Compare(v1, v2Split[i])
-		}
-
-		if v1Int > v2Int {
-			return 1
-		} else if v2Int == v1Int {
-			if i == lenV1-1 {
-				if lenV1 == lenV2 {
-					return 0
-				}
-				return -1
-			}
-			// else: go on
-		} else {
-			return -1
-		}
-	}
-
-	// TODO: we should return an error here instead
-	return -1
-}
-
-// verifies installed software versions
-func verifyInstalledSoftwareVersions(installedSoftware map[string]installedSoftwareComponent, softwareReleaseStatii map[string]softwareReleaseStatus) []installedSoftwareMapping {
+// verifies installed software versions (asOf is the date of the evaluation).
+// Software without product rule is matched to the catalog by the matcher (if
+// not nil). The release channels of the installed software are checked
+// against the channel policy (allowed channels per product rule name).
+func verifyInstalledSoftwareVersions(installedSoftware map[string]installedSoftwareComponent, softwareReleaseStatii map[string]softwareReleaseStatus, rules []productRule, matcher *catalogMatcher, channelPolicy map[string][]string, asOf time.Time) []installedSoftwareMapping {
 	var returnMapping []installedSoftwareMapping
 
 	for regKey, installedComponent := range installedSoftware {
-		var upToDate = false
-		var found = false
-		var mappedStatValue softwareReleaseStatus
-
-		// ignore list
-		if strings.HasPrefix(installedComponent.DisplayName, "Java Auto Updater") {
-			continue
+		mapping := installedSoftwareMapping{
+			Name:              installedComponent.DisplayName,
+			Status:            StatusUnknown,
+			Reason:            ReasonNotTracked,
+			InstalledSoftware: installedComponent,
 		}
 
-		// Firefox (special due to long term support releases)
-		if strings.HasPrefix(installedComponent.DisplayName, "Mozilla Firefox") {
-
-			version := installedComponent.DisplayVersion
-			versionSplit := strings.Split(version, ".")
-			minorVersion := versionSplit[0] + "." + versionSplit[1]
-			currentRelease, inStatii := softwareReleaseStatii["Mozilla Firefox "+minorVersion]
-			if inStatii {
-				mappedStatValue = currentRelease
-				found = true
-				if compareVersionStrings(currentRelease.Version, version) == 0 {
-					upToDate = true
-				}
+		rule, ruleFound := findProductRule(rules, installedComponent)
+		if ruleFound {
+			// ignore list
+			if rule.Ignore {
+				mapping.Reason = ReasonIgnored
 			} else {
-				// go through all version and select newest
-				for statName, statValue := range softwareReleaseStatii {
-					if strings.HasPrefix(statName, "Mozilla Firefox") {
-						if mappedStatValue.Version != "" {
-							if compareVersionStrings(mappedStatValue.Version, statValue.Version) > 0 {
-								// ignore, we already found a newer release
-							} else {
-								found = true
-								mappedStatValue = statValue
-							}
-						} else {
-							found = true
-							mappedStatValue = statValue
-						}
-					}
+				if channel, found := rule.detectChannel(installedComponent, softwareReleaseStatii); found {
+					installedComponent.Channel = channel.Name
+					mapping.InstalledSoftware.Channel = channel.Name
 				}
-			}
-		}
-
-		// LibreOffice (special due to fresh and still releases)
-		if strings.HasPrefix(installedComponent.DisplayName, "LibreOffice") {
-
-			version := installedComponent.DisplayVersion
-			versionSplit := strings.Split(version, ".")
-			minorVersion := versionSplit[0] + "." + versionSplit[1]
-			subMinorVersion := versionSplit[0] + "." + versionSplit[1] + "." + versionSplit[2]
-			currentRelease, inStatii := softwareReleaseStatii["LibreOffice "+minorVersion]
-			if inStatii {
-				mappedStatValue = currentRelease
-				found = true
-				if compareVersionStrings(currentRelease.Version, subMinorVersion) == 0 {
-					upToDate = true
+				mapping.MappedStatus, mapping.Status, mapping.Reason = rule.evaluate(installedComponent, softwareReleaseStatii, asOf)
+				if detail := rule.detail(installedComponent, mapping); detail != "" {
+					mapping.addDetail(detail)
 				}
-			} else {
-				// go through all versions and select newest
-				for statName, statValue := range softwareReleaseStatii {
-					if strings.HasPrefix(statName, "LibreOffice") {
-						if mappedStatValue.Version != "" {
-							if compareVersionStrings(mappedStatValue.Version, statValue.Version) > 0 {
-								// ignore, we already found a newer release
-							} else {
-								found = true
-								mappedStatValue = statValue
-							}
-						} else {
-							found = true
-							mappedStatValue = statValue
-						}
-					}
+				if !channelAllowed(channelPolicy, rule.Name, installedComponent.Channel) {
+					mapping.Status = StatusOutdated
+					mapping.Reason = ReasonChannelNotAllowed
+					mapping.addDetail(installedComponent.Channel + " channel")
 				}
 			}
-		}
-
-		// "Adobe Flash Player"
-		if strings.HasPrefix(installedComponent.DisplayName, "Adobe Flash Player") {
-			upToDate = false
-			found = true
-			mappedStatValue = softwareReleaseStatus{
-				Name:     "Adobe Flash Player",
-				Version:  "out of service - please uninstall",
-				Released: "2020-12-31",
-				Ends:     "2020-12-31",
+		} else if matcher != nil && !installedComponent.isHidden() {
+			if match, found := matcher.match(installedComponent); found {
+				Trace.Printf("%s matched to catalog product %s (confidence %d%%)", installedComponent.DisplayName, match.Product.Name, match.Confidence)
+				mapping.MappedStatus, mapping.Status, mapping.Reason = match.Product.rule().evaluate(installedComponent, softwareReleaseStatii, asOf)
+				mapping.MatchConfidence = match.Confidence
+				mapping.addDetail(fmt.Sprintf("matched automatically, %d%% confidence", match.Confidence))
 			}
-
 		}
 
-		// "Adobe Acrobat Reader"
-		if strings.HasPrefix(installedComponent.DisplayName, "Adobe Acrobat Reader") {
-			version := installedComponent.DisplayVersion
-			adobeName := "Adobe Acrobat Reader"
-			if strings.HasPrefix(installedComponent.DisplayName, "Adobe Acrobat Reader DC") {
-				// DC version
-				adobeName += " DC"
-			} else {
-				adobeName = installedComponent.DisplayName[0:25]
-			}
-			Trace.Printf("Adobe name: " + adobeName)
-
-			for statName, statValue := range softwareReleaseStatii {
-				if strings.HasPrefix(statName, adobeName) {
-					Trace.Printf("Adobe Reader version mapping found for %s", statName)
-
-					mappedStatValue = statValue
-					found = true
-					if strings.HasPrefix(version, statValue.Version) {
-						upToDate = true
-					}
-				}
-			}
+		switch mapping.Status {
+		case StatusUpToDate:
+			Info.Printf("%s seems up to date (%s, %s)", installedComponent.DisplayName, installedComponent.DisplayVersion, mapping.Reason)
+		case StatusOutdated:
+			Info.Printf("%s seems outdated!! (%s, %s)", installedComponent.DisplayName, installedComponent.DisplayVersion, mapping.Reason)
+		default:
+			Trace.Printf("No Information for %s (%s, %s)", installedComponent.DisplayName, regKey, mapping.Reason)
 		}
+		returnMapping = append(returnMapping, mapping)
+	}
 
-		// other software
-		softwares := []string{"Google Chrome", "OpenVPN",
-			"7-Zip", "TeamViewer",
-			"Mozilla Thunderbird", "VeraCrypt", "Java"}
-		for _, name := range softwares {
-			if strings.HasPrefix(installedComponent.DisplayName, name) {
-				version := installedComponent.DisplayVersion
-				versionSplit := strings.Split(version, ".")
-				minorVersion := versionSplit[0] + "." + versionSplit[1]
-				majorVersion := versionSplit[0]
-				for statName, statValue := range softwareReleaseStatii {
-					if strings.HasPrefix(statName, name+" "+minorVersion) {
-						Trace.Printf("Minor version mapping found for %s", statName)
-
-						mappedStatValue = statValue
-						found = true
-						if strings.HasPrefix(version, statValue.Version) { //compareVersionStrings(, ) == 0 {
-							upToDate = true
-						}
-					} else if strings.HasPrefix(statName, name+" "+majorVersion) {
-						Trace.Printf("Major version mapping found for %s", statName)
+	return returnMapping
+}
 
-						mappedStatValue = statValue
-						found = true
-						if strings.HasPrefix(version, statValue.Version) {
-							upToDate = true
-						}
-					} else if strings.HasPrefix(statName, name) {
-						if mappedStatValue.Version != "" {
-							// ignore, we already found a correct release
-						} else {
-							Trace.Printf("Name only mapping found for %s", statName)
+// disambiguateInstances adds the architecture and scope to the names of
+// software installed more than once (e.g. 32-bit and 64-bit Java), so that
+// every installation is shown as a separate row
+func disambiguateInstances(mappings []installedSoftwareMapping) {
+	count := make(map[string]int)
+	for _, mapping := range mappings {
+		count[mapping.Name]++
+	}
 
-							compareResult := compareVersionStrings(statValue.Version, version)
-							if compareResult == 0 {
-								found = true
-								mappedStatValue = statValue
-								upToDate = true
-							} else if compareResult < 0 {
-								// perhaps newer version as we know of (e.g. for Java) -> leave on unknown
-							} else {
-								found = true
-								mappedStatValue = statValue
-							}
-						}
-					}
-				}
-			}
+	for i := range mappings {
+		if count[mappings[i].Name] < 2 {
+			continue
 		}
-
-		// build mapping object
-		if upToDate {
-			returnMapping = append(returnMapping, installedSoftwareMapping{
-				Name:              installedComponent.DisplayName,
-				Status:            StatusUpToDate,
-				InstalledSoftware: installedComponent,
-				MappedStatus:      mappedStatValue,
-			})
-			Info.Printf("%s seems up to date (%s)", installedComponent.DisplayName, installedComponent.DisplayVersion)
-		} else if found {
-			returnMapping = append(returnMapping, installedSoftwareMapping{
-				Name:              installedComponent.DisplayName,
-				Status:            StatusOutdated,
-				InstalledSoftware: installedComponent,
-				MappedStatus:      mappedStatValue,
-			})
-			Info.Printf("%s seems outdated!! (%s)", installedComponent.DisplayName, installedComponent.DisplayVersion)
-		} else {
-			returnMapping = append(returnMapping, installedSoftwareMapping{
-				Name:              installedComponent.DisplayName,
-				Status:            StatusUnknown,
-				InstalledSoftware: installedComponent,
-				MappedStatus:      mappedStatValue,
-			})
-			Trace.Printf("No Information for %s (%s)", installedComponent.DisplayName, regKey)
+		var labels []string
+		if mappings[i].InstalledSoftware.Architecture != "" {
+			labels = append(labels, mappings[i].InstalledSoftware.Architecture)
+		}
+		if mappings[i].InstalledSoftware.Scope == ScopeUser {
+			labels = append(labels, "user")
+		}
+		if len(labels) > 0 {
+			mappings[i].Name += " (" + strings.Join(labels, ", ") + ")"
 		}
 	}
-
-	return returnMapping
 }
 
-// verify OS patchlevel
-func verifyOSPatchlevel(windowsVersion WindowsVersion, softwareReleaseStatii map[string]softwareReleaseStatus) installedSoftwareMapping {
-	var status int
-
-	if windowsVersion.CurrentMajorVersionNumber == 10 {
-		// Windows 10
-		windowsReleaseName := "Microsoft Windows 10 " + string(windowsVersion.ReleaseID)
-		Trace.Println("windowsReleaseName: ", windowsReleaseName)
+// verify OS patchlevel (build and UBR are compared numerically, the number
+// of missed cumulative updates is taken from the build history)
+func verifyOSPatchlevel(windowsVersion WindowsVersion, softwareReleaseStatii map[string]softwareReleaseStatus, history buildHistory) installedSoftwareMapping {
+	if release, ok := identifyWindowsRelease(windowsVersion); ok {
+		// Windows 10, Windows 11 or Windows Server
+		Trace.Println("windowsReleaseName: ", release.Release)
 		Trace.Println("windowsVersion.UBR: ", windowsVersion.UBR)
-		Trace.Println("string(windowsVersion.UBR): ", strconv.FormatUint(windowsVersion.UBR, 10))
 
 		windowsVersionString := windowsVersion.CurrentBuild + "." + strconv.FormatUint(windowsVersion.UBR, 10)
 		Trace.Println("windowsVersionString: ", windowsVersionString)
-		uptodateRelease := softwareReleaseStatii[windowsReleaseName]
-		Trace.Println("uptodateRelease: ", uptodateRelease)
-
-		if uptodateRelease.Version == windowsVersionString {
-			Info.Printf("Windows seems up to date")
-			status = StatusUpToDate
-		} else {
-			Info.Printf("Windows seems outdated!!")
-			status = StatusOutdated
-		}
-
-		return installedSoftwareMapping{
-			Name:   "Microsoft Windows 10",
-			Status: status,
+		mapping := installedSoftwareMapping{
+			Name: release.Name,
 			InstalledSoftware: installedSoftwareComponent{
-				DisplayName:    windowsReleaseName,
+				DisplayName:    release.Release,
 				DisplayVersion: windowsVersionString,
 				Publisher:      "Microsoft",
 			},
-			MappedStatus: uptodateRelease,
 		}
+
+		uptodateRelease, found := findWindowsCatalogEntry(release, windowsVersion, softwareReleaseStatii)
+		Trace.Println("uptodateRelease: ", uptodateRelease)
+		if !found {
+			Info.Printf("No catalog entry for %s", release.Release)
+			mapping.Status = StatusUnknown
+			mapping.Reason = ReasonNoCatalogEntry
+			return mapping
+		}
+		mapping.MappedStatus = uptodateRelease
+
+		installed, err := parseVersion(windowsVersionString)
+		if err != nil {
+			Info.Printf("Windows version %s not comparable: %s", windowsVersionString, err)
+			mapping.Status = StatusUnknown
+			mapping.Reason = ReasonVersionUnparseable
+			return mapping
+		}
+		current, err := parseVersion(uptodateRelease.Version)
+		if err != nil {
+			Info.Printf("Catalog version %s of %s not comparable: %s", uptodateRelease.Version, release.Release, err)
+			mapping.Status = StatusUnknown
+			mapping.Reason = ReasonVersionUnparseable
+			mapping.Detail = "catalog version " + uptodateRelease.Version
+			return mapping
+		}
+
+		switch c := installed.compare(current); {
+		case c == 0:
+			Info.Printf("Windows seems up to date")
+			mapping.Status = StatusUpToDate
+			mapping.Reason = ReasonCurrent
+		case c > 0:
+			Info.Printf("Windows is newer than the catalog (preview or out-of-band update)")
+			mapping.Status = StatusUpToDate
+			mapping.Reason = ReasonNewerThanCatalog
+		default:
+			Info.Printf("Windows seems outdated!!")
+			mapping.Status = StatusOutdated
+			mapping.Reason = ReasonUpdateAvailable
+			if installed.Parts[0] != current.Parts[0] {
+				mapping.Detail = "older build than catalog"
+			} else {
+				updates, atLeast := history.updatesBehind(uptodateRelease.Name+" "+uptodateRelease.MajorRelease, installed)
+				mapping.Detail = cumulativeUpdatesBehind(updates, atLeast)
+			}
+		}
+		return mapping
 	}
 
 	Info.Printf("Windows Version <= Windows 8: Not supported by Update Checker")
 	return installedSoftwareMapping{
 		Name:   windowsVersion.ProductName,
 		Status: StatusUnknown,
+		Reason: ReasonNotTracked,
 		InstalledSoftware: installedSoftwareComponent{
 			DisplayName:    windowsVersion.ProductName,
 			DisplayVersion: windowsVersion.CurrentBuild,
@@ -311,3 +189,21 @@ func verifyOSPatchlevel(windowsVersion WindowsVersion, softwareReleaseStatii map
 	}
 
 }
+
+// cumulativeUpdatesBehind returns the text for the number of missed
+// cumulative updates
+func cumulativeUpdatesBehind(updates int, atLeast bool) string {
+	if updates < 1 {
+		// the catalog version itself is always missing
+		updates, atLeast = 1, true
+	}
+	text := strconv.Itoa(updates) + " cumulative update"
+	if updates > 1 {
+		text += "s"
+	}
+	text += " behind"
+	if atLeast {
+		text = "at least " + text
+	}
+	return text
+}
@@ -0,0 +1,196 @@
+// Update Checker
+// Copyright (C) 2020-22  Florian Probst
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+// testWindowsCatalog returns the Windows entries of a catalog
+func testWindowsCatalog() map[string]softwareReleaseStatus {
+	return map[string]softwareReleaseStatus{
+		"Microsoft Windows 10 21H2":      {Name: "Microsoft Windows 10", MajorRelease: "21H2", Category: "client", Version: "19044.1526", Ends: "2023-06-13"},
+		"Microsoft Windows 10 1809":      {Name: "Microsoft Windows 10", MajorRelease: "1809", Category: "client", Version: "17763.2565", Ends: "2020-11-10"},
+		"Microsoft Windows 10 LTSC 2021": {Name: "Microsoft Windows 10", MajorRelease: "LTSC 2021", Category: "client", Version: "19044.1526", Ends: "2027-01-12"},
+		"Microsoft Windows 11 21H2":      {Name: "Microsoft Windows 11", MajorRelease: "21H2", Category: "client", Version: "22000.493", Ends: "2023-10-10"},
+		"Microsoft Windows Server 2019":  {Name: "Microsoft Windows Server", MajorRelease: "2019", Category: "server", Version: "17763.2565", Ends: "2029-01-09"},
+		"Microsoft Windows Server 2022":  {Name: "Microsoft Windows Server", MajorRelease: "2022", Category: "server", Version: "20348.524", Ends: "2031-10-14"},
+		// Server 2016 by its version number, Hyper-V Server shares its build
+		"Microsoft Windows Server 1607":         {Name: "Microsoft Windows Server", MajorRelease: "1607", Category: "server", Version: "14393.4946", Ends: "2027-01-12"},
+		"Microsoft Windows Hyper-V Server 2016": {Name: "Microsoft Windows Hyper-V Server", MajorRelease: "2016", Category: "server", Version: "14393.4886", Ends: "2027-01-11"},
+	}
+}
+
+func TestIdentifyWindowsRelease(t *testing.T) {
+	tests := []struct {
+		name    string
+		version WindowsVersion
+		release windowsRelease
+	}{
+		{
+			"Windows 10",
+			WindowsVersion{CurrentMajorVersionNumber: 10, CurrentBuild: "19044", ReleaseID: "21H2", EditionID: "Professional", ProductName: "Windows 10 Pro"},
+			windowsRelease{Name: "Microsoft Windows 10", Product: "Microsoft Windows 10", Release: "Microsoft Windows 10 21H2", Category: "client",
+				CatalogKeys: []string{"Microsoft Windows 10 21H2"}},
+		},
+		{
+			// Windows 11 still reports Windows 10 as product name
+			"Windows 11",
+			WindowsVersion{CurrentMajorVersionNumber: 10, CurrentBuild: "22000", ReleaseID: "21H2", EditionID: "Professional", ProductName: "Windows 10 Pro"},
+			windowsRelease{Name: "Microsoft Windows 11", Product: "Microsoft Windows 11", Release: "Microsoft Windows 11 21H2", Category: "client",
+				CatalogKeys: []string{"Microsoft Windows 11 21H2"}},
+		},
+		{
+			"LTSC 2019",
+			WindowsVersion{CurrentMajorVersionNumber: 10, CurrentBuild: "17763", ReleaseID: "1809", EditionID: "EnterpriseS", ProductName: "Windows 10 Enterprise LTSC 2019"},
+			windowsRelease{Name: "Microsoft Windows 10", Product: "Microsoft Windows 10", Release: "Microsoft Windows 10 LTSC 2019", Category: "client",
+				CatalogKeys: []string{"Microsoft Windows 10 LTSC 2019", "Microsoft Windows 10 1809"}, LTSC: true},
+		},
+		{
+			"LTSB 2016",
+			WindowsVersion{CurrentMajorVersionNumber: 10, CurrentBuild: "14393", ReleaseID: "1607", EditionID: "EnterpriseSN", ProductName: "Windows 10 Enterprise N 2016 LTSB"},
+			windowsRelease{Name: "Microsoft Windows 10", Product: "Microsoft Windows 10", Release: "Microsoft Windows 10 LTSC 2016", Category: "client",
+				CatalogKeys: []string{"Microsoft Windows 10 LTSC 2016", "Microsoft Windows 10 1607"}, LTSC: true},
+		},
+		{
+			// Enterprise on the build of an LTSC release
+			"Enterprise 1809",
+			WindowsVersion{CurrentMajorVersionNumber: 10, CurrentBuild: "17763", ReleaseID: "1809", EditionID: "Enterprise", ProductName: "Windows 10 Enterprise"},
+			windowsRelease{Name: "Microsoft Windows 10", Product: "Microsoft Windows 10", Release: "Microsoft Windows 10 1809", Category: "client",
+				CatalogKeys: []string{"Microsoft Windows 10 1809"}},
+		},
+		{
+			"Server 2019",
+			WindowsVersion{CurrentMajorVersionNumber: 10, CurrentBuild: "17763", ReleaseID: "1809", EditionID: "ServerStandard", InstallationType: "Server", ProductName: "Windows Server 2019 Standard"},
+			windowsRelease{Name: "Microsoft Windows Server 2019", Product: "Microsoft Windows Server", Release: "Microsoft Windows Server 2019", Category: "server",
+				CatalogKeys: []string{"Microsoft Windows Server 2019"}},
+		},
+		{
+			"Server 2016 Core",
+			WindowsVersion{CurrentMajorVersionNumber: 10, CurrentBuild: "14393", ReleaseID: "1607", EditionID: "ServerDatacenter", InstallationType: "Server Core", ProductName: "Windows Server 2016 Datacenter"},
+			windowsRelease{Name: "Microsoft Windows Server 2016", Product: "Microsoft Windows Server", Release: "Microsoft Windows Server 2016", Category: "server",
+				CatalogKeys: []string{"Microsoft Windows Server 2016"}},
+		},
+		{
+			"Server 1909",
+			WindowsVersion{CurrentMajorVersionNumber: 10, CurrentBuild: "18363", ReleaseID: "1909", EditionID: "ServerStandard", InstallationType: "Server Core", ProductName: "Windows Server Standard"},
+			windowsRelease{Name: "Microsoft Windows Server", Product: "Microsoft Windows Server", Release: "Microsoft Windows Server 1909", Category: "server",
+				CatalogKeys: []string{"Microsoft Windows Server 1909"}},
+		},
+	}
+	for _, test := range tests {
+		release, ok := identifyWindowsRelease(test.version)
+		if !ok {
+			t.Errorf("%s: not identified", test.name)
+			continue
+		}
+		if !reflect.DeepEqual(release, test.release) {
+			t.Errorf("%s: %+v, want %+v", test.name, release, test.release)
+		}
+	}
+
+	if release, ok := identifyWindowsRelease(WindowsVersion{CurrentMajorVersionNumber: 6, CurrentMinorVersionNumber: 3, CurrentBuild: "9600"}); ok {
+		t.Errorf("Windows 8.1 identified as %s", release.Release)
+	}
+}
+
+func TestFindWindowsCatalogEntry(t *testing.T) {
+	tests := []struct {
+		name    string
+		version WindowsVersion
+		entry   string // key of the entry in testWindowsCatalog
+		ends    string
+	}{
+		{"Windows 10", WindowsVersion{CurrentMajorVersionNumber: 10, CurrentBuild: "19044", ReleaseID: "21H2"}, "Microsoft Windows 10 21H2", "2023-06-13"},
+		{"Server 2019", WindowsVersion{CurrentMajorVersionNumber: 10, CurrentBuild: "17763", ReleaseID: "1809", InstallationType: "Server"}, "Microsoft Windows Server 2019", "2029-01-09"},
+		// by build number, the entry of Windows Server is preferred
+		{"Server 2016", WindowsVersion{CurrentMajorVersionNumber: 10, CurrentBuild: "14393", ReleaseID: "1607", InstallationType: "Server"}, "Microsoft Windows Server 1607", "2027-01-12"},
+		{"Hyper-V Server 2016", WindowsVersion{CurrentMajorVersionNumber: 10, CurrentBuild: "14393", ReleaseID: "1607", InstallationType: "Server", ProductName: "Hyper-V Server 2016"}, "Microsoft Windows Server 1607", "2027-01-12"},
+		// LTSC with its own entry
+		{"LTSC 2021", WindowsVersion{CurrentMajorVersionNumber: 10, CurrentBuild: "19044", ReleaseID: "21H2", EditionID: "EnterpriseS"}, "Microsoft Windows 10 LTSC 2021", "2027-01-12"},
+		// LTSC with the build of the general availability release, which
+		// ended before the LTSC
+		{"LTSC 2019", WindowsVersion{CurrentMajorVersionNumber: 10, CurrentBuild: "17763", ReleaseID: "1809", EditionID: "EnterpriseS"}, "Microsoft Windows 10 1809", ""},
+		{"Enterprise 1809", WindowsVersion{CurrentMajorVersionNumber: 10, CurrentBuild: "17763", ReleaseID: "1809", EditionID: "Enterprise"}, "Microsoft Windows 10 1809", "2020-11-10"},
+	}
+	catalog := testWindowsCatalog()
+	for _, test := range tests {
+		release, ok := identifyWindowsRelease(test.version)
+		if !ok {
+			t.Fatalf("%s: not identified", test.name)
+		}
+		entry, found := findWindowsCatalogEntry(release, test.version, catalog)
+		if !found {
+			t.Errorf("%s: no catalog entry", test.name)
+			continue
+		}
+		want := catalog[test.entry]
+		if entry.Name != want.Name || entry.MajorRelease != want.MajorRelease || entry.Version != want.Version || entry.Ends != test.ends {
+			t.Errorf("%s: %+v, want %s with end of life %q", test.name, entry, test.entry, test.ends)
+		}
+	}
+
+	// LTSB 2016 has no own entry and there is no client entry of its build
+	ltsb := WindowsVersion{CurrentMajorVersionNumber: 10, CurrentBuild: "14393", ReleaseID: "1607", EditionID: "EnterpriseS"}
+	release, _ := identifyWindowsRelease(ltsb)
+	if entry, found := findWindowsCatalogEntry(release, ltsb, catalog); found {
+		t.Errorf("LTSB 2016: %+v", entry)
+	}
+}
+
+func TestVerifyOSPatchlevel(t *testing.T) {
+	history := buildHistory{
+		"Microsoft Windows 10 21H2": {"19044.1415", "19044.1466", "19044.1503", "19044.1526"},
+	}
+	windows10 := func(build string, ubr uint64) WindowsVersion {
+		return WindowsVersion{CurrentMajorVersionNumber: 10, CurrentBuild: build, UBR: ubr, ReleaseID: "21H2", ProductName: "Windows 10 Pro"}
+	}
+
+	tests := []struct {
+		name    string
+		version WindowsVersion
+		history buildHistory
+		status  softwareStatus
+		reason  statusReason
+		detail  string
+	}{
+		{"equal build", windows10("19044", 1526), history, StatusUpToDate, ReasonCurrent, ""},
+		{"Windows 11", WindowsVersion{CurrentMajorVersionNumber: 10, CurrentBuild: "22000", UBR: 493, ReleaseID: "21H2"}, history, StatusUpToDate, ReasonCurrent, ""},
+		{"ahead of the catalog", windows10("19044", 1560), history, StatusUpToDate, ReasonNewerThanCatalog, ""},
+		{"one update behind", windows10("19044", 1503), history, StatusOutdated, ReasonUpdateAvailable, "1 cumulative update behind"},
+		{"two updates behind", windows10("19044", 1466), history, StatusOutdated, ReasonUpdateAvailable, "2 cumulative updates behind"},
+		{"out-of-band update", windows10("19044", 1470), history, StatusOutdated, ReasonUpdateAvailable, "2 cumulative updates behind"},
+		{"older than the history", windows10("19044", 1200), history, StatusOutdated, ReasonUpdateAvailable, "at least 4 cumulative updates behind"},
+		{"no history", windows10("19044", 1466), buildHistory{}, StatusOutdated, ReasonUpdateAvailable, "at least 1 cumulative update behind"},
+		{"different feature build", windows10("19043", 1526), history, StatusOutdated, ReasonUpdateAvailable, "older build than catalog"},
+		{"no catalog entry", WindowsVersion{CurrentMajorVersionNumber: 10, CurrentBuild: "19042", UBR: 1526, ReleaseID: "20H2"}, history, StatusUnknown, ReasonNoCatalogEntry, ""},
+		{"Server 2019", WindowsVersion{CurrentMajorVersionNumber: 10, CurrentBuild: "17763", UBR: 2565, ReleaseID: "1809", InstallationType: "Server"}, history, StatusUpToDate, ReasonCurrent, ""},
+		{"Server 2016", WindowsVersion{CurrentMajorVersionNumber: 10, CurrentBuild: "14393", UBR: 4886, ReleaseID: "1607", InstallationType: "Server"}, history, StatusOutdated, ReasonUpdateAvailable, "at least 1 cumulative update behind"},
+		{"LTSC 2019", WindowsVersion{CurrentMajorVersionNumber: 10, CurrentBuild: "17763", UBR: 2565, ReleaseID: "1809", EditionID: "EnterpriseS"}, history, StatusUpToDate, ReasonCurrent, ""},
+		{"LTSC 2021", WindowsVersion{CurrentMajorVersionNumber: 10, CurrentBuild: "19044", UBR: 1503, ReleaseID: "21H2", EditionID: "EnterpriseS"}, history, StatusOutdated, ReasonUpdateAvailable, "at least 1 cumulative update behind"},
+		{"Windows 8.1", WindowsVersion{CurrentMajorVersionNumber: 6, CurrentMinorVersionNumber: 3, CurrentBuild: "9600", ProductName: "Windows 8.1 Pro"}, history, StatusUnknown, ReasonNotTracked, ""},
+	}
+	for _, test := range tests {
+		mapping := verifyOSPatchlevel(test.version, testWindowsCatalog(), test.history)
+		if mapping.Status != test.status || mapping.Reason != test.reason || mapping.Detail != test.detail {
+			t.Errorf("%s: %s (%s, %q), want %s (%s, %q)", test.name,
+				statusString(mapping.Status), mapping.Reason, mapping.Detail,
+				statusString(test.status), test.reason, test.detail)
+		}
+	}
+}
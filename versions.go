@@ -0,0 +1,250 @@
+// Update Checker
+// Copyright (C) 2020-22  Florian Probst
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// errInvalidVersion is returned (wrapped) for version strings that cannot be parsed
+var errInvalidVersion = errors.New("invalid version")
+
+// softwareVersion is a parsed version string. Supported are dotted versions
+// ("121.0.6167.85", "23.01") with dash or underscore separated parts
+// ("2.4.6-602", "1.8.0_291") and an optional suffix ("7.4.2 beta", "1.1.1m",
+// "1.24-Update7").
+//
+// Precedence: the numeric parts are compared one by one (missing parts count
+// as 0, so 1.2 == 1.2.0 and 1.10 > 1.9). On equal parts a pre-release suffix
+// (alpha, beta, rc, ..., "a" or "b" followed by a number) is lower than no
+// suffix, any other suffix (like a patch letter or "update7") is higher.
+type softwareVersion struct {
+	Parts  []uint64
+	Suffix string // lower case, without leading separators
+	raw    string
+}
+
+// pre-release suffixes and their order
+var preReleaseRanks = map[string]int{
+	"dev":     0,
+	"nightly": 0,
+	"canary":  0,
+	"ea":      0,
+	"alpha":   1,
+	"a":       1,
+	"beta":    2,
+	"b":       2,
+	"pre":     3,
+	"preview": 3,
+	"rc":      4,
+}
+
+// parseVersion parses a version string
+func parseVersion(versionString string) (softwareVersion, error) {
+	v := softwareVersion{raw: versionString}
+	s := strings.ToLower(strings.TrimSpace(versionString))
+	s = strings.TrimPrefix(s, "v")
+	if s == "" {
+		return v, fmt.Errorf("%w: empty string", errInvalidVersion)
+	}
+
+	i := 0
+	for i < len(s) {
+		// numeric part
+		start := i
+		for i < len(s) && s[i] >= '0' && s[i] <= '9' {
+			i++
+		}
+		if start == i {
+			break
+		}
+		part, err := strconv.ParseUint(s[start:i], 10, 64)
+		if err != nil {
+			return v, fmt.Errorf("%w: %q: %s", errInvalidVersion, versionString, err)
+		}
+		v.Parts = append(v.Parts, part)
+
+		// separator, only followed by another numeric part
+		if i+1 < len(s) && isVersionSeparator(s[i]) && s[i+1] >= '0' && s[i+1] <= '9' {
+			i++
+			continue
+		}
+		break
+	}
+
+	if len(v.Parts) == 0 {
+		return v, fmt.Errorf("%w: %q does not start with a number", errInvalidVersion, versionString)
+	}
+
+	v.Suffix = strings.TrimLeft(s[i:], ".-_+ ")
+	for _, r := range v.Suffix {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) && !strings.ContainsRune(".-_+ ()", r) {
+			return v, fmt.Errorf("%w: %q has an unexpected suffix", errInvalidVersion, versionString)
+		}
+	}
+
+	return v, nil
+}
+
+func isVersionSeparator(c byte) bool {
+	return c == '.' || c == '-' || c == '_'
+}
+
+// String returns the original version string
+func (v softwareVersion) String() string {
+	return v.raw
+}
+
+// compare returns -1 if v < other, 0 if v == other and 1 if v > other
+func (v softwareVersion) compare(other softwareVersion) int {
+	for i := 0; i < len(v.Parts) || i < len(other.Parts); i++ {
+		var a, b uint64
+		if i < len(v.Parts) {
+			a = v.Parts[i]
+		}
+		if i < len(other.Parts) {
+			b = other.Parts[i]
+		}
+		if a < b {
+			return -1
+		} else if a > b {
+			return 1
+		}
+	}
+	return compareVersionSuffixes(v.Suffix, other.Suffix)
+}
+
+// hasPrefix checks if the first parts of v are equal to all parts of prefix
+// (1.10.2 has the prefix 1.10, but not 1.1)
+func (v softwareVersion) hasPrefix(prefix softwareVersion) bool {
+	if len(v.Parts) < len(prefix.Parts) {
+		return false
+	}
+	for i := range prefix.Parts {
+		if v.Parts[i] != prefix.Parts[i] {
+			return false
+		}
+	}
+	if prefix.Suffix != "" {
+		return len(v.Parts) == len(prefix.Parts) && compareVersionSuffixes(v.Suffix, prefix.Suffix) == 0
+	}
+	return true
+}
+
+// isPreRelease checks for suffixes like "beta" or "rc1"
+func (v softwareVersion) isPreRelease() bool {
+	_, isPre := preReleaseRank(v.Suffix)
+	return isPre
+}
+
+// preReleaseRank returns the rank of a pre-release suffix
+func preReleaseRank(suffix string) (int, bool) {
+	word := strings.TrimRightFunc(suffix, func(r rune) bool {
+		return unicode.IsDigit(r) || r == '.' || r == '-' || r == ' '
+	})
+	rank, isPre := preReleaseRanks[word]
+	if isPre && len(word) == 1 && (len(suffix) == 1 || !unicode.IsDigit(rune(suffix[1]))) {
+		// "a" and "b" only with a number ("97.0b9"), "1.1.1a" is a patch letter
+		return 0, false
+	}
+	return rank, isPre
+}
+
+// compareVersionSuffixes orders: pre-release < no suffix < other suffix
+func compareVersionSuffixes(a, b string) int {
+	if a == b {
+		return 0
+	}
+	class := func(suffix string) int {
+		if suffix == "" {
+			return 1
+		}
+		if _, isPre := preReleaseRank(suffix); isPre {
+			return 0
+		}
+		return 2
+	}
+	classA, classB := class(a), class(b)
+	if classA != classB {
+		if classA < classB {
+			return -1
+		}
+		return 1
+	}
+	if classA == 0 {
+		rankA, _ := preReleaseRank(a)
+		rankB, _ := preReleaseRank(b)
+		if rankA != rankB {
+			if rankA < rankB {
+				return -1
+			}
+			return 1
+		}
+	}
+	return compareNatural(a, b)
+}
+
+// compareNatural compares strings with embedded numbers, numbers are compared
+// numerically ("update10" > "update7")
+func compareNatural(a, b string) int {
+	for a != "" && b != "" {
+		tokenA, restA := nextNaturalToken(a)
+		tokenB, restB := nextNaturalToken(b)
+		numA, errA := strconv.ParseUint(tokenA, 10, 64)
+		numB, errB := strconv.ParseUint(tokenB, 10, 64)
+		if errA == nil && errB == nil {
+			if numA != numB {
+				if numA < numB {
+					return -1
+				}
+				return 1
+			}
+		} else if c := strings.Compare(tokenA, tokenB); c != 0 {
+			return c
+		}
+		a, b = restA, restB
+	}
+	return strings.Compare(a, b)
+}
+
+// nextNaturalToken splits off the leading run of digits or non-digits
+func nextNaturalToken(s string) (string, string) {
+	isDigit := s[0] >= '0' && s[0] <= '9'
+	i := 1
+	for i < len(s) && (s[i] >= '0' && s[i] <= '9') == isDigit {
+		i++
+	}
+	return s[:i], s[i:]
+}
+
+// compareVersionStrings parses and compares two version strings, see
+// softwareVersion.compare
+func compareVersionStrings(version1, version2 string) (int, error) {
+	v1, err := parseVersion(version1)
+	if err != nil {
+		return 0, err
+	}
+	v2, err := parseVersion(version2)
+	if err != nil {
+		return 0, err
+	}
+	return v1.compare(v2), nil
+}
@@ -0,0 +1,197 @@
+// Update Checker
+// Copyright (C) 2020-22  Florian Probst
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"errors"
+	"math/rand"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestParseVersion(t *testing.T) {
+	tests := []struct {
+		version    string
+		parts      []uint64
+		suffix     string
+		preRelease bool
+	}{
+		{"121.0.6167.85", []uint64{121, 0, 6167, 85}, "", false},
+		{"1.8.0_291", []uint64{1, 8, 0, 291}, "", false},
+		{"23.01", []uint64{23, 1}, "", false},
+		{"2.4.6-602", []uint64{2, 4, 6, 602}, "", false},
+		{"7.4.2 beta", []uint64{7, 4, 2}, "beta", true},
+		{"1.24-Update7", []uint64{1, 24}, "update7", false},
+		{"1.1.1m", []uint64{1, 1, 1}, "m", false},
+		{"1.1.1a", []uint64{1, 1, 1}, "a", false},
+		{"1.1.1b", []uint64{1, 1, 1}, "b", false},
+		{"97.0b9", []uint64{97, 0}, "b9", true},
+		{"3.0a1", []uint64{3, 0}, "a1", true},
+		{"4.0.0-rc1", []uint64{4, 0, 0}, "rc1", true},
+		{"v2.50", []uint64{2, 50}, "", false},
+	}
+	for _, test := range tests {
+		v, err := parseVersion(test.version)
+		if err != nil {
+			t.Errorf("parseVersion(%q): %s", test.version, err)
+			continue
+		}
+		if !reflect.DeepEqual(v.Parts, test.parts) || v.Suffix != test.suffix {
+			t.Errorf("parseVersion(%q) = %v %q, want %v %q", test.version, v.Parts, v.Suffix, test.parts, test.suffix)
+		}
+		if v.isPreRelease() != test.preRelease {
+			t.Errorf("parseVersion(%q).isPreRelease() = %t, want %t", test.version, v.isPreRelease(), test.preRelease)
+		}
+		if v.String() != test.version {
+			t.Errorf("parseVersion(%q).String() = %q", test.version, v.String())
+		}
+	}
+}
+
+func TestParseVersionInvalid(t *testing.T) {
+	for _, version := range []string{"", " ", "beta", "Release 0.76", "1.0/2", "99999999999999999999999"} {
+		if _, err := parseVersion(version); !errors.Is(err, errInvalidVersion) {
+			t.Errorf("parseVersion(%q) error = %v, want errInvalidVersion", version, err)
+		}
+	}
+}
+
+func TestCompareVersions(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"1.2", "1.2.0", 0},
+		{"1.10", "1.9", 1},
+		{"1.10", "1.1", 1},
+		{"23.01", "23.1", 0},
+		{"1.8.0_291", "1.8.0_301", -1},
+		{"2.4.6-602", "2.4.6-1000", -1},
+		{"7.4.2 beta", "7.4.2", -1},
+		{"7.4.2 alpha", "7.4.2 beta", -1},
+		{"7.4.2 rc1", "7.4.2 beta", 1},
+		{"7.4.2 rc1", "7.4.2 rc2", -1},
+		{"97.0b9", "97.0", -1},
+		{"97.0a1", "97.0b9", -1},
+		{"1.1.1a", "1.1.1", 1},
+		{"1.1.1b", "1.1.1", 1},
+		{"1.1.1b", "1.1.1a", 1},
+		{"1.1.1m", "1.1.1l", 1},
+		{"1.24-Update7", "1.24", 1},
+		{"1.24-Update10", "1.24-Update7", 1},
+		{"1.25", "1.24-Update7", 1},
+	}
+	for _, test := range tests {
+		c, err := compareVersionStrings(test.a, test.b)
+		if err != nil {
+			t.Errorf("compareVersionStrings(%q, %q): %s", test.a, test.b, err)
+			continue
+		}
+		if c != test.want {
+			t.Errorf("compareVersionStrings(%q, %q) = %d, want %d", test.a, test.b, c, test.want)
+		}
+		if c, _ := compareVersionStrings(test.b, test.a); c != -test.want {
+			t.Errorf("compareVersionStrings(%q, %q) = %d, want %d", test.b, test.a, c, -test.want)
+		}
+	}
+}
+
+func TestHasPrefix(t *testing.T) {
+	tests := []struct {
+		version, prefix string
+		want            bool
+	}{
+		{"1.10.2", "1.10", true},
+		{"1.10.2", "1.1", false},
+		{"1.1.2", "1.10", false},
+		{"1.10", "1.10.2", false},
+		{"23.01.00.0", "23.01", true},
+		{"1.1.1k", "1.1.1", true},
+		{"1.1.1k", "1.1.1k", true},
+		{"1.1.1k", "1.1.1m", false},
+		{"1.24-Update7", "1.24", true},
+	}
+	for _, test := range tests {
+		v, err := parseVersion(test.version)
+		if err != nil {
+			t.Fatal(err)
+		}
+		prefix, err := parseVersion(test.prefix)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := v.hasPrefix(prefix); got != test.want {
+			t.Errorf("%q.hasPrefix(%q) = %t, want %t", test.version, test.prefix, got, test.want)
+		}
+	}
+}
+
+// randomVersion builds a version string from numbers, separators and
+// suffixes that occur in the catalog and in Uninstall keys
+func randomVersion(r *rand.Rand) string {
+	separators := []string{".", ".", ".", "-", "_"}
+	suffixes := []string{"", "", "", "a", "b9", "m", " beta", " rc1", "rc2", "-Update7", "-Update10", "alpha2", "preview"}
+	var b strings.Builder
+	for i, parts := 0, 1+r.Intn(4); i < parts; i++ {
+		if i > 0 {
+			b.WriteString(separators[r.Intn(len(separators))])
+		}
+		b.WriteString(strconv.Itoa(r.Intn(12)))
+	}
+	b.WriteString(suffixes[r.Intn(len(suffixes))])
+	return b.String()
+}
+
+// compare must be a total order: reflexive, antisymmetric and transitive
+func TestCompareVersionsOrder(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	versions := make([]softwareVersion, 300)
+	for i := range versions {
+		versionString := randomVersion(r)
+		v, err := parseVersion(versionString)
+		if err != nil {
+			t.Fatalf("%q: %s", versionString, err)
+		}
+		versions[i] = v
+	}
+
+	for _, a := range versions {
+		if c := a.compare(a); c != 0 {
+			t.Errorf("compare(%q, %q) = %d", a, a, c)
+		}
+		for _, b := range versions {
+			ab, ba := a.compare(b), b.compare(a)
+			if ab != -ba {
+				t.Fatalf("compare(%q, %q) = %d, but compare(%q, %q) = %d", a, b, ab, b, a, ba)
+			}
+		}
+	}
+
+	sort.SliceStable(versions, func(i, j int) bool {
+		return versions[i].compare(versions[j]) < 0
+	})
+	for i := range versions {
+		for j := i + 1; j < len(versions); j++ {
+			if c := versions[i].compare(versions[j]); c > 0 {
+				t.Fatalf("not transitive: %q sorted before %q, but compare = %d", versions[i], versions[j], c)
+			}
+		}
+	}
+}
@@ -0,0 +1,53 @@
+// Update Checker
+// Copyright (C) 2020-22  Florian Probst
+//
+// This program is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// This program is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+//go:build windows
+// +build windows
+
+package main
+
+import (
+	"os"
+
+	"golang.org/x/sys/windows"
+)
+
+const attachParentProcess = ^uintptr(0) // ATTACH_PARENT_PROCESS = (DWORD)-1
+
+var procAttachConsole = windows.NewLazySystemDLL("kernel32.dll").NewProc("AttachConsole")
+
+// attachConsole connects stdout and stderr to the console of the parent process.
+// UpdateChecker.exe is built with -H windowsgui, so it has no console of its
+// own. If the output has been redirected (e.g. to a file), nothing is changed.
+func attachConsole() {
+	handle, err := windows.GetStdHandle(windows.STD_OUTPUT_HANDLE)
+	if err == nil && handle != 0 && handle != windows.InvalidHandle {
+		return
+	}
+
+	r, _, _ := procAttachConsole.Call(attachParentProcess)
+	if r == 0 {
+		// no parent console (e.g. scheduled task without redirection)
+		return
+	}
+
+	console, err := os.OpenFile("CONOUT$", os.O_WRONLY, 0)
+	if err != nil {
+		return
+	}
+	os.Stdout = console
+	os.Stderr = console
+}
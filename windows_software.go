@@ -14,21 +14,55 @@
 // You should have received a copy of the GNU General Public License
 // along with this program.  If not, see <http://www.gnu.org/licenses/>.
 
+//go:build windows
+// +build windows
+
 package main
 
 import (
 	"fmt"
+	"os"
+	"runtime"
 
 	"golang.org/x/sys/windows/registry"
 )
 
+// registryInventory is the inventory provider for the local registry
+type registryInventory struct{}
+
+func init() {
+	registerInventoryProvider(registryInventory{})
+}
+
+// Name returns the name of the inventory source
+func (registryInventory) Name() string {
+	return "registry"
+}
+
+// InstalledSoftware reads the installed software from the local registry
+func (registryInventory) InstalledSoftware() (map[string]installedSoftwareComponent, error) {
+	return getInstalledSoftware()
+}
+
+// WindowsVersion reads the Windows version from the local registry
+func (registryInventory) WindowsVersion() (WindowsVersion, error) {
+	return getWindowsVersion()
+}
+
 // reads installed software from Microsoft Windows official registry keys
 func getInstalledSoftware() (map[string]installedSoftwareComponent, error) {
 	// Software from Uninstall registry keys
 	regKeysUninstall := []registryKeys{
-		{registry.LOCAL_MACHINE, "SOFTWARE\\Microsoft\\Windows\\CurrentVersion\\Uninstall", registry.ENUMERATE_SUB_KEYS | registry.QUERY_VALUE | registry.WOW64_64KEY},
-		{registry.LOCAL_MACHINE, "SOFTWARE\\Microsoft\\Windows\\CurrentVersion\\Uninstall", registry.ENUMERATE_SUB_KEYS | registry.QUERY_VALUE | registry.WOW64_32KEY},
-		{registry.CURRENT_USER, "SOFTWARE\\Microsoft\\Windows\\CurrentVersion\\Uninstall", registry.ENUMERATE_SUB_KEYS | registry.QUERY_VALUE},
+		{registry.LOCAL_MACHINE, uninstallKeyPath, registry.ENUMERATE_SUB_KEYS | registry.QUERY_VALUE | registry.WOW64_64KEY, ScopeMachine, ArchitectureX64},
+		{registry.LOCAL_MACHINE, uninstallKeyPath, registry.ENUMERATE_SUB_KEYS | registry.QUERY_VALUE | registry.WOW64_32KEY, ScopeMachine, ArchitectureX86},
+		{registry.CURRENT_USER, uninstallKeyPath, registry.ENUMERATE_SUB_KEYS | registry.QUERY_VALUE, ScopeUser, ""},
+	}
+	if !is64BitWindows() {
+		// there is only one view of HKLM on 32-bit Windows
+		regKeysUninstall = []registryKeys{
+			{registry.LOCAL_MACHINE, uninstallKeyPath, registry.ENUMERATE_SUB_KEYS | registry.QUERY_VALUE, ScopeMachine, ArchitectureX86},
+			{registry.CURRENT_USER, uninstallKeyPath, registry.ENUMERATE_SUB_KEYS | registry.QUERY_VALUE, ScopeUser, ""},
+		}
 	}
 
 	foundSoftware := make(map[string]installedSoftwareComponent)
@@ -58,18 +92,38 @@ func getInstalledSoftware() (map[string]installedSoftwareComponent, error) {
 			}
 			defer subKey.Close()
 
-			displayName, _, _ := subKey.GetStringValue("DisplayName")
-			if displayName == "" {
-				displayName = subKeys[j]
-			}
-			displayVersion, _, _ := subKey.GetStringValue("DisplayVersion")
-			publisher, _, _ := subKey.GetStringValue("Publisher")
-			//Trace.Printf("getInstalledSoftware: %s: %s %s (%s)", subKeys[j], displayName, displayVersion, publisher)
+			registryKey := regKeysUninstall[i].displayPath() + "\\" + subKeys[j]
+			newSoftwareFound := uninstallComponent(registryKey, subKeys[j], subKey)
+			newSoftwareFound.Scope = regKeysUninstall[i].scope
+			newSoftwareFound.Architecture = regKeysUninstall[i].architecture
+			//Trace.Printf("getInstalledSoftware: %s: %s %s (%s)", subKeys[j], newSoftwareFound.DisplayName, newSoftwareFound.DisplayVersion, newSoftwareFound.Publisher)
 
-			newSoftwareFound := installedSoftwareComponent{displayName, displayVersion, publisher}
-			foundSoftware[subKeys[j]] = newSoftwareFound
+			// keep all installations, the same sub key (e.g. a product GUID)
+			// can exist for 64-bit, 32-bit and the current user
+			key := subKeys[j]
+			if _, exists := foundSoftware[key]; exists {
+				key = registryKey
+			}
+			foundSoftware[key] = newSoftwareFound
 		}
 	}
 
 	return foundSoftware, nil
 }
+
+// displayPath returns the full path of the registry key as shown in regedit
+func (keys registryKeys) displayPath() string {
+	rootName := "HKLM"
+	if keys.rootKey == registry.CURRENT_USER {
+		rootName = "HKCU"
+	}
+	if keys.flags&registry.WOW64_32KEY != 0 && keys.path == uninstallKeyPath {
+		return rootName + "\\" + uninstallKeyPathWow64
+	}
+	return rootName + "\\" + keys.path
+}
+
+// is64BitWindows checks if Windows is 64-bit (also from a 32-bit process)
+func is64BitWindows() bool {
+	return runtime.GOARCH == "amd64" || runtime.GOARCH == "arm64" || os.Getenv("PROCESSOR_ARCHITEW6432") != ""
+}